@@ -0,0 +1,305 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/db/drs_db"
+	"github.com/chris-sg/bst_api/models/ddr_models"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/chris-sg/bst_api/utilities"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxActivityYears limits how long a range /activity will summarise.
+const maxActivityYears = 5
+
+// eagateLocation is the timezone eagate records ddr workout dates in.
+var eagateLocation = time.FixedZone("JST", 9*60*60)
+
+type activityDay struct {
+	Date string      `json:"date"`
+	Ddr  ddrActivity `json:"ddr"`
+	Drs  drsActivity `json:"drs"`
+}
+
+type ddrActivity struct {
+	Plays int     `json:"plays"`
+	Kcal  float32 `json:"kcal"`
+}
+
+type drsActivity struct {
+	Plays   int `json:"plays"`
+	Seconds int `json:"seconds"`
+}
+
+// activity is the per day play history of every game across all of a
+// user's linked eagate accounts. Weekdays start on Sunday. Ddr workout
+// data has no time of day, so ddr plays are always bucketed by their
+// date in japan, for both Days and Weekdays, and Hours only counts drs
+// plays.
+type activity struct {
+	Timezone      string        `json:"timezone"`
+	Days          []activityDay `json:"days"`
+	CurrentStreak int           `json:"currentstreak"`
+	LongestStreak int           `json:"longeststreak"`
+	Weekdays      [7]int        `json:"weekdays"`
+	Hours         [24]int       `json:"hours"`
+
+	loc   *time.Location
+	index map[string]int
+}
+
+// newActivity will create an empty day for every date from start up
+// to, but not including, end.
+func newActivity(loc *time.Location, start time.Time, end time.Time) *activity {
+	a := &activity{
+		Timezone: loc.String(),
+		Days:     make([]activityDay, 0),
+		loc:      loc,
+		index:    make(map[string]int),
+	}
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		a.index[date] = len(a.Days)
+		a.Days = append(a.Days, activityDay{Date: date})
+	}
+	return a
+}
+
+// addDdr will count workout data on the date eagate recorded it for,
+// as it is only kept per day. The weekday is that of the same japanese
+// date rather than of the user's timezone, so it always agrees with the
+// day the plays are listed under.
+func (a *activity) addDdr(workoutData []ddr_models.WorkoutData) {
+	for _, wd := range workoutData {
+		date := wd.Date.In(eagateLocation)
+		i, ok := a.index[date.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		a.Days[i].Ddr.Plays += wd.PlayCount
+		a.Days[i].Ddr.Kcal += wd.Kcal
+		a.Weekdays[date.Weekday()] += wd.PlayCount
+	}
+}
+
+// addDrs will count a player's plays and the time spent on them. Scores
+// give the time of each play, and the play time between two snapshots
+// is shared evenly between the plays made in between. Plays missing
+// from the score history, which eagate only keeps so much of, are
+// counted at the time of the later snapshot. Snapshots and scores must
+// be ordered oldest first.
+func (a *activity) addDrs(snapshots []drs_models.PlayerProfileSnapshot, scores []drs_models.PlayerScore) {
+	next := 0
+	for i := 1; i < len(snapshots); i++ {
+		previous, current := snapshots[i-1], snapshots[i]
+		for next < len(scores) && !scores[next].PlayTime.After(previous.LastPlayed) {
+			a.addDrsPlays(scores[next].PlayTime, 1, 0)
+			next++
+		}
+
+		between := make([]time.Time, 0)
+		for next < len(scores) && !scores[next].PlayTime.After(current.LastPlayed) {
+			between = append(between, scores[next].PlayTime)
+			next++
+		}
+
+		plays := current.PlayCount - previous.PlayCount
+		if plays < len(between) {
+			plays = len(between)
+		}
+		if plays == 0 {
+			continue
+		}
+		seconds := current.PlaySeconds - previous.PlaySeconds
+		for j, playTime := range between {
+			a.addDrsPlays(playTime, 1, seconds*(j+1)/plays-seconds*j/plays)
+		}
+		if missing := plays - len(between); missing > 0 {
+			a.addDrsPlays(current.LastPlayed, missing, seconds-seconds*len(between)/plays)
+		}
+	}
+	for ; next < len(scores); next++ {
+		a.addDrsPlays(scores[next].PlayTime, 1, 0)
+	}
+}
+
+func (a *activity) addDrsPlays(playTime time.Time, plays int, seconds int) {
+	local := playTime.In(a.loc)
+	i, ok := a.index[local.Format("2006-01-02")]
+	if !ok {
+		return
+	}
+	a.Days[i].Drs.Plays += plays
+	a.Days[i].Drs.Seconds += seconds
+	a.Weekdays[local.Weekday()] += plays
+	a.Hours[local.Hour()] += plays
+}
+
+// countStreaks will find the longest run of days played, and the run
+// leading up to the last day. The last day may not have been played
+// yet without ending the current streak.
+func (a *activity) countStreaks() {
+	run := 0
+	for i, day := range a.Days {
+		if day.Ddr.Plays+day.Drs.Plays == 0 {
+			if i < len(a.Days)-1 {
+				run = 0
+			}
+			continue
+		}
+		run++
+		if run > a.LongestStreak {
+			a.LongestStreak = run
+		}
+	}
+	a.CurrentStreak = run
+}
+
+// ActivityGet will retrieve the daily activity of every linked eagate
+// account between `start` and `end` (inclusive, formatted as
+// 2006-01-02) in the user's preferred timezone.
+func ActivityGet(rw http.ResponseWriter, r *http.Request) {
+	tokenMap := utilities.ProfileFromToken(r)
+
+	val, ok := tokenMap["sub"].(string)
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorJwtProfile)
+		return
+	}
+	val = strings.ToLower(val)
+
+	usernames, err := RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	profile, errs := db.GetApiDb().RetrieveProfile(val)
+	if utilities.PrintErrors("failed to retrieve profile:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorApiProfileDbRead)
+		return
+	}
+	loc := profile.Location()
+
+	query := r.URL.Query()
+	now := time.Now().In(loc)
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if endDateString := query.Get("end"); len(endDateString) > 0 {
+		parsed, e := time.ParseInLocation("2006-01-02", endDateString, loc)
+		if e != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorTimeParse)
+			return
+		}
+		end = parsed
+	}
+	end = end.AddDate(0, 0, 1)
+
+	start := end.AddDate(-1, 0, 0)
+	if startDateString := query.Get("start"); len(startDateString) > 0 {
+		parsed, e := time.ParseInLocation("2006-01-02", startDateString, loc)
+		if e != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorTimeParse)
+			return
+		}
+		start = parsed
+	}
+	if !start.Before(end) || start.AddDate(maxActivityYears, 0, 0).Before(end) {
+		utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+		return
+	}
+
+	a := newActivity(loc, start, end)
+	for _, username := range usernames {
+		err = addDdrActivity(a, username, start, end)
+		if !err.Equals(bst_models.ErrorOK) {
+			utilities.RespondWithError(rw, err)
+			return
+		}
+		err = addDrsActivity(a, username, start, end)
+		if !err.Equals(bst_models.ErrorOK) {
+			utilities.RespondWithError(rw, err)
+			return
+		}
+	}
+	a.countStreaks()
+
+	bytes, _ := json.Marshal(a)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+func addDdrActivity(a *activity, eaUser string, start time.Time, end time.Time) (err bst_models.Error) {
+	err = bst_models.ErrorOK
+
+	details, exists, errs := db.GetDdrDb().RetrievePlayerDetailsByEaGateUser(eaUser)
+	if !exists {
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve ddr details:", errs) {
+		err = bst_models.ErrorDdrPlayerInfoDbRead
+		return
+	}
+
+	// workout dates are midnight in japan, so a day either side is read
+	// to cover any timezone
+	workoutData, errs := db.GetDdrDb().RetrieveWorkoutDataByPlayerCodeInDateRange(details.Code, start.AddDate(0, 0, -1), end.AddDate(0, 0, 1))
+	if utilities.PrintErrors("failed to retrieve ddr workout data:", errs) {
+		err = bst_models.ErrorDdrStatsDbRead
+		return
+	}
+	a.addDdr(workoutData)
+	return
+}
+
+func addDrsActivity(a *activity, eaUser string, start time.Time, end time.Time) (err bst_models.Error) {
+	err = bst_models.ErrorOK
+
+	details, errs := db.GetDrsDb().RetrievePlayerDetailsByEaGateUser(eaUser)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve drs details:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+
+	snapshots, errs := db.GetDrsDb().RetrievePlayerProfileSnapshots(details.Code, start, end)
+	if utilities.PrintErrors("failed to retrieve drs snapshots:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+	// the snapshot before start is needed for the first delta in range
+	previous, errs := db.GetDrsDb().RetrievePlayerProfileSnapshotBefore(details.Code, start)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		errs = nil
+	} else if len(errs) == 0 {
+		snapshots = append([]drs_models.PlayerProfileSnapshot{previous}, snapshots...)
+	}
+	if utilities.PrintErrors("failed to retrieve drs snapshot:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+
+	from := start
+	if len(snapshots) > 0 && snapshots[0].LastPlayed.Before(from) {
+		from = snapshots[0].LastPlayed
+	}
+	scores, _, errs := db.GetDrsDb().RetrieveFilteredPlayerScores(details.Code, drs_db.PlayerScoreFilter{From: from, To: end})
+	if utilities.PrintErrors("failed to retrieve drs scores:", errs) {
+		err = bst_models.ErrorDrsSongDataDbRead
+		return
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].PlayTime.Before(scores[j].PlayTime)
+	})
+
+	a.addDrs(snapshots, scores)
+	return
+}
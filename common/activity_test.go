@@ -0,0 +1,148 @@
+package common
+
+import (
+	"github.com/chris-sg/bst_api/models/ddr_models"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"testing"
+	"time"
+)
+
+func TestAddDrs(t *testing.T) {
+	loc := time.FixedZone("UTC+9", 9*60*60)
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, loc)
+	at := func(day int, hour int) time.Time {
+		return time.Date(2021, time.March, day, hour, 0, 0, 0, loc)
+	}
+	score := func(playTime time.Time) drs_models.PlayerScore {
+		return drs_models.PlayerScore{PlayTime: playTime}
+	}
+
+	type day struct {
+		plays   int
+		seconds int
+	}
+	tests := []struct {
+		name      string
+		snapshots []drs_models.PlayerProfileSnapshot
+		scores    []drs_models.PlayerScore
+		days      map[string]day
+		hours     map[int]int
+	}{
+		{
+			name: "seconds are shared between plays",
+			snapshots: []drs_models.PlayerProfileSnapshot{
+				{PlayCount: 10, PlaySeconds: 600, LastPlayed: at(1, 10)},
+				{PlayCount: 12, PlaySeconds: 750, LastPlayed: at(1, 12)},
+			},
+			scores: []drs_models.PlayerScore{score(at(1, 11)), score(at(1, 12))},
+			days:   map[string]day{"2021-03-01": {2, 150}},
+			hours:  map[int]int{11: 1, 12: 1},
+		},
+		{
+			name: "plays missing from the history are counted at the later snapshot",
+			snapshots: []drs_models.PlayerProfileSnapshot{
+				{PlayCount: 10, PlaySeconds: 600, LastPlayed: at(1, 10)},
+				{PlayCount: 13, PlaySeconds: 780, LastPlayed: at(2, 9)},
+			},
+			scores: []drs_models.PlayerScore{score(at(1, 11))},
+			days:   map[string]day{"2021-03-01": {1, 60}, "2021-03-02": {2, 120}},
+			hours:  map[int]int{11: 1, 9: 2},
+		},
+		{
+			name: "plays outside the snapshots have no seconds",
+			snapshots: []drs_models.PlayerProfileSnapshot{
+				{PlayCount: 10, PlaySeconds: 600, LastPlayed: at(1, 10)},
+				{PlayCount: 11, PlaySeconds: 660, LastPlayed: at(1, 11)},
+			},
+			scores: []drs_models.PlayerScore{score(at(1, 9)), score(at(1, 11)), score(at(2, 8))},
+			days:   map[string]day{"2021-03-01": {2, 60}, "2021-03-02": {1, 0}},
+			hours:  map[int]int{9: 1, 11: 1, 8: 1},
+		},
+		{
+			name: "plays are bucketed by the user's timezone",
+			scores: []drs_models.PlayerScore{
+				score(time.Date(2021, time.March, 1, 16, 0, 0, 0, time.UTC)),
+			},
+			days:  map[string]day{"2021-03-02": {1, 0}},
+			hours: map[int]int{1: 1},
+		},
+		{
+			name:   "plays outside the range are ignored",
+			scores: []drs_models.PlayerScore{score(at(4, 10)), score(start.Add(-time.Hour))},
+		},
+	}
+
+	for _, test := range tests {
+		a := newActivity(loc, start, start.AddDate(0, 0, 3))
+		a.addDrs(test.snapshots, test.scores)
+		for _, d := range a.Days {
+			expected := test.days[d.Date]
+			if d.Drs.Plays != expected.plays || d.Drs.Seconds != expected.seconds {
+				t.Errorf("%s: expected %d plays and %d seconds on %s but got %d and %d",
+					test.name, expected.plays, expected.seconds, d.Date, d.Drs.Plays, d.Drs.Seconds)
+			}
+		}
+		for hour, plays := range a.Hours {
+			if plays != test.hours[hour] {
+				t.Errorf("%s: expected %d plays at hour %d but got %d", test.name, test.hours[hour], hour, plays)
+			}
+		}
+	}
+}
+
+func TestAddDdrUsesJapaneseDates(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, loc)
+	a := newActivity(loc, start, start.AddDate(0, 0, 3))
+
+	// eagate records the date as midnight in japan, which is still the
+	// day before in the user's timezone
+	a.addDdr([]ddr_models.WorkoutData{
+		{Date: time.Date(2021, time.March, 2, 0, 0, 0, 0, eagateLocation), PlayCount: 5, Kcal: 10},
+	})
+	for _, d := range a.Days {
+		expected := 0
+		if d.Date == "2021-03-02" {
+			expected = 5
+		}
+		if d.Ddr.Plays != expected {
+			t.Errorf("expected %d plays on %s but got %d", expected, d.Date, d.Ddr.Plays)
+		}
+	}
+	if a.Weekdays[time.Tuesday] != 5 || a.Weekdays[time.Monday] != 0 {
+		t.Errorf("expected plays on tuesday but got %v", a.Weekdays)
+	}
+}
+
+func TestCountStreaks(t *testing.T) {
+	tests := []struct {
+		name    string
+		plays   []int
+		current int
+		longest int
+	}{
+		{"no plays", []int{0, 0, 0}, 0, 0},
+		{"played every day", []int{1, 2, 3}, 3, 3},
+		{"played up to today", []int{1, 1, 0, 1, 1, 1}, 3, 3},
+		{"not played yet today", []int{1, 1, 0, 1, 0}, 1, 2},
+		{"not played yesterday", []int{1, 1, 0, 0}, 0, 2},
+	}
+
+	for _, test := range tests {
+		start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+		a := newActivity(time.UTC, start, start.AddDate(0, 0, len(test.plays)))
+		for i, plays := range test.plays {
+			// streaks count days played in either game
+			if i%2 == 0 {
+				a.Days[i].Ddr.Plays = plays
+			} else {
+				a.Days[i].Drs.Plays = plays
+			}
+		}
+		a.countStreaks()
+		if a.CurrentStreak != test.current || a.LongestStreak != test.longest {
+			t.Errorf("%s: expected streaks %d and %d but got %d and %d",
+				test.name, test.current, test.longest, a.CurrentStreak, a.LongestStreak)
+		}
+	}
+}
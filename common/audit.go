@@ -0,0 +1,70 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/utilities"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"github.com/golang/glog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AuditGet will retrieve audit log entries for the `user` query
+// parameter between `start` and `end` (inclusive, formatted as
+// 2006-01-02). Requires the read:audit scope.
+func AuditGet(rw http.ResponseWriter, r *http.Request) {
+	requiredScopes := []string{"read:audit"}
+	tokenMap := utilities.ProfileFromToken(r)
+
+	val, ok := tokenMap["sub"].(string)
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorJwtProfile)
+		return
+	}
+	val = strings.ToLower(val)
+	if !utilities.UserHasScopes(val, requiredScopes) {
+		glog.Warningf(
+			"user %s tried to read audit log, but did not have required scopes %s",
+			val,
+			strings.Join(requiredScopes, ","))
+		utilities.Audit(r, val, val, "read_audit", strings.ToLower(r.URL.Query().Get("user")), utilities.AuditOutcomeDenied)
+		utilities.RespondWithError(rw, bst_models.ErrorScope)
+		return
+	}
+
+	query := r.URL.Query()
+	tz, _ := time.LoadLocation("UTC")
+
+	end := time.Now().In(tz)
+	if endDateString := query.Get("end"); len(endDateString) > 0 {
+		e, err := time.ParseInLocation("2006-01-02", endDateString, tz)
+		if err != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorTimeParse)
+			return
+		}
+		end = e.AddDate(0, 0, 1)
+	}
+
+	start := end.AddDate(0, 0, -7)
+	if startDateString := query.Get("start"); len(startDateString) > 0 {
+		s, err := time.ParseInLocation("2006-01-02", startDateString, tz)
+		if err != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorTimeParse)
+			return
+		}
+		start = s
+	}
+
+	entries, errs := db.GetApiDb().RetrieveAuditEntries(strings.ToLower(query.Get("user")), start, end)
+	if utilities.PrintErrors("failed to retrieve audit entries:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorApiProfileDbRead)
+		return
+	}
+
+	bytes, _ := json.Marshal(entries)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/eagate/campaign"
+	"github.com/chris-sg/bst_api/models/api_models"
+	"github.com/chris-sg/bst_api/utilities"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"net/http"
+	"strings"
+)
+
+// campaignPlay adds the campaign name to a recorded play, as campaigns
+// are only stored by id.
+type campaignPlay struct {
+	api_models.CampaignPlay
+	CampaignName string `json:"campaign_name"`
+}
+
+// CampaignsGet will retrieve every campaign play made on behalf of the
+// requesting user, oldest first.
+func CampaignsGet(rw http.ResponseWriter, r *http.Request) {
+	tokenMap := utilities.ProfileFromToken(r)
+
+	val, ok := tokenMap["sub"].(string)
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorJwtProfile)
+		return
+	}
+	val = strings.ToLower(val)
+
+	plays, errs := db.GetApiDb().RetrieveCampaignPlays(val)
+	if utilities.PrintErrors("failed to retrieve campaign plays:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorApiProfileDbRead)
+		return
+	}
+
+	response := make([]campaignPlay, 0, len(plays))
+	for _, play := range plays {
+		c, _ := campaign.Find(play.Campaign)
+		response = append(response, campaignPlay{play, c.Name})
+	}
+
+	bytes, _ := json.Marshal(response)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
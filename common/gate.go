@@ -3,7 +3,9 @@ package common
 import (
 	"encoding/json"
 	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/eagate/campaign"
 	"github.com/chris-sg/bst_api/eagate/util"
+	"github.com/chris-sg/bst_api/games"
 	"github.com/chris-sg/bst_api/models/bst_models"
 	"github.com/chris-sg/bst_api/utilities"
 	bstServerModels "github.com/chris-sg/bst_server_models"
@@ -43,18 +45,30 @@ func Status(rw http.ResponseWriter, r *http.Request) {
 		status.Db = "bad"
 	}
 
-	statusBytes, _ := json.Marshal(status)
+	gameStatuses := make([]games.Status, 0)
+	for _, module := range games.Modules() {
+		gameStatuses = append(gameStatuses, module.Status())
+	}
+
+	statusBytes, _ := json.Marshal(apiStatus{status, gameStatuses})
 
 	rw.WriteHeader(http.StatusOK)
 	rw.Write(statusBytes)
 }
 
+// apiStatus adds the health of each game's eagate parsers to the
+// status, so a markup change shows up as a degraded parser before bad
+// data is saved.
+type apiStatus struct {
+	bstServerModels.ApiStatus
+	Games []games.Status `json:"games"`
+}
+
 // updateCachedDb will retrieve the current database status.
 // This allows us to confirm whether the connection has broken
 // or not.
 func updateCachedDb() {
-	db, err := db.GetDb()
-	if err != nil || db.DB().Ping() != nil {
+	if db.Ping() != nil {
 		cachedDb = false
 	} else {
 		cachedDb = true
@@ -69,6 +83,14 @@ func updateCachedGate() {
 	cachedGate = !util.IsMaintenanceMode(client)
 }
 
+// bstUser adds the campaigns a user has opted in to and their preferred
+// timezone, which the shared UserCache model does not yet carry.
+type bstUser struct {
+	bstServerModels.UserCache
+	Campaigns []string `json:"campaigns"`
+	Timezone  string   `json:"timezone"`
+}
+
 func Cache(rw http.ResponseWriter, r *http.Request) {
 	data := bstServerModels.UserCache{}
 
@@ -111,7 +133,7 @@ func Cache(rw http.ResponseWriter, r *http.Request) {
 	data.DdrAutoUpdate = profile.DdrAutoUpdate
 	data.DrsAutoUpdate = profile.DrsAutoUpdate
 
-	bytes, _ := json.Marshal(data)
+	bytes, _ := json.Marshal(bstUser{data, profile.CampaignIds(), profile.Timezone})
 	rw.WriteHeader(http.StatusOK)
 	_, _ = rw.Write(bytes)
 	return
@@ -124,6 +146,8 @@ func PutBstUser(rw http.ResponseWriter, r *http.Request) {
 		EventParticipation *bool `json:"event_participation;omit_empty"`
 		DdrAutoUpdate *bool `json:"ddr_update;omit_empty"`
 		DrsAutoUpdate *bool `json:"drs_update;omit_empty"`
+		Campaigns *[]string `json:"campaigns"`
+		Timezone *string `json:"timezone"`
 	}
 
 	tokenMap := utilities.ProfileFromToken(r)
@@ -165,6 +189,24 @@ func PutBstUser(rw http.ResponseWriter, r *http.Request) {
 	if data.DrsAutoUpdate != nil {
 		profile.DrsAutoUpdate = *data.DrsAutoUpdate
 	}
+	if data.Campaigns != nil {
+		for _, id := range *data.Campaigns {
+			if _, exists := campaign.Find(id); !exists {
+				glog.Warningf("user %s opted in to unknown campaign %s", user, id)
+				utilities.RespondWithError(rw, bstServerModels.ErrorBadBody)
+				return
+			}
+		}
+		profile.SetCampaignIds(*data.Campaigns)
+	}
+	if data.Timezone != nil {
+		if _, e := time.LoadLocation(*data.Timezone); e != nil {
+			glog.Warningf("user %s set unknown timezone %s", user, *data.Timezone)
+			utilities.RespondWithError(rw, bstServerModels.ErrorBadBody)
+			return
+		}
+		profile.Timezone = *data.Timezone
+	}
 
 	errs = apiDb.SetProfile(profile)
 	if utilities.PrintErrors("failed to set profile:", errs) {
@@ -183,7 +225,7 @@ func PutBstUser(rw http.ResponseWriter, r *http.Request) {
 		DrsAutoUpdate:      profile.DrsAutoUpdate,
 	}
 
-	bytes, _ := json.Marshal(userCache)
+	bytes, _ := json.Marshal(bstUser{userCache, profile.CampaignIds(), profile.Timezone})
 	rw.WriteHeader(http.StatusOK)
 	_, _ = rw.Write(bytes)
 	return
@@ -0,0 +1,202 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/chris-sg/bst_api/utilities"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// accountProfile is everything known about a single linked eagate
+// account. Ddr and Drs are nil if the account has not been loaded for
+// that game.
+type accountProfile struct {
+	EaGateUser  string      `json:"eagateuser"`
+	CookieValid bool        `json:"cookievalid"`
+	Ddr         *ddrProfile `json:"ddr"`
+	Drs         *drsProfile `json:"drs"`
+}
+
+// ddrProfile and drsProfile are the saved details of an account for a
+// game. LastUpdated is when eagate was last checked for the account,
+// whether or not anything had changed.
+type ddrProfile struct {
+	Details     ddrProfileDetails    `json:"details"`
+	Playcount   *ddrProfilePlaycount `json:"playcount"`
+	LastUpdated time.Time            `json:"lastupdated"`
+	AutoUpdate  bool                 `json:"autoupdate"`
+}
+
+type ddrProfileDetails struct {
+	Code        int    `json:"code"`
+	Name        string `json:"name"`
+	Prefecture  string `json:"prefecture"`
+	SingleRank  string `json:"singlerank"`
+	DoubleRank  string `json:"doublerank"`
+	Affiliation string `json:"affiliation"`
+}
+
+type ddrProfilePlaycount struct {
+	Playcount          int       `json:"playcount"`
+	LastPlayDate       time.Time `json:"lastplaydate"`
+	SinglePlaycount    int       `json:"singleplaycount"`
+	SingleLastPlayDate time.Time `json:"singlelastplaydate"`
+	DoublePlaycount    int       `json:"doubleplaycount"`
+	DoubleLastPlayDate time.Time `json:"doublelastplaydate"`
+}
+
+type drsProfile struct {
+	Details     drsProfileDetails                 `json:"details"`
+	Snapshot    *drs_models.PlayerProfileSnapshot `json:"snapshot"`
+	LastUpdated time.Time                         `json:"lastupdated"`
+	AutoUpdate  bool                              `json:"autoupdate"`
+}
+
+type drsProfileDetails struct {
+	Code int    `json:"code"`
+	Name string `json:"name"`
+}
+
+// ProfileGet will retrieve the ddr and drs profiles of every eagate
+// account linked to the requester in a single document.
+func ProfileGet(rw http.ResponseWriter, r *http.Request) {
+	tokenMap := utilities.ProfileFromToken(r)
+
+	val, ok := tokenMap["sub"].(string)
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorJwtProfile)
+		return
+	}
+	val = strings.ToLower(val)
+
+	usernames, err := RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	profile, errs := db.GetApiDb().RetrieveProfile(val)
+	if utilities.PrintErrors("failed to retrieve profile:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorApiProfileDbRead)
+		return
+	}
+
+	accounts := make([]accountProfile, 0)
+	for _, username := range usernames {
+		userModel, exists, errs := db.GetUserDb().RetrieveUserByUserId(username)
+		if utilities.PrintErrors("failed to retrieve eagate user:", errs) {
+			utilities.RespondWithError(rw, bst_models.ErrorReadWebUser)
+			return
+		}
+		if !exists {
+			continue
+		}
+		account := accountProfile{
+			EaGateUser:  userModel.Name,
+			CookieValid: len(userModel.Cookie) > 0 && userModel.Expiration >= time.Now().UnixNano()/1000,
+		}
+
+		account.Ddr, err = retrieveDdrProfile(username)
+		if !err.Equals(bst_models.ErrorOK) {
+			utilities.RespondWithError(rw, err)
+			return
+		}
+		if account.Ddr != nil {
+			account.Ddr.AutoUpdate = profile.DdrAutoUpdate
+		}
+
+		account.Drs, err = retrieveDrsProfile(username)
+		if !err.Equals(bst_models.ErrorOK) {
+			utilities.RespondWithError(rw, err)
+			return
+		}
+		if account.Drs != nil {
+			account.Drs.AutoUpdate = profile.DrsAutoUpdate
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	bytes, _ := json.Marshal(accounts)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+func retrieveDdrProfile(eaUser string) (profile *ddrProfile, err bst_models.Error) {
+	err = bst_models.ErrorOK
+
+	details, exists, errs := db.GetDdrDb().RetrievePlayerDetailsByEaGateUser(eaUser)
+	if !exists {
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve ddr details:", errs) {
+		err = bst_models.ErrorDdrPlayerInfoDbRead
+		return
+	}
+	profile = &ddrProfile{
+		Details: ddrProfileDetails{
+			Code:        details.Code,
+			Name:        details.Name,
+			Prefecture:  details.Prefecture,
+			SingleRank:  details.SingleRank,
+			DoubleRank:  details.DoubleRank,
+			Affiliation: details.Affiliation,
+		},
+		LastUpdated: details.RefreshedAt,
+	}
+
+	playcount, errs := db.GetDdrDb().RetrieveLatestPlaycountByPlayerCode(details.Code)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve ddr playcount:", errs) {
+		err = bst_models.ErrorDdrPlayerInfoDbRead
+		return
+	}
+	profile.Playcount = &ddrProfilePlaycount{
+		Playcount:          playcount.Playcount,
+		LastPlayDate:       playcount.LastPlayDate,
+		SinglePlaycount:    playcount.SinglePlaycount,
+		SingleLastPlayDate: playcount.SingleLastPlayDate,
+		DoublePlaycount:    playcount.DoublePlaycount,
+		DoubleLastPlayDate: playcount.DoubleLastPlayDate,
+	}
+	return
+}
+
+func retrieveDrsProfile(eaUser string) (profile *drsProfile, err bst_models.Error) {
+	err = bst_models.ErrorOK
+
+	details, errs := db.GetDrsDb().RetrievePlayerDetailsByEaGateUser(eaUser)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve drs details:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+	profile = &drsProfile{
+		Details: drsProfileDetails{
+			Code: details.Code,
+			Name: details.Name,
+		},
+		LastUpdated: details.RefreshedAt,
+	}
+
+	snapshot, errs := db.GetDrsDb().RetrieveRecentPlayerProfileSnapshot(details.Code)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve drs snapshot:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+	profile.Snapshot = &snapshot
+	return
+}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/chris-sg/bst_api/models/user_models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// requestForUser will make a request carrying an unsigned token for sub,
+// as the handlers only read the claims once the middleware has checked
+// the token.
+func requestForUser(sub string) *http.Request {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sub + `"}`))
+	r := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	r.Header.Set("Authorization", "Bearer e30."+claims+".signature")
+	return r
+}
+
+func TestProfileGetCookieValid(t *testing.T) {
+	db.OpenDbMemory()
+	web := "auth0|bst"
+	now := time.Now().UnixNano() / 1000
+	users := []user_models.User{
+		{Name: "valid", Cookie: "M573SSID=valid", Expiration: now + time.Hour.Microseconds()},
+		{Name: "expired", Cookie: "M573SSID=expired", Expiration: now - time.Hour.Microseconds()},
+		// a cleared cookie is not valid, whatever its expiration
+		{Name: "cleared", Expiration: now + time.Hour.Microseconds()},
+	}
+	for _, u := range users {
+		if errs := db.GetUserDb().UpdateUser(u); len(errs) > 0 {
+			t.Fatalf("failed to add user %s: %v", u.Name, errs)
+		}
+		if errs := db.GetUserDb().SetWebUserForEaUser(u.Name, web); len(errs) > 0 {
+			t.Fatalf("failed to link user %s: %v", u.Name, errs)
+		}
+	}
+	if errs := db.GetApiDb().SetProfile(bst_models.BstProfile{User: web, DrsAutoUpdate: true}); len(errs) > 0 {
+		t.Fatalf("failed to add profile: %v", errs)
+	}
+	eaUser := "valid"
+	if errs := db.GetDrsDb().AddPlayerDetails(drs_models.PlayerDetails{Code: 1, Name: "DANCER", EaGateUser: &eaUser}); len(errs) > 0 {
+		t.Fatalf("failed to add drs details: %v", errs)
+	}
+
+	rw := httptest.NewRecorder()
+	ProfileGet(rw, requestForUser("AUTH0|BST"))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected status 200 but got %d: %s", rw.Code, rw.Body.String())
+	}
+	var accounts []accountProfile
+	if err := json.Unmarshal(rw.Body.Bytes(), &accounts); err != nil {
+		t.Fatalf("failed to decode profile: %s", err.Error())
+	}
+	if len(accounts) != len(users) {
+		t.Fatalf("expected %d accounts but got %d", len(users), len(accounts))
+	}
+
+	expected := map[string]bool{"valid": true, "expired": false, "cleared": false}
+	for _, account := range accounts {
+		if account.CookieValid != expected[account.EaGateUser] {
+			t.Errorf("expected cookievalid %t for %s but got %t", expected[account.EaGateUser], account.EaGateUser, account.CookieValid)
+		}
+		if account.Ddr != nil {
+			t.Errorf("expected no ddr profile for %s", account.EaGateUser)
+		}
+		if account.EaGateUser != "valid" {
+			if account.Drs != nil {
+				t.Errorf("expected no drs profile for %s", account.EaGateUser)
+			}
+			continue
+		}
+		if account.Drs == nil || account.Drs.Details.Name != "DANCER" || !account.Drs.AutoUpdate || account.Drs.Snapshot != nil {
+			t.Errorf("expected a drs profile without a snapshot for valid, got %+v", account.Drs)
+		}
+	}
+}
@@ -24,6 +24,14 @@ func AttachGeneralRoutes(r *mux.Router) {
 func CreateUserRouter() *mux.Router {
 	userRouter := mux.NewRouter().PathPrefix("/user").Subrouter()
 
+	userRouter.Path("").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(UserDelete)))).Methods(http.MethodDelete)
+	userRouter.Path("/export").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(ExportGet)))).Methods(http.MethodGet)
+
+	userRouter.Path("/campaigns").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(CampaignsGet)))).Methods(http.MethodGet)
+
 	userRouter.Path("/login").Handler(utilities.GetProtectionMiddleware().With(
 		negroni.Wrap(http.HandlerFunc(LoginGet)))).Methods(http.MethodGet)
 	userRouter.Path("/login").Handler(utilities.GetProtectionMiddleware().With(
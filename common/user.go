@@ -97,7 +97,12 @@ func LoginPost(rw http.ResponseWriter, r *http.Request) {
 	client := util.GenerateClient()
 	defer client.UpdateCookie()
 
-	err := user.GetCookieFromEaGate(loginRequest.Username, loginRequest.Password, loginRequest.OneTimePassword, client)
+	err := bst_models.ErrorOK
+	defer func() {
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionLogin, loginRequest.Username, utilities.AuditOutcome(err))
+	}()
+
+	err = user.GetCookieFromEaGate(loginRequest.Username, loginRequest.Password, loginRequest.OneTimePassword, client)
 	if !err.Equals(bst_models.ErrorOK) {
 		utilities.RespondWithError(rw, err)
 		return
@@ -121,7 +126,8 @@ func LoginPost(rw http.ResponseWriter, r *http.Request) {
 
 	errs := db.GetUserDb().UpdateUser(userModel)
 	if utilities.PrintErrors("could not update user:", errs) {
-		utilities.RespondWithError(rw, bst_models.ErrorWriteWebUser)
+		err = bst_models.ErrorWriteWebUser
+		utilities.RespondWithError(rw, err)
 		return
 	}
 
@@ -152,9 +158,15 @@ func LogoutPost(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	outcome := bst_models.ErrorOK
+	defer func() {
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionLogout, logoutRequest.Username, utilities.AuditOutcome(outcome))
+	}()
+
 	user, exists, errs := db.GetUserDb().RetrieveUserByUserId(logoutRequest.Username)
 	if len(errs) > 0 {
-		utilities.RespondWithError(rw, bst_models.ErrorReadWebUser)
+		outcome = bst_models.ErrorReadWebUser
+		utilities.RespondWithError(rw, outcome)
 		return
 	}
 	if !exists {
@@ -164,7 +176,8 @@ func LogoutPost(rw http.ResponseWriter, r *http.Request) {
 	if user.WebUser == val {
 		errs := db.GetUserDb().SetWebUserForEaUser(user.Name, "")
 		if len(errs) > 0 {
-			utilities.RespondWithError(rw, bst_models.ErrorWriteWebUser)
+			outcome = bst_models.ErrorWriteWebUser
+			utilities.RespondWithError(rw, outcome)
 			return
 		}
 
@@ -172,7 +185,8 @@ func LogoutPost(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utilities.RespondWithError(rw, bst_models.ErrorNoEaUser)
+	outcome = bst_models.ErrorNoEaUser
+	utilities.RespondWithError(rw, outcome)
 	return
 }
 
@@ -191,11 +205,13 @@ func ForceUpdatePost(rw http.ResponseWriter, r *http.Request) {
 			"user %s tried to update users, but did not have required scopes %s",
 			val,
 			strings.Join(requiredScopes, ","))
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionForceUpdate, "", utilities.AuditOutcomeDenied)
 		utilities.RespondWithError(rw, bst_models.ErrorScope)
 		return
 	}
 
 	user.RunUpdatesOnAllEaUsers()
+	utilities.AuditForToken(r, tokenMap, utilities.AuditActionForceUpdate, "", utilities.AuditOutcomeSuccess)
 
 	utilities.RespondWithError(rw, bst_models.ErrorOK)
 	return
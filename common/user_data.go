@@ -0,0 +1,310 @@
+package common
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/chris-sg/bst_api/models/user_models"
+	"github.com/chris-sg/bst_api/utilities"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"github.com/golang/glog"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// exportFile is a single json document to be written to the export
+// archive.
+type exportFile struct {
+	name string
+	data interface{}
+}
+
+// ExportGet will stream a zip archive containing every row stored for
+// the requesting user: their bst profile, linked eagate accounts (with
+// cookies removed) and all ddr and drs data for those accounts.
+func ExportGet(rw http.ResponseWriter, r *http.Request) {
+	tokenMap := utilities.ProfileFromToken(r)
+
+	val, ok := tokenMap["sub"].(string)
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorJwtProfile)
+		return
+	}
+	val = strings.ToLower(val)
+
+	files, err := collectExportFiles(val)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/zip")
+	rw.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"bst_export_%s.zip\"", time.Now().UTC().Format("20060102")))
+	rw.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(rw)
+	for _, file := range files {
+		w, e := archive.Create(file.name)
+		if e != nil {
+			glog.Errorf("failed to add %s to export: %s\n", file.name, e.Error())
+			break
+		}
+		bytes, e := json.MarshalIndent(file.data, "", "  ")
+		if e != nil {
+			glog.Errorf("failed to encode %s for export: %s\n", file.name, e.Error())
+			break
+		}
+		_, _ = w.Write(bytes)
+	}
+	if e := archive.Close(); e != nil {
+		glog.Errorf("failed to finalise export: %s\n", e.Error())
+	}
+	utilities.AuditForToken(r, tokenMap, utilities.AuditActionExport, val, utilities.AuditOutcomeSuccess)
+}
+
+// collectExportFiles reads everything needed for an export up front,
+// so that any failure can still be reported before the archive begins
+// streaming.
+func collectExportFiles(webUser string) (files []exportFile, err bst_models.Error) {
+	err = bst_models.ErrorOK
+
+	profile, errs := db.GetApiDb().RetrieveProfile(webUser)
+	if utilities.PrintErrors("failed to retrieve profile for export:", errs) {
+		err = bst_models.ErrorApiProfileDbRead
+		return
+	}
+	files = append(files, exportFile{"profile.json", profile})
+
+	campaignPlays, errs := db.GetApiDb().RetrieveCampaignPlays(webUser)
+	if utilities.PrintErrors("failed to retrieve campaign plays for export:", errs) {
+		err = bst_models.ErrorApiProfileDbRead
+		return
+	}
+	files = append(files, exportFile{"campaign_plays.json", campaignPlays})
+
+	usernames, errs := db.GetUserDb().RetrieveUsernamesByWebId(webUser)
+	if utilities.PrintErrors("failed to retrieve eagate users for export:", errs) {
+		err = bst_models.ErrorReadWebUser
+		return
+	}
+
+	eaUsers := make([]user_models.User, 0)
+	for _, username := range usernames {
+		eaUser, exists, errs := db.GetUserDb().RetrieveUserByUserId(username)
+		if utilities.PrintErrors("failed to retrieve eagate user for export:", errs) {
+			err = bst_models.ErrorReadWebUser
+			return
+		}
+		if !exists {
+			continue
+		}
+		eaUser.Cookie = ""
+		eaUser.Expiration = 0
+		eaUsers = append(eaUsers, eaUser)
+
+		ddrFiles, e := collectDdrExportFiles(username)
+		if !e.Equals(bst_models.ErrorOK) {
+			err = e
+			return
+		}
+		files = append(files, ddrFiles...)
+
+		drsFiles, e := collectDrsExportFiles(username)
+		if !e.Equals(bst_models.ErrorOK) {
+			err = e
+			return
+		}
+		files = append(files, drsFiles...)
+	}
+	files = append(files, exportFile{"eagate_users.json", eaUsers})
+	return
+}
+
+func collectDdrExportFiles(eaUser string) (files []exportFile, err bst_models.Error) {
+	err = bst_models.ErrorOK
+
+	details, exists, errs := db.GetDdrDb().RetrievePlayerDetailsByEaGateUser(eaUser)
+	if !exists {
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve ddr details for export:", errs) {
+		err = bst_models.ErrorDdrPlayerInfoDbRead
+		return
+	}
+	prefix := fmt.Sprintf("ddr/%d/", details.Code)
+	files = append(files, exportFile{prefix + "details.json", details})
+
+	playcounts, errs := db.GetDdrDb().RetrievePlaycountsByPlayerCode(details.Code)
+	if utilities.PrintErrors("failed to retrieve ddr playcounts for export:", errs) {
+		err = bst_models.ErrorDdrPlayerInfoDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "playcounts.json", playcounts})
+
+	statistics, errs := db.GetDdrDb().RetrieveSongStatisticsByPlayerCode(details.Code, nil)
+	if utilities.PrintErrors("failed to retrieve ddr statistics for export:", errs) {
+		err = bst_models.ErrorDdrStatsDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "statistics.json", statistics})
+
+	scores, errs := db.GetDdrDb().RetrieveScoresByPlayerCode(details.Code)
+	if utilities.PrintErrors("failed to retrieve ddr scores for export:", errs) {
+		err = bst_models.ErrorDdrStatsDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "scores.json", scores})
+
+	workoutData, errs := db.GetDdrDb().RetrieveWorkoutDataByPlayerCode(details.Code)
+	if utilities.PrintErrors("failed to retrieve ddr workout data for export:", errs) {
+		err = bst_models.ErrorDdrStatsDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "workout.json", workoutData})
+	return
+}
+
+func collectDrsExportFiles(eaUser string) (files []exportFile, err bst_models.Error) {
+	err = bst_models.ErrorOK
+
+	details, errs := db.GetDrsDb().RetrievePlayerDetailsByEaGateUser(eaUser)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve drs details for export:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+	prefix := fmt.Sprintf("drs/%d/", details.Code)
+	files = append(files, exportFile{prefix + "details.json", details})
+
+	snapshots, errs := db.GetDrsDb().RetrievePlayerProfileSnapshots(details.Code, time.Time{}, time.Now())
+	if utilities.PrintErrors("failed to retrieve drs snapshots for export:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "snapshots.json", snapshots})
+
+	statistics, errs := db.GetDrsDb().RetrieveSongStatisticsByPlayerCode(details.Code)
+	if utilities.PrintErrors("failed to retrieve drs statistics for export:", errs) {
+		err = bst_models.ErrorDrsSongDataDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "statistics.json", statistics})
+
+	scores, errs := db.GetDrsDb().RetrievePlayerScores(details.Code)
+	if utilities.PrintErrors("failed to retrieve drs scores for export:", errs) {
+		err = bst_models.ErrorDrsSongDataDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "scores.json", scores})
+
+	unlocks, errs := db.GetDrsDb().RetrievePlayerUnlocks(details.Code)
+	if utilities.PrintErrors("failed to retrieve drs unlocks for export:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "unlocks.json", unlocks})
+
+	archivedVideos, errs := db.GetDrsDb().RetrieveArchivedVideos(details.Code)
+	if utilities.PrintErrors("failed to retrieve drs archived videos for export:", errs) {
+		err = bst_models.ErrorDrsSongDataDbRead
+		return
+	}
+	files = append(files, exportFile{prefix + "archived_videos.json", archivedVideos})
+	return
+}
+
+// UserDelete will remove the requesting user and everything linked to
+// them. Audit log entries are retained with the user replaced by a
+// pseudonym.
+func UserDelete(rw http.ResponseWriter, r *http.Request) {
+	tokenMap := utilities.ProfileFromToken(r)
+
+	val, ok := tokenMap["sub"].(string)
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorJwtProfile)
+		return
+	}
+	val = strings.ToLower(val)
+
+	archivedVideos, err := retrieveArchivedVideosForWebUser(val)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	pseudonym, e := utilities.AuditPseudonym()
+	if e != nil {
+		glog.Errorf("failed to generate audit pseudonym: %s\n", e.Error())
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionDelete, val, utilities.AuditOutcome(bst_models.ErrorWriteWebUser))
+		utilities.RespondWithError(rw, bst_models.ErrorWriteWebUser)
+		return
+	}
+	errs := db.GetUserDb().DeleteWebUser(val, pseudonym)
+	if utilities.PrintErrors("failed to delete user:", errs) {
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionDelete, pseudonym, utilities.AuditOutcome(bst_models.ErrorWriteWebUser))
+		utilities.RespondWithError(rw, bst_models.ErrorWriteWebUser)
+		return
+	}
+	utilities.RemoveArchivedVideoFiles(deletedArchivedVideos(archivedVideos))
+
+	actor, _ := utilities.ActorsFromToken(tokenMap)
+	if strings.ToLower(actor) == val {
+		actor = pseudonym
+	}
+	utilities.Audit(r, actor, pseudonym, utilities.AuditActionDelete, pseudonym, utilities.AuditOutcomeSuccess)
+
+	utilities.RespondWithError(rw, bst_models.ErrorOK)
+	return
+}
+
+// deletedArchivedVideos returns those of videos whose rows were deleted.
+// A video shared with another player is kept for them, so its file must
+// stay. Videos which cannot be checked are kept, as a stray file is
+// better than a missing one.
+func deletedArchivedVideos(videos []drs_models.ArchivedVideo) (deleted []drs_models.ArchivedVideo) {
+	for _, video := range videos {
+		_, errs := db.GetDrsDb().RetrieveArchivedVideo(video.Id)
+		if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+			deleted = append(deleted, video)
+			continue
+		}
+		utilities.PrintErrors("failed to check archived video:", errs)
+	}
+	return
+}
+
+// retrieveArchivedVideosForWebUser finds the archived videos of every
+// drs player linked to the web user, so their files can be removed
+// once the rows are deleted.
+func retrieveArchivedVideosForWebUser(webUser string) (videos []drs_models.ArchivedVideo, err bst_models.Error) {
+	err = bst_models.ErrorOK
+	usernames, errs := db.GetUserDb().RetrieveUsernamesByWebId(webUser)
+	if utilities.PrintErrors("failed to retrieve eagate users:", errs) {
+		err = bst_models.ErrorReadWebUser
+		return
+	}
+	for _, username := range usernames {
+		details, errs := db.GetDrsDb().RetrievePlayerDetailsByEaGateUser(username)
+		if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+			continue
+		}
+		if utilities.PrintErrors("failed to retrieve drs details:", errs) {
+			err = bst_models.ErrorDrsPlayerInfoDbRead
+			return
+		}
+		playerVideos, errs := db.GetDrsDb().RetrieveArchivedVideos(details.Code)
+		if utilities.PrintErrors("failed to retrieve drs archived videos:", errs) {
+			err = bst_models.ErrorDrsSongDataDbRead
+			return
+		}
+		videos = append(videos, playerVideos...)
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package api_db
+
+import (
+	"fmt"
+	"github.com/chris-sg/bst_api/db/db_memory"
+	"github.com/chris-sg/bst_api/models/api_models"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	"sort"
+	"time"
+)
+
+func CreateApiDbCommunicationMemory(store *db_memory.Store) ApiDbCommunicationMemory {
+	return ApiDbCommunicationMemory{store}
+}
+
+// ApiDbCommunicationMemory keeps all data in a db_memory.Store, with
+// the same behaviour as the postgres queries.
+type ApiDbCommunicationMemory struct {
+	store *db_memory.Store
+}
+
+func (dbcomm ApiDbCommunicationMemory) SetProfile(profile bst_models.BstProfile) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for i, existing := range tables.Profiles {
+			if profile.UserId != 0 && existing.UserId == profile.UserId {
+				tables.Profiles[i] = profile
+				return
+			}
+		}
+		for _, existing := range tables.Profiles {
+			if existing.User == profile.User {
+				errs = append(errs, fmt.Errorf("duplicate key value violates unique constraint on user_sub %s", profile.User))
+				return
+			}
+		}
+		if profile.UserId == 0 {
+			tables.LastProfileId++
+			profile.UserId = tables.LastProfileId
+		} else if profile.UserId > tables.LastProfileId {
+			tables.LastProfileId = profile.UserId
+		}
+		tables.Profiles = append(tables.Profiles, profile)
+	})
+	return
+}
+
+func (dbcomm ApiDbCommunicationMemory) RetrieveProfile(user string) (profile bst_models.BstProfile, errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, p := range tables.Profiles {
+			if p.User == user {
+				profile = p
+				return
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm ApiDbCommunicationMemory) RetrieveUpdateableProfiles() (profiles []bst_models.BstProfile, errs []error) {
+	profiles = make([]bst_models.BstProfile, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, p := range tables.Profiles {
+			for _, u := range tables.Users {
+				if u.WebUser == p.User && u.Cookie != "" {
+					profiles = append(profiles, p)
+				}
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm ApiDbCommunicationMemory) AddAuditEntry(entry api_models.AuditEntry) (errs []error) {
+	entry.Time = db_memory.Timestamp(entry.Time)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		tables.LastAuditId++
+		entry.Id = tables.LastAuditId
+		tables.AuditEntries = append(tables.AuditEntries, entry)
+	})
+	return
+}
+
+func (dbcomm ApiDbCommunicationMemory) RetrieveAuditEntries(user string, start time.Time, end time.Time) (entries []api_models.AuditEntry, errs []error) {
+	entries = make([]api_models.AuditEntry, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, entry := range tables.AuditEntries {
+			if !db_memory.Between(entry.Time, start, end) {
+				continue
+			}
+			if len(user) > 0 && entry.Actor != user && entry.EffectiveUser != user {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return
+}
+
+func (dbcomm ApiDbCommunicationMemory) AddCampaignPlay(play api_models.CampaignPlay) (errs []error) {
+	play.Time = db_memory.Timestamp(play.Time)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		tables.LastCampaignPlayId++
+		play.Id = tables.LastCampaignPlayId
+		tables.CampaignPlays = append(tables.CampaignPlays, play)
+	})
+	return
+}
+
+func (dbcomm ApiDbCommunicationMemory) RetrieveCampaignPlays(user string) (plays []api_models.CampaignPlay, errs []error) {
+	plays = make([]api_models.CampaignPlay, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, play := range tables.CampaignPlays {
+			if play.WebUser == user {
+				plays = append(plays, play)
+			}
+		}
+	})
+	sort.SliceStable(plays, func(i, j int) bool {
+		return plays[i].Time.Before(plays[j].Time)
+	})
+	return
+}
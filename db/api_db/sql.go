@@ -2,6 +2,7 @@ package api_db
 
 import (
 	"fmt"
+	"github.com/chris-sg/bst_api/db/db_dialect"
 	"github.com/chris-sg/bst_api/models/api_models"
 	"github.com/chris-sg/bst_api/models/bst_models"
 	"github.com/golang/glog"
@@ -15,6 +16,11 @@ type ApiDbCommunication interface {
 	RetrieveProfile(user string) (profile bst_models.BstProfile, errs []error)
 	RetrieveUpdateableProfiles() (profiles []bst_models.BstProfile, errs []error)
 
+	AddAuditEntry(entry api_models.AuditEntry) (errs []error)
+	RetrieveAuditEntries(user string, start time.Time, end time.Time) (entries []api_models.AuditEntry, errs []error)
+
+	AddCampaignPlay(play api_models.CampaignPlay) (errs []error)
+	RetrieveCampaignPlays(user string) (plays []api_models.CampaignPlay, errs []error)
 }
 
 func CreateApiDbCommunicationPostgres(db *gorm.DB) ApiDbCommunicationPostgres {
@@ -54,9 +60,9 @@ func (dbcomm ApiDbCommunicationPostgres) RetrieveProfile(user string) (profile b
 }
 
 func (dbcomm ApiDbCommunicationPostgres) RetrieveUpdateableProfiles() (profiles []bst_models.BstProfile, errs []error) {
-	resultDb := dbcomm.db.Table("public.\"bstProfile\" p").
+	resultDb := dbcomm.db.Table(db_dialect.Table(dbcomm.db, "bstProfile") + " p").
 		Select("p.*").
-		Joins("inner join public.\"eaGateUser\" e on " +
+		Joins("inner join " + db_dialect.Table(dbcomm.db, "eaGateUser") + " e on " +
 			"p.user_sub = e.web_user and " +
 			"e.login_cookie <> ''").
 			//"e.login_cookie <> '' and " +
@@ -71,6 +77,66 @@ func (dbcomm ApiDbCommunicationPostgres) RetrieveUpdateableProfiles() (profiles
 	return
 }
 
+// AddAuditEntry will append an entry to the audit log. Entries are
+// never updated once written.
+func (dbcomm ApiDbCommunicationPostgres) AddAuditEntry(entry api_models.AuditEntry) (errs []error) {
+	entry.Id = 0
+	resultDb := dbcomm.db.Create(&entry)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// RetrieveAuditEntries will return all audit entries between start and
+// end where the user was either the actor or the effective user. An
+// empty user will return entries for all users.
+func (dbcomm ApiDbCommunicationPostgres) RetrieveAuditEntries(user string, start time.Time, end time.Time) (entries []api_models.AuditEntry, errs []error) {
+	glog.Infof("RetrieveAuditEntries for user %s range %s-%s\n", user, start.String(), end.String())
+	resultDb := dbcomm.db.Model(&api_models.AuditEntry{}).
+		Where("occurred_at between ? and ?", start, end)
+	if len(user) > 0 {
+		resultDb = resultDb.Where("actor = ? OR effective_user = ?", user, user)
+	}
+	resultDb = resultDb.Order("occurred_at").Scan(&entries)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// AddCampaignPlay will record a campaign being played for a user.
+func (dbcomm ApiDbCommunicationPostgres) AddCampaignPlay(play api_models.CampaignPlay) (errs []error) {
+	play.Id = 0
+	resultDb := dbcomm.db.Create(&play)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// RetrieveCampaignPlays will return every campaign play for the user,
+// oldest first.
+func (dbcomm ApiDbCommunicationPostgres) RetrieveCampaignPlays(user string) (plays []api_models.CampaignPlay, errs []error) {
+	glog.Infof("RetrieveCampaignPlays for user %s\n", user)
+	plays = make([]api_models.CampaignPlay, 0)
+	resultDb := dbcomm.db.Model(&api_models.CampaignPlay{}).
+		Where("user_sub = ?", user).
+		Order("played_at, id").
+		Scan(&plays)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
 
 // AddAutomaticJob will create a new job.
 func AddAutomaticJob(db *gorm.DB, job api_models.AutomaticJob) error {
@@ -0,0 +1,272 @@
+package db_builder
+
+import "time"
+
+// The types below pin the schema created by the baseline migration to
+// the models as they were when migrations were introduced. Later
+// columns belong to later migrations, so they must not be added here.
+
+type baselineUser struct {
+	Name           string `gorm:"column:account_name;primary_key"`
+	NickName       string `gorm:"column:community_name"`
+	Cookie         string `gorm:"column:login_cookie"`
+	Expiration     int64  `gorm:"column:cookie_expiration"`
+	EaSubscription string `gorm:"column:subscription"`
+	WebUser        string `gorm:"column:web_user"`
+}
+
+func (baselineUser) TableName() string {
+	return "eaGateUser"
+}
+
+type baselineAutomaticJob struct {
+	JobName    string        `gorm:"column:job_name;primary_key"`
+	Action     string        `gorm:"column:action"`
+	Frequency  time.Duration `gorm:"column:frequency"`
+	LastRun    time.Time     `gorm:"column:last_run"`
+	NextRun    time.Time     `gorm:"column:next_run"`
+	Parameters string        `gorm:"column:parameters"`
+	Count      uint64        `gorm:"column:count"`
+	Enabled    bool          `gorm:"column:enabled"`
+}
+
+func (baselineAutomaticJob) TableName() string {
+	return "automatic_jobs"
+}
+
+type baselineAuditEntry struct {
+	Id            int       `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	Time          time.Time `gorm:"column:occurred_at;index"`
+	Actor         string    `gorm:"column:actor;index"`
+	EffectiveUser string    `gorm:"column:effective_user;index"`
+	Action        string    `gorm:"column:action"`
+	Target        string    `gorm:"column:target"`
+	RequestId     string    `gorm:"column:request_id"`
+	Outcome       string    `gorm:"column:outcome"`
+}
+
+func (baselineAuditEntry) TableName() string {
+	return "auditLog"
+}
+
+type baselineProfile struct {
+	UserId             int    `gorm:"column:user_id;primary_key"`
+	User               string `gorm:"column:user_sub;unique"`
+	Nickname           string `gorm:"column:nickname"`
+	Public             bool   `gorm:"column:public"`
+	EventParticipation bool   `gorm:"column:event_participation"`
+	DdrAutoUpdate      bool   `gorm:"column:ddr_auto_update"`
+	DrsAutoUpdate      bool   `gorm:"column:drs_auto_update"`
+}
+
+func (baselineProfile) TableName() string {
+	return "bstProfile"
+}
+
+type baselineDdrSong struct {
+	Id     string `gorm:"column:id;primary_key"`
+	Name   string `gorm:"column:name"`
+	Artist string `gorm:"column:artist"`
+	Image  string `gorm:"column:image"`
+}
+
+func (baselineDdrSong) TableName() string {
+	return "ddrSongs"
+}
+
+type baselineDdrSongDifficulty struct {
+	SongId          string `gorm:"column:song_id;primary_key"`
+	Mode            string `gorm:"column:mode;primary_key"`
+	Difficulty      string `gorm:"column:difficulty;primary_key"`
+	DifficultyValue int16  `gorm:"column:difficulty_value"`
+}
+
+func (baselineDdrSongDifficulty) TableName() string {
+	return "ddrSongDifficulties"
+}
+
+type baselineDdrPlayerDetails struct {
+	Code        int     `gorm:"column:code;primary_key"`
+	Name        string  `gorm:"column:name"`
+	Prefecture  string  `gorm:"column:location"`
+	SingleRank  string  `gorm:"column:single_rank"`
+	DoubleRank  string  `gorm:"column:double_rank"`
+	Affiliation string  `gorm:"column:affiliation"`
+	EaGateUser  *string `gorm:"column:eagate_user"`
+}
+
+func (baselineDdrPlayerDetails) TableName() string {
+	return "ddrPlayerDetails"
+}
+
+type baselineDdrPlaycount struct {
+	Playcount          int       `gorm:"column:playcount"`
+	LastPlayDate       time.Time `gorm:"column:last_play_date;primary_key"`
+	SinglePlaycount    int       `gorm:"column:single_playcount"`
+	SingleLastPlayDate time.Time `gorm:"column:last_single_play_date"`
+	DoublePlaycount    int       `gorm:"column:double_playcount"`
+	DoubleLastPlayDate time.Time `gorm:"column:last_double_play_date"`
+	PlayerCode         int       `gorm:"column:player_code;primary_key;auto_increment:false"`
+}
+
+func (baselineDdrPlaycount) TableName() string {
+	return "ddrPlaycount"
+}
+
+type baselineDdrScore struct {
+	Score       int       `gorm:"column:score"`
+	ClearStatus bool      `gorm:"column:cleared"`
+	TimePlayed  time.Time `gorm:"column:time_played;primary_key"`
+	SongId      string    `gorm:"column:song_id;primary_key"`
+	Mode        string    `gorm:"column:mode;primary_key"`
+	Difficulty  string    `gorm:"column:difficulty;primary_key"`
+	PlayerCode  int       `gorm:"column:player_code;primary_key;auto_increment:false"`
+}
+
+func (baselineDdrScore) TableName() string {
+	return "ddrScores"
+}
+
+type baselineDdrSongStatistics struct {
+	BestScore  int       `gorm:"column:score_record"`
+	Lamp       string    `gorm:"column:clear_lamp"`
+	Rank       string    `gorm:"column:rank"`
+	PlayCount  int       `gorm:"column:playcount"`
+	ClearCount int       `gorm:"column:clearcount"`
+	MaxCombo   int       `gorm:"column:maxcombo"`
+	LastPlayed time.Time `gorm:"column:lastplayed"`
+	SongId     string    `gorm:"column:song_id;primary_key"`
+	Mode       string    `gorm:"column:mode;primary_key"`
+	Difficulty string    `gorm:"column:difficulty;primary_key"`
+	PlayerCode int       `gorm:"column:player_code;primary_key;auto_increment:false"`
+}
+
+func (baselineDdrSongStatistics) TableName() string {
+	return "ddrSongStatistics"
+}
+
+type baselineDdrWorkoutData struct {
+	Date       time.Time `gorm:"column:date;primary_key"`
+	PlayCount  int       `gorm:"column:playcount"`
+	Kcal       float32   `gorm:"column:kcal"`
+	PlayerCode int       `gorm:"column:player_code;primary_key;auto_increment:false"`
+}
+
+func (baselineDdrWorkoutData) TableName() string {
+	return "ddrWorkoutData"
+}
+
+type baselineDrsSong struct {
+	SongId         string `gorm:"column:song_id;primary_key"`
+	SongName       string `gorm:"column:name"`
+	ArtistName     string `gorm:"column:artist"`
+	MaxBpm         int    `gorm:"column:max_bpm"`
+	MinBpm         int    `gorm:"column:min_bpm"`
+	LimitationType int    `gorm:"column:limitation_type"`
+	Genre          int    `gorm:"column:genre"`
+	VideoFlags     int    `gorm:"column:video_flags"`
+	License        string `gorm:"column:license"`
+}
+
+func (baselineDrsSong) TableName() string {
+	return "drsSongs"
+}
+
+type baselineDrsDifficulty struct {
+	Mode       string `gorm:"column:mode;primary_key"`
+	Difficulty string `gorm:"column:difficulty;primary_key"`
+	Level      int    `gorm:"column:level"`
+	SongId     string `gorm:"column:song_id;primary_key"`
+}
+
+func (baselineDrsDifficulty) TableName() string {
+	return "drsDifficulties"
+}
+
+type baselineDrsPlayerDetails struct {
+	Code       int     `gorm:"column:code;primary_key"`
+	Name       string  `gorm:"column:name"`
+	EaGateUser *string `gorm:"column:eagate_user"`
+}
+
+func (baselineDrsPlayerDetails) TableName() string {
+	return "drsPlayerDetails"
+}
+
+type baselineDrsPlayerProfileSnapshot struct {
+	PlayCount   int       `gorm:"column:play_count;primary_key;auto_increment:false"`
+	PlaySeconds int       `gorm:"column:play_seconds"`
+	TotalStars  int       `gorm:"column:total_stars"`
+	UsedStars   int       `gorm:"column:used_stars"`
+	LastPlayed  time.Time `gorm:"column:last_played"`
+	PlayerCode  int       `gorm:"column:player_code;primary_key;auto_increment:false"`
+}
+
+func (baselineDrsPlayerProfileSnapshot) TableName() string {
+	return "drsPlayerProfileSnapshots"
+}
+
+type baselineDrsPlayerSongStats struct {
+	BestScore         int       `gorm:"column:best_score"`
+	Combo             int       `gorm:"column:combo"`
+	PlayCount         int       `gorm:"column:play_count"`
+	Param             int       `gorm:"column:param"`
+	BestScoreDateTime time.Time `gorm:"column:best_score_time"`
+	LastPlayDateTime  time.Time `gorm:"column:last_play_time"`
+
+	P1Code     int `gorm:"column:p1_code"`
+	P1Score    int `gorm:"column:p1_score"`
+	P1Perfects int `gorm:"column:p1_perfects"`
+	P1Greats   int `gorm:"column:p1_greats"`
+	P1Goods    int `gorm:"column:p1_goods"`
+	P1Bads     int `gorm:"column:p1_bads"`
+
+	P2Code     *int `gorm:"column:p2_code"`
+	P2Score    *int `gorm:"column:p2_score"`
+	P2Perfects *int `gorm:"column:p2_perfects"`
+	P2Greats   *int `gorm:"column:p2_greats"`
+	P2Goods    *int `gorm:"column:p2_goods"`
+	P2Bads     *int `gorm:"column:p2_bads"`
+
+	PlayerCode int    `gorm:"column:player_code;primary_key;auto_increment:false"`
+	SongId     string `gorm:"column:song_id;primary_key"`
+	Mode       string `gorm:"column:mode;primary_key"`
+	Difficulty string `gorm:"column:difficulty;primary_key"`
+}
+
+func (baselineDrsPlayerSongStats) TableName() string {
+	return "drsPlayerSongStats"
+}
+
+type baselineDrsPlayerScore struct {
+	Shop     string    `gorm:"column:shop"`
+	Score    int       `gorm:"column:score"`
+	MaxCombo int       `gorm:"column:max_combo"`
+	Param    int       `gorm:"column:param"`
+	PlayTime time.Time `gorm:"column:play_time"`
+
+	P1Code     int `gorm:"column:p1_code"`
+	P1Score    int `gorm:"column:p1_score"`
+	P1Perfects int `gorm:"column:p1_perfects"`
+	P1Greats   int `gorm:"column:p1_greats"`
+	P1Goods    int `gorm:"column:p1_goods"`
+	P1Bads     int `gorm:"column:p1_bads"`
+
+	P2Code     *int `gorm:"column:p2_code"`
+	P2Score    *int `gorm:"column:p2_score"`
+	P2Perfects *int `gorm:"column:p2_perfects"`
+	P2Greats   *int `gorm:"column:p2_greats"`
+	P2Goods    *int `gorm:"column:p2_goods"`
+	P2Bads     *int `gorm:"column:p2_bads"`
+
+	VideoUrl *string `gorm:"column:video_url"`
+
+	PlayerCode int    `gorm:"column:player_code;primary_key;auto_increment:false"`
+	SongId     string `gorm:"column:song_id;primary_key"`
+	Mode       string `gorm:"column:mode;primary_key"`
+	Difficulty string `gorm:"column:difficulty;primary_key"`
+}
+
+func (baselineDrsPlayerScore) TableName() string {
+	return "drsPlayerScores"
+}
@@ -1,27 +1,18 @@
 package db_builder
 
 import (
+	"fmt"
 	"github.com/chris-sg/bst_api/models/api_models"
-	"github.com/chris-sg/bst_api/models/bst_models"
-	"github.com/chris-sg/bst_api/models/ddr_models"
-	"github.com/chris-sg/bst_api/models/drs_models"
-	"github.com/chris-sg/bst_api/models/user_models"
 	"github.com/golang/glog"
 	"github.com/jinzhu/gorm"
+	"time"
 )
 
 type DbMigrator interface {
-	Create()
-	CreateTables()
-	CreateConstraints()
-
-	createUserTables()
-	createApiTables()
-	createBstTables()
-	createDdrTables()
-	createDrsTables()
-	createDdrConstraints()
-	createDrsConstraints()
+	Migrate() (version int, errs []error)
+	Rollback(steps int) (version int, errs []error)
+	CurrentVersion() (version int, errs []error)
+	LatestVersion() int
 }
 
 func CreateDbMigratorPostgres(db *gorm.DB) DbMigratorPostgres {
@@ -32,224 +23,196 @@ type DbMigratorPostgres struct {
 	db *gorm.DB
 }
 
-func (migrator DbMigratorPostgres) Create() {
-	glog.Infoln("creating db")
-	migrator.CreateTables()
-	migrator.CreateConstraints()
+// Migrate will apply every pending migration in order. Each migration
+// runs within its own transaction alongside its schema_migrations row,
+// so a failure leaves the database at the last successful version.
+func (migrator DbMigratorPostgres) Migrate() (version int, errs []error) {
+	errs = migrator.createSchemaMigrationsTable()
+	if len(errs) > 0 {
+		return
+	}
+
+	version, errs = migrator.CurrentVersion()
+	if len(errs) > 0 {
+		return
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		glog.Infof("applying migration %d (%s)\n", migration.Version, migration.Name)
+		errs = migrator.inTransaction(func(tx *gorm.DB) (errs []error) {
+			errs = migration.Up(tx)
+			if len(errs) > 0 {
+				return
+			}
+			applied := api_models.SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now().UTC(),
+			}
+			errors := tx.Create(&applied).GetErrors()
+			if errors != nil && len(errors) != 0 {
+				errs = append(errs, errors...)
+			}
+			return
+		})
+		if len(errs) > 0 {
+			glog.Errorf("migration %d (%s) failed\n", migration.Version, migration.Name)
+			return
+		}
+		version = migration.Version
+	}
+
+	glog.Infof("db at version %d\n", version)
+	return
 }
 
-func (migrator DbMigratorPostgres) CreateTables() {
-	glog.Infoln("creating db tables")
-	migrator.createUserTables()
-	migrator.createApiTables()
-	migrator.createBstTables()
-	migrator.createDdrTables()
-	migrator.createDrsTables()
+// Rollback will run the down step for the given number of applied
+// migrations, most recent first.
+func (migrator DbMigratorPostgres) Rollback(steps int) (version int, errs []error) {
+	version, errs = migrator.CurrentVersion()
+	if len(errs) > 0 {
+		return
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := migrations[i]
+		if migration.Version > version {
+			continue
+		}
+		if migration.Down == nil {
+			errs = append(errs, fmt.Errorf("migration %d (%s) cannot be rolled back", migration.Version, migration.Name))
+			return
+		}
+		glog.Infof("rolling back migration %d (%s)\n", migration.Version, migration.Name)
+		errs = migrator.inTransaction(func(tx *gorm.DB) (errs []error) {
+			errs = migration.Down(tx)
+			if len(errs) > 0 {
+				return
+			}
+			errors := tx.Where("version = ?", migration.Version).Delete(&api_models.SchemaMigration{}).GetErrors()
+			if errors != nil && len(errors) != 0 {
+				errs = append(errs, errors...)
+			}
+			return
+		})
+		if len(errs) > 0 {
+			glog.Errorf("rollback of migration %d (%s) failed\n", migration.Version, migration.Name)
+			return
+		}
+		steps--
+		version = 0
+		if i > 0 {
+			version = migrations[i-1].Version
+		}
+	}
+
+	glog.Infof("db at version %d\n", version)
+	return
 }
 
-func (migrator DbMigratorPostgres) CreateConstraints() {
-	glog.Infoln("creating db constraints")
-	migrator.createDdrConstraints()
-	migrator.createDrsConstraints()
-}
-
-func (migrator DbMigratorPostgres) createUserTables() {
-	errs := migrator.db.AutoMigrate(&user_models.User{}).GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("automigration for user table user_models.User contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+// CurrentVersion will retrieve the most recently applied migration
+// version. A database without a schema_migrations table is at
+// version 0.
+func (migrator DbMigratorPostgres) CurrentVersion() (version int, errs []error) {
+	if !migrator.db.HasTable(&api_models.SchemaMigration{}) {
+		return
 	}
-}
 
-func (migrator DbMigratorPostgres) createApiTables() {
-	errs := migrator.db.AutoMigrate(&api_models.AutomaticJob{}).GetErrors()
+	applied := make([]api_models.SchemaMigration, 0)
+	resultDb := migrator.db.Model(&api_models.SchemaMigration{}).Order("version desc").Limit(1).Scan(&applied)
 
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("automigration for api table api_models.AutomaticJob contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
 	}
-}
-
-func (migrator DbMigratorPostgres) createBstTables() {
-	errs := migrator.db.AutoMigrate(&bst_models.BstProfile{}).GetErrors()
-
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("automigration for bst table bst_models.BstProfile contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+	if len(applied) > 0 {
+		version = applied[0].Version
 	}
+	return
 }
 
-func (migrator DbMigratorPostgres) createDdrTables() {
-	errs := migrator.db.AutoMigrate(&ddr_models.Song{}, &ddr_models.SongDifficulty{},
-						  &ddr_models.PlayerDetails{}, &ddr_models.Playcount{},
-						  &ddr_models.Score{}, ddr_models.SongStatistics{},
-						  &ddr_models.WorkoutData{}).
-			  GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("automigration for ddr tables contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+// LatestVersion is the version the database will be at once all known
+// migrations have been applied.
+func (migrator DbMigratorPostgres) LatestVersion() int {
+	if len(migrations) == 0 {
+		return 0
 	}
+	return migrations[len(migrations)-1].Version
 }
 
-func (migrator DbMigratorPostgres) createDdrConstraints() {
-	errs := migrator.db.Model(&ddr_models.SongDifficulty{}).
-		AddForeignKey("song_id", "public.\"ddrSongs\"(id)", "CASCADE", "CASCADE").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for ddr_models.SongDifficulty contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
-	}
-
-	errs = migrator.db.Model(&ddr_models.PlayerDetails{}).
-		      AddForeignKey("eagate_user", "public.\"eaGateUser\"(account_name)", "RESTRICT", "RESTRICT").
-			  GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for ddr_models.PlayerDetails contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
-	}
-
-	errs = migrator.db.Model(&ddr_models.Playcount{}).
-		AddForeignKey("player_code", "public.\"ddrPlayerDetails\"(code)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for ddr_models.Playcount contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
-	}
-
-	errs = migrator.db.Model(&ddr_models.WorkoutData{}).
-		AddForeignKey("player_code", "public.\"ddrPlayerDetails\"(code)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for ddr_models.WorkoutData contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+func (migrator DbMigratorPostgres) createSchemaMigrationsTable() (errs []error) {
+	errors := migrator.db.AutoMigrate(&api_models.SchemaMigration{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
 	}
+	return
+}
 
-	errs = migrator.db.Model(&ddr_models.SongStatistics{}).
-		AddForeignKey("song_id,mode,difficulty", "public.\"ddrSongDifficulties\"(song_id,mode,difficulty)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for ddr_models.SongStatistics contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+func (migrator DbMigratorPostgres) inTransaction(fn func(tx *gorm.DB) []error) (errs []error) {
+	tx := migrator.db.Begin()
+	errors := tx.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
 	}
 
-	errs = migrator.db.Model(&ddr_models.SongStatistics{}).
-		AddForeignKey("player_code", "public.\"ddrPlayerDetails\"(code)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for ddr_models.SongStatistics contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+	errs = fn(tx)
+	if len(errs) > 0 {
+		tx.Rollback()
+		return
 	}
 
-	errs = migrator.db.Model(&ddr_models.Score{}).
-		AddForeignKey("song_id,mode,difficulty", "public.\"ddrSongDifficulties\"(song_id,mode,difficulty)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for ddr_models.Score contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+	errors = tx.Commit().GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
 	}
+	return
+}
 
-	errs = migrator.db.Model(&ddr_models.Score{}).
-		AddForeignKey("player_code", "public.\"ddrPlayerDetails\"(code)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for ddr_models.Score contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
-	}
+func CreateDbMigratorMemory() *DbMigratorMemory {
+	return &DbMigratorMemory{}
 }
 
-func (migrator DbMigratorPostgres) createDrsTables() {
-	errs := migrator.db.AutoMigrate(&drs_models.PlayerDetails{}, &drs_models.Difficulty{},
-		&drs_models.DancerInfo{}, &drs_models.PlayerScore{},
-		&drs_models.PlayerSongStats{}, &drs_models.Song{},
-		&drs_models.PlayerProfileSnapshot{}, &drs_models.PlayHist{},
-		&drs_models.MusicData{}).
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("automigration for drs tables contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
-	}
+// DbMigratorMemory tracks a schema version for the in-memory db
+// communications. Their tables always match the latest models, so
+// migrations only move the recorded version.
+type DbMigratorMemory struct {
+	version int
 }
 
-func (migrator DbMigratorPostgres) createDrsConstraints() {
-	errs := migrator.db.Model(&drs_models.PlayerDetails{}).
-		AddForeignKey("eagate_user", "public.\"eaGateUser\"(account_name)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for drs_models.PlayerDetails contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
-	}
+func (migrator *DbMigratorMemory) Migrate() (version int, errs []error) {
+	migrator.version = migrator.LatestVersion()
+	version = migrator.version
+	return
+}
 
-	errs = migrator.db.Model(&drs_models.PlayerProfileSnapshot{}).
-		AddForeignKey("player_code", "public.\"drsPlayerDetails\"(code)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for drs_models.PlayerProfileSnapshot contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
+func (migrator *DbMigratorMemory) Rollback(steps int) (version int, errs []error) {
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		if migrations[i].Version > migrator.version {
+			continue
 		}
-	}
-
-	errs = migrator.db.Model(&drs_models.Difficulty{}).
-		AddForeignKey("song_id", "public.\"drsSongs\"(song_id)", "CASCADE", "CASCADE").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for drs_models.Difficulty contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
+		steps--
+		migrator.version = 0
+		if i > 0 {
+			migrator.version = migrations[i-1].Version
 		}
 	}
+	version = migrator.version
+	return
+}
 
-	errs = migrator.db.Model(&drs_models.PlayerSongStats{}).
-		AddForeignKey("player_code", "public.\"drsPlayerDetails\"(code)", "RESTRICT", "RESTRICT").
-		AddForeignKey("song_id", "public.\"drsSongs\"(song_id)", "CASCADE", "CASCADE").
-		AddForeignKey("mode", "public.\"drsDifficulties\"(mode)", "RESTRICT", "RESTRICT").
-		AddForeignKey("difficulty", "public.\"drsDifficulties\"(difficulty)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for drs_models.PlayerSongStats contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
-	}
+func (migrator *DbMigratorMemory) CurrentVersion() (version int, errs []error) {
+	version = migrator.version
+	return
+}
 
-	errs = migrator.db.Model(&drs_models.PlayerScore{}).
-		AddForeignKey("player_code", "public.\"drsPlayerDetails\"(code)", "RESTRICT", "RESTRICT").
-		AddForeignKey("song_id", "public.\"drsSongs\"(song_id)", "CASCADE", "CASCADE").
-		AddForeignKey("mode", "public.\"drsDifficulties\"(mode)", "RESTRICT", "RESTRICT").
-		AddForeignKey("difficulty", "public.\"drsDifficulties\"(difficulty)", "RESTRICT", "RESTRICT").
-		GetErrors()
-	if errs != nil && len(errs) > 0 {
-		glog.Warningln("fk creation for drs_models.PlayerScore contained errors:")
-		for _, err := range errs {
-			glog.Warningf("\t%s\n", err.Error())
-		}
+func (migrator *DbMigratorMemory) LatestVersion() int {
+	if len(migrations) == 0 {
+		return 0
 	}
-}
\ No newline at end of file
+	return migrations[len(migrations)-1].Version
+}
@@ -0,0 +1,359 @@
+package db_builder
+
+import (
+	"fmt"
+	"github.com/chris-sg/bst_api/db/db_dialect"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"time"
+)
+
+// Migration is a single numbered schema change. Up and Down are run
+// within a transaction; Down may be nil for migrations which cannot be
+// reversed.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) (errs []error)
+	Down    func(tx *gorm.DB) (errs []error)
+}
+
+// migrations are the schema changes owned by the api itself: the
+// baseline, which created every table (including each game's) before
+// games were modules and so cannot be split without renumbering
+// databases already on it, and changes to the shared tables or to more
+// than one game's tables at once. Changes to a single game's tables
+// belong to that game's db package and are registered by its module.
+// Versions are one sequence across every owner, in the order the
+// migrations were written.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up:      baselineUp,
+		Down:    baselineDown,
+	},
+	{
+		Version: 2,
+		Name:    "campaigns",
+		Up:      campaignsUp,
+		Down:    campaignsDown,
+	},
+	{
+		Version: 3,
+		Name:    "campaign_results",
+		Up:      campaignResultsUp,
+		Down:    campaignResultsDown,
+	},
+	{
+		Version: 9,
+		Name:    "player_refresh_times",
+		Up:      playerRefreshTimesUp,
+		Down:    playerRefreshTimesDown,
+	},
+	{
+		Version: 10,
+		Name:    "profile_timezone",
+		Up:      profileTimezoneUp,
+		Down:    profileTimezoneDown,
+	},
+}
+
+// RegisterMigration will add a migration to the set applied by
+// Migrate. Versions must be unique.
+func RegisterMigration(migration Migration) {
+	for _, m := range migrations {
+		if m.Version == migration.Version {
+			panic(fmt.Sprintf("migration version %d registered twice (%s, %s)", m.Version, m.Name, migration.Name))
+		}
+	}
+	migrations = append(migrations, migration)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// Migrations will retrieve all known migrations in version order.
+func Migrations() []Migration {
+	return append([]Migration{}, migrations...)
+}
+
+// foreignKey describes a constraint created by the baseline migration.
+type foreignKey struct {
+	model    interface{}
+	field    string
+	dest     string
+	onDelete string
+	onUpdate string
+}
+
+// baselineTables are ordered parents first. The drs api response types
+// (DancerInfo, MusicData, PlayHist) were previously auto migrated too,
+// but nothing reads or writes those tables so they are left alone.
+func baselineTables() []interface{} {
+	return []interface{}{
+		&baselineUser{},
+		&baselineAutomaticJob{}, &baselineAuditEntry{},
+		&baselineProfile{},
+		&baselineDdrSong{}, &baselineDdrSongDifficulty{},
+		&baselineDdrPlayerDetails{}, &baselineDdrPlaycount{},
+		&baselineDdrScore{}, &baselineDdrSongStatistics{},
+		&baselineDdrWorkoutData{},
+		&baselineDrsSong{}, &baselineDrsDifficulty{},
+		&baselineDrsPlayerDetails{}, &baselineDrsPlayerProfileSnapshot{},
+		&baselineDrsPlayerSongStats{}, &baselineDrsPlayerScore{},
+	}
+}
+
+// baselineForeignKeys are the constraints the original AutoMigrate
+// based builder created. The drsPlayerSongStats and drsPlayerScores
+// keys on mode and difficulty alone were never valid (neither column
+// is unique in drsDifficulties) and so are not included.
+func baselineForeignKeys() []foreignKey {
+	return []foreignKey{
+		{&baselineDdrSongDifficulty{}, "song_id", `public."ddrSongs"(id)`, "CASCADE", "CASCADE"},
+		{&baselineDdrPlayerDetails{}, "eagate_user", `public."eaGateUser"(account_name)`, "RESTRICT", "RESTRICT"},
+		{&baselineDdrPlaycount{}, "player_code", `public."ddrPlayerDetails"(code)`, "RESTRICT", "RESTRICT"},
+		{&baselineDdrWorkoutData{}, "player_code", `public."ddrPlayerDetails"(code)`, "RESTRICT", "RESTRICT"},
+		{&baselineDdrSongStatistics{}, "song_id,mode,difficulty", `public."ddrSongDifficulties"(song_id,mode,difficulty)`, "RESTRICT", "RESTRICT"},
+		{&baselineDdrSongStatistics{}, "player_code", `public."ddrPlayerDetails"(code)`, "RESTRICT", "RESTRICT"},
+		{&baselineDdrScore{}, "song_id,mode,difficulty", `public."ddrSongDifficulties"(song_id,mode,difficulty)`, "RESTRICT", "RESTRICT"},
+		{&baselineDdrScore{}, "player_code", `public."ddrPlayerDetails"(code)`, "RESTRICT", "RESTRICT"},
+
+		{&baselineDrsPlayerDetails{}, "eagate_user", `public."eaGateUser"(account_name)`, "RESTRICT", "RESTRICT"},
+		{&baselineDrsPlayerProfileSnapshot{}, "player_code", `public."drsPlayerDetails"(code)`, "RESTRICT", "RESTRICT"},
+		{&baselineDrsDifficulty{}, "song_id", `public."drsSongs"(song_id)`, "CASCADE", "CASCADE"},
+		{&baselineDrsPlayerSongStats{}, "player_code", `public."drsPlayerDetails"(code)`, "RESTRICT", "RESTRICT"},
+		{&baselineDrsPlayerSongStats{}, "song_id", `public."drsSongs"(song_id)`, "CASCADE", "CASCADE"},
+		{&baselineDrsPlayerScore{}, "player_code", `public."drsPlayerDetails"(code)`, "RESTRICT", "RESTRICT"},
+		{&baselineDrsPlayerScore{}, "song_id", `public."drsSongs"(song_id)`, "CASCADE", "CASCADE"},
+	}
+}
+
+// baselineUp brings a database to the schema that existed before
+// versioned migrations were introduced. Databases created by the old
+// builder already match, so every step is safe to repeat.
+func baselineUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(baselineTables()...).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+
+	// sqlite cannot add constraints to an existing table
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+
+	for _, fk := range baselineForeignKeys() {
+		errors = tx.Model(fk.model).AddForeignKey(fk.field, fk.dest, fk.onDelete, fk.onUpdate).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
+
+func baselineDown(tx *gorm.DB) (errs []error) {
+	tables := baselineTables()
+	for i := len(tables) - 1; i >= 0; i-- {
+		errors := tx.DropTableIfExists(tables[i]).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
+
+// campaignsProfile is the column added to bstProfile by the campaigns
+// migration.
+type campaignsProfile struct {
+	Campaigns string `gorm:"column:campaigns"`
+}
+
+func (campaignsProfile) TableName() string {
+	return "bstProfile"
+}
+
+// campaignsPlay is campaignPlays as created by the campaigns migration,
+// with a row per run rather than per play.
+type campaignsPlay struct {
+	Id          int       `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	WebUser     string    `gorm:"column:user_sub;index"`
+	EaGateUser  string    `gorm:"column:eagate_user"`
+	Campaign    string    `gorm:"column:campaign_id"`
+	Time        time.Time `gorm:"column:played_at;index"`
+	TimesPlayed int       `gorm:"column:times_played"`
+	Outcome     string    `gorm:"column:outcome"`
+}
+
+func (campaignsPlay) TableName() string {
+	return "campaignPlays"
+}
+
+// campaignsUp adds campaign opt in to profiles and the table recording
+// each campaign played.
+func campaignsUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&campaignsProfile{}, &campaignsPlay{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func campaignsDown(tx *gorm.DB) (errs []error) {
+	errors := tx.DropTableIfExists(&campaignsPlay{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+
+	// sqlite cannot drop columns, the unused column is left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	errors = tx.Model(&campaignsProfile{}).DropColumn("campaigns").GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// campaignResultsPlay is the columns added to campaignPlays by the
+// campaign results migration.
+type campaignResultsPlay struct {
+	Choice string `gorm:"column:choice"`
+	Result string `gorm:"column:result"`
+}
+
+func (campaignResultsPlay) TableName() string {
+	return "campaignPlays"
+}
+
+// campaignResultsUp replaces the per run play count with a row for each
+// play, holding the choice made and the result shown.
+func campaignResultsUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&campaignResultsPlay{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+
+	// sqlite cannot drop columns, the unused column is left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	errors = tx.Exec(`ALTER TABLE ` + db_dialect.Table(tx, "campaignPlays") + ` DROP COLUMN IF EXISTS times_played`).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func campaignResultsDown(tx *gorm.DB) (errs []error) {
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	errors := tx.Exec(`ALTER TABLE ` + db_dialect.Table(tx, "campaignPlays") + ` ADD COLUMN IF NOT EXISTS times_played integer`).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+	for _, column := range []string{"choice", "result"} {
+		errors = tx.Model(&campaignResultsPlay{}).DropColumn(column).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
+
+// refreshTimesDdrPlayer and refreshTimesDrsPlayer are the columns added
+// to each game's player details by the player refresh times migration.
+type refreshTimesDdrPlayer struct {
+	RefreshedAt time.Time `gorm:"column:refreshed_at"`
+}
+
+func (refreshTimesDdrPlayer) TableName() string {
+	return "ddrPlayerDetails"
+}
+
+type refreshTimesDrsPlayer struct {
+	RefreshedAt time.Time `gorm:"column:refreshed_at"`
+}
+
+func (refreshTimesDrsPlayer) TableName() string {
+	return "drsPlayerDetails"
+}
+
+// playerRefreshTimesUp adds the time each game's player details were
+// last refreshed from eagate.
+func playerRefreshTimesUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&refreshTimesDdrPlayer{}, &refreshTimesDrsPlayer{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func playerRefreshTimesDown(tx *gorm.DB) (errs []error) {
+	// sqlite cannot drop columns, the unused columns are left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	for _, model := range []interface{}{&refreshTimesDdrPlayer{}, &refreshTimesDrsPlayer{}} {
+		errors := tx.Model(model).DropColumn("refreshed_at").GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
+
+// timezoneProfile is the column added to bstProfile by the profile
+// timezone migration.
+type timezoneProfile struct {
+	Timezone string `gorm:"column:timezone"`
+}
+
+func (timezoneProfile) TableName() string {
+	return "bstProfile"
+}
+
+// profileTimezoneUp adds the preferred timezone to profiles.
+func profileTimezoneUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&timezoneProfile{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func profileTimezoneDown(tx *gorm.DB) (errs []error) {
+	// sqlite cannot drop columns, the unused column is left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	errors := tx.Model(&timezoneProfile{}).DropColumn("timezone").GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// ExecAll will run each statement in turn, stopping at the first that
+// fails.
+func ExecAll(tx *gorm.DB, statements []string) (errs []error) {
+	for _, statement := range statements {
+		errors := tx.Exec(statement).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,44 @@
+// Package db_dialect contains the small pieces of raw sql which differ
+// between the supported database dialects.
+package db_dialect
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"time"
+)
+
+const sqliteTimestampFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// IsSqlite reports whether the connection is a sqlite database.
+func IsSqlite(db *gorm.DB) bool {
+	return db.Dialect().GetName() == "sqlite3"
+}
+
+// Table will produce a quoted table name for use in raw sql.
+func Table(db *gorm.DB, name string) string {
+	if IsSqlite(db) {
+		return fmt.Sprintf(`"%s"`, name)
+	}
+	return fmt.Sprintf(`public."%s"`, name)
+}
+
+// Timestamp will format t as a literal for use in raw sql. sqlite
+// compares timestamps as text, so they are always stored in UTC.
+func Timestamp(db *gorm.DB, t time.Time) string {
+	if IsSqlite(db) {
+		return t.UTC().Format(sqliteTimestampFormat)
+	}
+	return string(pq.FormatTimestamp(t))
+}
+
+// ParseTimestamp will parse a timestamp scanned into a string. sqlite
+// returns aggregates of timestamp columns as text rather than a time, so
+// those are scanned as strings in every dialect and parsed here.
+func ParseTimestamp(db *gorm.DB, value string) (time.Time, error) {
+	if IsSqlite(db) {
+		return time.Parse(sqliteTimestampFormat, value)
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
@@ -0,0 +1,66 @@
+package db_dialect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ordering is a single parsed sql ORDER BY term.
+type Ordering struct {
+	Column     string
+	Descending bool
+}
+
+// ParseOrdering will parse sql style ordering clauses such as
+// "name desc" or "mode, difficulty asc".
+func ParseOrdering(clauses []string) (orderings []Ordering, err error) {
+	for _, clause := range clauses {
+		for _, term := range strings.Split(clause, ",") {
+			fields := strings.Fields(strings.ToLower(term))
+			if len(fields) == 0 {
+				continue
+			}
+			ordering := Ordering{Column: fields[0]}
+			if len(fields) > 2 {
+				err = fmt.Errorf("invalid ordering %s", term)
+				return
+			}
+			if len(fields) == 2 {
+				switch fields[1] {
+				case "asc":
+				case "desc":
+					ordering.Descending = true
+				default:
+					err = fmt.Errorf("invalid ordering direction %s", fields[1])
+					return
+				}
+			}
+			orderings = append(orderings, ordering)
+		}
+	}
+	return
+}
+
+// CheckOrdering will parse the ordering clauses and check that every
+// column is one of columns, so that bad orderings can be rejected before
+// they reach the database.
+func CheckOrdering(clauses []string, columns []string) (err error) {
+	orderings, err := ParseOrdering(clauses)
+	if err != nil {
+		return
+	}
+	for _, ordering := range orderings {
+		known := false
+		for _, column := range columns {
+			if ordering.Column == column {
+				known = true
+				break
+			}
+		}
+		if !known {
+			err = fmt.Errorf("column \"%s\" does not exist", ordering.Column)
+			return
+		}
+	}
+	return
+}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"github.com/chris-sg/bst_api/db/api_db"
 	"github.com/chris-sg/bst_api/db/db_builder"
+	"github.com/chris-sg/bst_api/db/db_memory"
 	"github.com/chris-sg/bst_api/db/ddr_db"
 	"github.com/chris-sg/bst_api/db/drs_db"
 	"github.com/chris-sg/bst_api/db/user_db"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
 var (
@@ -17,12 +19,13 @@ var (
 	ddrDbComm ddr_db.DdrDbCommunication
 	drsDbComm drs_db.DrsDbCommunication
 	idleConnectionLimit int
+	memory bool
 	migrator db_builder.DbMigrator
 	userDbComm user_db.UserDbCommunication
 )
 
 func OpenDb(dialect string, user string, password string, dbname string, host string, maxIdleConnections int) (err error) {
-	availableDialects := []string{"postgres"}
+	availableDialects := []string{"postgres", "sqlite3", "memory"}
 
 	found := false
 	for _, d := range availableDialects {
@@ -37,10 +40,16 @@ func OpenDb(dialect string, user string, password string, dbname string, host st
 	}
 
 	if dialect == "postgres" {
-		openDbPostgres(user, password, dbname, host, maxIdleConnections)
+		err = openDbPostgres(user, password, dbname, host, maxIdleConnections)
+	}
+	if dialect == "sqlite3" {
+		err = openDbSqlite(dbname)
+	}
+	if dialect == "memory" {
+		OpenDbMemory()
 	}
 
-	return nil
+	return
 }
 
 func openDbPostgres(user string, password string, dbname string, host string, maxIdleConnections int) (err error) {
@@ -51,6 +60,7 @@ func openDbPostgres(user string, password string, dbname string, host string, ma
 		return
 	}
 	db = newDb
+	memory = false
 	db.DB().SetMaxIdleConns(maxIdleConnections)
 	idleConnectionLimit = maxIdleConnections
 
@@ -63,6 +73,80 @@ func openDbPostgres(user string, password string, dbname string, host string, ma
 	return
 }
 
+// openDbSqlite will open (or create) the sqlite database at file. The
+// postgres implementations select sqlite specific sql from the
+// connection's dialect, so they are reused here.
+func openDbSqlite(file string) (err error) {
+	newDb, err := gorm.Open("sqlite3", file)
+	if err != nil {
+		return
+	}
+	db = newDb
+	memory = false
+	// sqlite only allows a single writer
+	db.DB().SetMaxOpenConns(1)
+	idleConnectionLimit = 1
+
+	apiDbComm = api_db.CreateApiDbCommunicationPostgres(db)
+	ddrDbComm = ddr_db.CreateDdrDbCommunicationPostgres(db)
+	drsDbComm = drs_db.CreateDrsDbCommunicationPostgres(db)
+	migrator = db_builder.CreateDbMigratorPostgres(db)
+	userDbComm = user_db.CreateUserDbCommunicationPostgres(db)
+
+	return
+}
+
+// OpenDbMemory will replace the db communications with in-memory
+// implementations sharing a new, empty store, which is returned so
+// tests can seed or inspect it directly. The schema is reported as
+// being at the latest version.
+func OpenDbMemory() *db_memory.Store {
+	store := db_memory.NewStore()
+	db = nil
+	idleConnectionLimit = 1
+
+	apiDbComm = api_db.CreateApiDbCommunicationMemory(store)
+	ddrDbComm = ddr_db.CreateDdrDbCommunicationMemory(store)
+	drsDbComm = drs_db.CreateDrsDbCommunicationMemory(store)
+	userDbComm = user_db.CreateUserDbCommunicationMemory(store)
+
+	memoryMigrator := db_builder.CreateDbMigratorMemory()
+	memoryMigrator.Migrate()
+	migrator = memoryMigrator
+	memory = true
+
+	return store
+}
+
+// SetDbCommunications will replace the db communications used by the
+// routers. Any left nil are unchanged.
+func SetDbCommunications(api api_db.ApiDbCommunication, ddr ddr_db.DdrDbCommunication, drs drs_db.DrsDbCommunication, user user_db.UserDbCommunication) {
+	if api != nil {
+		apiDbComm = api
+	}
+	if ddr != nil {
+		ddrDbComm = ddr
+	}
+	if drs != nil {
+		drsDbComm = drs
+	}
+	if user != nil {
+		userDbComm = user
+	}
+}
+
+// Ping will check the db connection is usable. The in-memory db is
+// always available.
+func Ping() error {
+	if memory {
+		return nil
+	}
+	if db == nil {
+		return fmt.Errorf("db connection has not been created, please use OpenDb()")
+	}
+	return db.DB().Ping()
+}
+
 func GetDb() (*gorm.DB, error) {
 	if db == nil {
 		return nil, fmt.Errorf("db connection has not been created, please use OpenDb()")
@@ -0,0 +1,210 @@
+// Package db_memory holds the shared state behind the in-memory db
+// communication implementations, allowing tests and demo servers to
+// run without a database.
+package db_memory
+
+import (
+	"fmt"
+	"github.com/chris-sg/bst_api/db/db_dialect"
+	"github.com/chris-sg/bst_api/models/api_models"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	"github.com/chris-sg/bst_api/models/ddr_models"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/chris-sg/bst_api/models/user_models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tables mirrors the database schema. Rows are kept in insertion order,
+// which is the order they are returned in when no ordering is given.
+type Tables struct {
+	Profiles     []bst_models.BstProfile
+	AuditEntries []api_models.AuditEntry
+	Users        []user_models.User
+
+	CampaignPlays []api_models.CampaignPlay
+
+	DdrSongs          []ddr_models.Song
+	DdrDifficulties   []ddr_models.SongDifficulty
+	DdrPlayerDetails  []ddr_models.PlayerDetails
+	DdrPlaycounts     []ddr_models.Playcount
+	DdrSongStatistics []ddr_models.SongStatistics
+	DdrScores         []ddr_models.Score
+	DdrWorkoutData    []ddr_models.WorkoutData
+
+	DrsSongs            []drs_models.Song
+	DrsDifficulties     []drs_models.Difficulty
+	DrsPlayerDetails    []drs_models.PlayerDetails
+	DrsProfileSnapshots []drs_models.PlayerProfileSnapshot
+	DrsPlayerSongStats  []drs_models.PlayerSongStats
+	DrsPlayerScores     []drs_models.PlayerScore
+	DrsArchivedVideos   []drs_models.ArchivedVideo
+	DrsPlayerUnlocks    []drs_models.PlayerUnlock
+
+	// serial sequences, which like postgres are never reused
+	LastProfileId       int
+	LastAuditId         int
+	LastCampaignPlayId  int
+	LastArchivedVideoId int
+}
+
+func (tables Tables) clone() Tables {
+	c := tables
+	c.Profiles = append([]bst_models.BstProfile{}, tables.Profiles...)
+	c.AuditEntries = append([]api_models.AuditEntry{}, tables.AuditEntries...)
+	c.Users = append([]user_models.User{}, tables.Users...)
+	c.CampaignPlays = append([]api_models.CampaignPlay{}, tables.CampaignPlays...)
+
+	c.DdrSongs = append([]ddr_models.Song{}, tables.DdrSongs...)
+	c.DdrDifficulties = append([]ddr_models.SongDifficulty{}, tables.DdrDifficulties...)
+	c.DdrPlayerDetails = append([]ddr_models.PlayerDetails{}, tables.DdrPlayerDetails...)
+	c.DdrPlaycounts = append([]ddr_models.Playcount{}, tables.DdrPlaycounts...)
+	c.DdrSongStatistics = append([]ddr_models.SongStatistics{}, tables.DdrSongStatistics...)
+	c.DdrScores = append([]ddr_models.Score{}, tables.DdrScores...)
+	c.DdrWorkoutData = append([]ddr_models.WorkoutData{}, tables.DdrWorkoutData...)
+
+	c.DrsSongs = append([]drs_models.Song{}, tables.DrsSongs...)
+	c.DrsDifficulties = append([]drs_models.Difficulty{}, tables.DrsDifficulties...)
+	c.DrsPlayerDetails = append([]drs_models.PlayerDetails{}, tables.DrsPlayerDetails...)
+	c.DrsProfileSnapshots = append([]drs_models.PlayerProfileSnapshot{}, tables.DrsProfileSnapshots...)
+	c.DrsPlayerSongStats = append([]drs_models.PlayerSongStats{}, tables.DrsPlayerSongStats...)
+	c.DrsPlayerScores = append([]drs_models.PlayerScore{}, tables.DrsPlayerScores...)
+	c.DrsArchivedVideos = append([]drs_models.ArchivedVideo{}, tables.DrsArchivedVideos...)
+	c.DrsPlayerUnlocks = append([]drs_models.PlayerUnlock{}, tables.DrsPlayerUnlocks...)
+	return c
+}
+
+// Store is shared by the in-memory implementations of every db
+// communication interface, so that operations spanning several of them
+// (such as deleting a user) see the same data.
+type Store struct {
+	mu     sync.Mutex
+	txMu   sync.Mutex
+	tables Tables
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Do will run fn with exclusive access to the tables. fn must not call
+// back into the store.
+func (store *Store) Do(fn func(tables *Tables)) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	fn(&store.tables)
+}
+
+// Transaction will run fn, restoring the tables to their prior state if
+// fn returns any errors. Transactions are serialised, but are not
+// isolated from writes made outside of a transaction.
+func (store *Store) Transaction(fn func() (errs []error)) (errs []error) {
+	store.txMu.Lock()
+	defer store.txMu.Unlock()
+
+	var snapshot Tables
+	store.Do(func(tables *Tables) {
+		snapshot = tables.clone()
+	})
+
+	defer func() {
+		if r := recover(); r != nil {
+			store.Do(func(tables *Tables) {
+				*tables = snapshot
+			})
+			panic(r)
+		}
+	}()
+
+	errs = fn()
+	if len(errs) > 0 {
+		store.Do(func(tables *Tables) {
+			*tables = snapshot
+		})
+	}
+	return
+}
+
+// Timestamp will reduce t to the precision stored by postgres, dropping
+// any monotonic clock reading so values can be compared.
+func Timestamp(t time.Time) time.Time {
+	return t.Truncate(time.Microsecond)
+}
+
+// Between reports whether t falls within start and end inclusive, as
+// sql's BETWEEN does.
+func Between(t time.Time, start time.Time, end time.Time) bool {
+	return !t.Before(start) && !t.After(end)
+}
+
+// Columns maps a column name to a comparison of rows i and j, which
+// returns a negative, zero or positive value.
+type Columns map[string]func(i int, j int) int
+
+// Less will build a sort.SliceStable less function from orderings.
+// Orderings should first be validated with CheckColumns.
+func Less(orderings []db_dialect.Ordering, columns Columns) func(i int, j int) bool {
+	return func(i int, j int) bool {
+		for _, ordering := range orderings {
+			compare, ok := columns[ordering.Column]
+			if !ok {
+				continue
+			}
+			result := compare(i, j)
+			if result == 0 {
+				continue
+			}
+			if ordering.Descending {
+				return result > 0
+			}
+			return result < 0
+		}
+		return false
+	}
+}
+
+// CheckColumns will return an error for the first ordering referring to
+// an unknown column.
+func CheckColumns(orderings []db_dialect.Ordering, columns Columns) error {
+	for _, ordering := range orderings {
+		if _, ok := columns[ordering.Column]; !ok {
+			return fmt.Errorf("column \"%s\" does not exist", ordering.Column)
+		}
+	}
+	return nil
+}
+
+func CompareInt(a int, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func CompareString(a string, b string) int {
+	return strings.Compare(a, b)
+}
+
+func CompareTime(a time.Time, b time.Time) int {
+	if a.Before(b) {
+		return -1
+	}
+	if a.After(b) {
+		return 1
+	}
+	return 0
+}
+
+func CompareBool(a bool, b bool) int {
+	if a == b {
+		return 0
+	}
+	if !a {
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,570 @@
+package ddr_db
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chris-sg/bst_api/db/db_dialect"
+	"github.com/chris-sg/bst_api/db/db_memory"
+	"github.com/chris-sg/bst_api/models/ddr_models"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"strings"
+	"time"
+)
+
+func CreateDdrDbCommunicationMemory(store *db_memory.Store) DdrDbCommunicationMemory {
+	return DdrDbCommunicationMemory{store: store}
+}
+
+// DdrDbCommunicationMemory keeps all data in a db_memory.Store, with
+// the same conflict handling and ordering as the postgres queries.
+type DdrDbCommunicationMemory struct {
+	store *db_memory.Store
+
+	inTransaction bool
+}
+
+func (dbcomm DdrDbCommunicationMemory) AddSongs(songs []ddr_models.Song) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, song := range songs {
+			if findDdrSong(tables, song.Id) >= 0 {
+				continue
+			}
+			tables.DdrSongs = append(tables.DdrSongs, ddr_models.Song{
+				Id:     song.Id,
+				Name:   cleanString(song.Name),
+				Artist: cleanString(song.Artist),
+				Image:  song.Image,
+			})
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) UpdateSongInfo(songs []ddr_models.Song) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, song := range songs {
+			i := findDdrSong(tables, song.Id)
+			if i < 0 {
+				continue
+			}
+			tables.DdrSongs[i].MinBpm = song.MinBpm
+			tables.DdrSongs[i].MaxBpm = song.MaxBpm
+			tables.DdrSongs[i].Version = song.Version
+			tables.DdrSongs[i].Availability = song.Availability
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveSongIds() (songIds []string, errs []error) {
+	songIds = make([]string, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, song := range tables.DdrSongs {
+			songIds = append(songIds, song.Id)
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveSongsById(songIds []string, ordering []string) (songs []ddr_models.Song, errs []error) {
+	songs = make([]ddr_models.Song, 0)
+	orderings, err := db_dialect.ParseOrdering(ordering)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, song := range tables.DdrSongs {
+			if containsString(songIds, song.Id) {
+				song.Image = ""
+				songs = append(songs, song)
+			}
+		}
+	})
+
+	columns := db_memory.Columns{
+		"id":      func(i, j int) int { return db_memory.CompareString(songs[i].Id, songs[j].Id) },
+		"name":    func(i, j int) int { return db_memory.CompareString(songs[i].Name, songs[j].Name) },
+		"artist":  func(i, j int) int { return db_memory.CompareString(songs[i].Artist, songs[j].Artist) },
+		"min_bpm": func(i, j int) int { return db_memory.CompareInt(int(songs[i].MinBpm), int(songs[j].MinBpm)) },
+		"max_bpm": func(i, j int) int { return db_memory.CompareInt(int(songs[i].MaxBpm), int(songs[j].MaxBpm)) },
+		"version": func(i, j int) int { return db_memory.CompareString(songs[i].Version, songs[j].Version) },
+	}
+	if err := db_memory.CheckColumns(orderings, columns); err != nil {
+		errs = append(errs, err)
+		return
+	}
+	sort.SliceStable(songs, db_memory.Less(orderings, columns))
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveJacketForSongId(songId string) (jacket string, errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		if i := findDdrSong(tables, songId); i >= 0 {
+			jacket = tables.DdrSongs[i].Image
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveJacketsForSongIds(songIds []string) (jackets map[string]string, errs []error) {
+	jackets = make(map[string]string)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, song := range tables.DdrSongs {
+			if containsString(songIds, song.Id) {
+				jackets[song.Id] = song.Image
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) AddDifficulties(difficulties []ddr_models.SongDifficulty) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, difficulty := range difficulties {
+			i := findDdrDifficulty(tables, difficulty.SongId, difficulty.Mode, difficulty.Difficulty)
+			if i >= 0 {
+				tables.DdrDifficulties[i].DifficultyValue = difficulty.DifficultyValue
+				continue
+			}
+			tables.DdrDifficulties = append(tables.DdrDifficulties, ddr_models.SongDifficulty{
+				SongId:          difficulty.SongId,
+				Mode:            difficulty.Mode,
+				Difficulty:      difficulty.Difficulty,
+				DifficultyValue: difficulty.DifficultyValue,
+			})
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) UpdateChartDetails(charts []ddr_models.SongDifficulty) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, chart := range charts {
+			i := findDdrDifficulty(tables, chart.SongId, chart.Mode, chart.Difficulty)
+			if i < 0 {
+				continue
+			}
+			chart.DifficultyValue = tables.DdrDifficulties[i].DifficultyValue
+			tables.DdrDifficulties[i] = chart
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveDifficulties() (difficulties []ddr_models.SongDifficulty, errs []error) {
+	difficulties = dbcomm.filterDifficulties(func(difficulty ddr_models.SongDifficulty) bool {
+		return true
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveValidDifficulties() (difficulties []ddr_models.SongDifficulty, errs []error) {
+	difficulties = dbcomm.filterDifficulties(func(difficulty ddr_models.SongDifficulty) bool {
+		return difficulty.DifficultyValue > -1
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveDifficultiesById(songIds []string) (difficulties []ddr_models.SongDifficulty, errs []error) {
+	difficulties = dbcomm.filterDifficulties(func(difficulty ddr_models.SongDifficulty) bool {
+		return containsString(songIds, difficulty.SongId)
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveValidDifficultiesById(songIds []string) (difficulties []ddr_models.SongDifficulty, errs []error) {
+	difficulties = dbcomm.filterDifficulties(func(difficulty ddr_models.SongDifficulty) bool {
+		return containsString(songIds, difficulty.SongId) && difficulty.DifficultyValue > -1
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) filterDifficulties(include func(difficulty ddr_models.SongDifficulty) bool) (difficulties []ddr_models.SongDifficulty) {
+	difficulties = make([]ddr_models.SongDifficulty, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, difficulty := range tables.DdrDifficulties {
+			if include(difficulty) {
+				difficulties = append(difficulties, difficulty)
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) AddPlayerDetails(details ddr_models.PlayerDetails) (errs []error) {
+	details.RefreshedAt = db_memory.Timestamp(details.RefreshedAt)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for i := range tables.DdrPlayerDetails {
+			if tables.DdrPlayerDetails[i].Code == details.Code {
+				tables.DdrPlayerDetails[i] = details
+				return
+			}
+		}
+		tables.DdrPlayerDetails = append(tables.DdrPlayerDetails, details)
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrievePlayerDetailsByEaGateUser(eaGateUser string) (details ddr_models.PlayerDetails, exists bool, errs []error) {
+	eaGateUser = strings.ToLower(eaGateUser)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, d := range tables.DdrPlayerDetails {
+			if d.EaGateUser != nil && *d.EaGateUser == eaGateUser {
+				details = d
+				exists = true
+				return
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrievePlayerDetailsByPlayerCode(code int) (details ddr_models.PlayerDetails, errs []error) {
+	found := false
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, d := range tables.DdrPlayerDetails {
+			if d.Code == code {
+				details = d
+				found = true
+				return
+			}
+		}
+	})
+	if !found {
+		errs = append(errs, gorm.ErrRecordNotFound)
+	}
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) AddPlaycounts(playcountDetails []ddr_models.Playcount) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, playcount := range playcountDetails {
+			playcount.LastPlayDate = db_memory.Timestamp(playcount.LastPlayDate)
+			playcount.SingleLastPlayDate = db_memory.Timestamp(playcount.SingleLastPlayDate)
+			playcount.DoubleLastPlayDate = db_memory.Timestamp(playcount.DoubleLastPlayDate)
+			for _, existing := range tables.DdrPlaycounts {
+				if existing.PlayerCode == playcount.PlayerCode && existing.LastPlayDate.Equal(playcount.LastPlayDate) {
+					continue next
+				}
+			}
+			tables.DdrPlaycounts = append(tables.DdrPlaycounts, playcount)
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrievePlaycountsByPlayerCode(code int) (playcounts []ddr_models.Playcount, errs []error) {
+	playcounts = dbcomm.filterPlaycounts(func(playcount ddr_models.Playcount) bool {
+		return playcount.PlayerCode == code
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveLatestPlaycountByPlayerCode(code int) (playcount ddr_models.Playcount, errs []error) {
+	playcounts := dbcomm.filterPlaycounts(func(playcount ddr_models.Playcount) bool {
+		return playcount.PlayerCode == code
+	})
+	if len(playcounts) == 0 {
+		errs = append(errs, gorm.ErrRecordNotFound)
+		return
+	}
+	sort.SliceStable(playcounts, func(i, j int) bool {
+		return playcounts[i].Playcount > playcounts[j].Playcount
+	})
+	playcount = playcounts[0]
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrievePlaycountsByPlayerCodeInDateRange(code int, startDate time.Time, endDate time.Time) (playcounts []ddr_models.Playcount, errs []error) {
+	playcounts = dbcomm.filterPlaycounts(func(playcount ddr_models.Playcount) bool {
+		return playcount.PlayerCode == code && db_memory.Between(playcount.LastPlayDate, startDate, endDate)
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) filterPlaycounts(include func(playcount ddr_models.Playcount) bool) (playcounts []ddr_models.Playcount) {
+	playcounts = make([]ddr_models.Playcount, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, playcount := range tables.DdrPlaycounts {
+			if include(playcount) {
+				playcounts = append(playcounts, playcount)
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) AddSongStatistics(statistics []ddr_models.SongStatistics) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, statistic := range statistics {
+			statistic.LastPlayed = db_memory.Timestamp(statistic.LastPlayed)
+			for i, existing := range tables.DdrSongStatistics {
+				if existing.PlayerCode == statistic.PlayerCode &&
+					existing.SongId == statistic.SongId &&
+					existing.Mode == statistic.Mode &&
+					existing.Difficulty == statistic.Difficulty {
+					tables.DdrSongStatistics[i] = statistic
+					continue next
+				}
+			}
+			tables.DdrSongStatistics = append(tables.DdrSongStatistics, statistic)
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveSongStatisticsByPlayerCode(code int, songIds []string) (statistics []ddr_models.SongStatistics, errs []error) {
+	statistics = make([]ddr_models.SongStatistics, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, statistic := range tables.DdrSongStatistics {
+			if statistic.PlayerCode != code {
+				continue
+			}
+			if len(songIds) > 0 && !containsString(songIds, statistic.SongId) {
+				continue
+			}
+			statistics = append(statistics, statistic)
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) AddScores(scores []ddr_models.Score) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, score := range scores {
+			score.TimePlayed = db_memory.Timestamp(score.TimePlayed)
+			for _, existing := range tables.DdrScores {
+				if existing.PlayerCode == score.PlayerCode &&
+					existing.SongId == score.SongId &&
+					existing.Mode == score.Mode &&
+					existing.Difficulty == score.Difficulty &&
+					existing.TimePlayed.Equal(score.TimePlayed) {
+					continue next
+				}
+			}
+			tables.DdrScores = append(tables.DdrScores, score)
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveScoresByPlayerCode(code int) (scores []ddr_models.Score, errs []error) {
+	scores = make([]ddr_models.Score, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, score := range tables.DdrScores {
+			if score.PlayerCode == code {
+				scores = append(scores, score)
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveSongScores(code int, songId string, mode string, difficulty string, ordering []string) (scores []ddr_models.Score, errs []error) {
+	scores = make([]ddr_models.Score, 0)
+	if code == 0 {
+		errs = append(errs, fmt.Errorf("no user code specified"))
+		return
+	}
+	if songId == "" {
+		errs = append(errs, fmt.Errorf("no song id specified"))
+		return
+	}
+	orderings, err := db_dialect.ParseOrdering(ordering)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	mode = strings.ToUpper(mode)
+	difficulty = strings.ToUpper(difficulty)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, score := range tables.DdrScores {
+			if score.PlayerCode != code || score.SongId != songId {
+				continue
+			}
+			if mode != "" && score.Mode != mode {
+				continue
+			}
+			if difficulty != "" && score.Difficulty != difficulty {
+				continue
+			}
+			scores = append(scores, score)
+		}
+	})
+
+	columns := db_memory.Columns{
+		"score":       func(i, j int) int { return db_memory.CompareInt(scores[i].Score, scores[j].Score) },
+		"cleared":     func(i, j int) int { return db_memory.CompareBool(scores[i].ClearStatus, scores[j].ClearStatus) },
+		"time_played": func(i, j int) int { return db_memory.CompareTime(scores[i].TimePlayed, scores[j].TimePlayed) },
+		"song_id":     func(i, j int) int { return db_memory.CompareString(scores[i].SongId, scores[j].SongId) },
+		"mode":        func(i, j int) int { return db_memory.CompareString(scores[i].Mode, scores[j].Mode) },
+		"difficulty":  func(i, j int) int { return db_memory.CompareString(scores[i].Difficulty, scores[j].Difficulty) },
+		"player_code": func(i, j int) int { return db_memory.CompareInt(scores[i].PlayerCode, scores[j].PlayerCode) },
+	}
+	if err := db_memory.CheckColumns(orderings, columns); err != nil {
+		errs = append(errs, err)
+		scores = nil
+		return
+	}
+	sort.SliceStable(scores, db_memory.Less(orderings, columns))
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) AddWorkoutData(workoutData []ddr_models.WorkoutData) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, data := range workoutData {
+			data.Date = db_memory.Timestamp(data.Date)
+			for i, existing := range tables.DdrWorkoutData {
+				if existing.PlayerCode == data.PlayerCode && existing.Date.Equal(data.Date) {
+					tables.DdrWorkoutData[i].PlayCount = data.PlayCount
+					tables.DdrWorkoutData[i].Kcal = data.Kcal
+					continue next
+				}
+			}
+			tables.DdrWorkoutData = append(tables.DdrWorkoutData, data)
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveWorkoutDataByPlayerCode(code int) (workoutData []ddr_models.WorkoutData, errs []error) {
+	workoutData = dbcomm.filterWorkoutData(func(data ddr_models.WorkoutData) bool {
+		return data.PlayerCode == code
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveWorkoutDataByPlayerCodeInDateRange(code int, startDate time.Time, endDate time.Time) (workoutData []ddr_models.WorkoutData, errs []error) {
+	workoutData = dbcomm.filterWorkoutData(func(data ddr_models.WorkoutData) bool {
+		return data.PlayerCode == code && db_memory.Between(data.Date, startDate, endDate)
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) filterWorkoutData(include func(data ddr_models.WorkoutData) bool) (workoutData []ddr_models.WorkoutData) {
+	workoutData = make([]ddr_models.WorkoutData, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, data := range tables.DdrWorkoutData {
+			if include(data) {
+				workoutData = append(workoutData, data)
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm DdrDbCommunicationMemory) RetrieveExtendedScoreStatisticsByPlayerCode(code int) (statisticsJson string, errs []error) {
+	stats := make([]DdrStatisticsTable, 0)
+
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, difficulty := range tables.DdrDifficulties {
+			if difficulty.DifficultyValue == -1 {
+				continue
+			}
+			i := findDdrSong(tables, difficulty.SongId)
+			if i < 0 {
+				continue
+			}
+			row := DdrStatisticsTable{
+				Level:      int(difficulty.DifficultyValue),
+				Title:      fixString(tables.DdrSongs[i].Name),
+				Artist:     fixString(tables.DdrSongs[i].Artist),
+				Mode:       difficulty.Mode,
+				Difficulty: difficulty.Difficulty,
+				Id:         difficulty.SongId,
+
+				Stream:       int(difficulty.Stream),
+				Voltage:      int(difficulty.Voltage),
+				Air:          int(difficulty.Air),
+				Freeze:       int(difficulty.Freeze),
+				Chaos:        int(difficulty.Chaos),
+				Notes:        difficulty.Notes,
+				FreezeArrows: difficulty.FreezeArrows,
+				ShockArrows:  difficulty.ShockArrows,
+
+				Version: tables.DdrSongs[i].Version,
+				MinBpm:  int(tables.DdrSongs[i].MinBpm),
+				MaxBpm:  int(tables.DdrSongs[i].MaxBpm),
+			}
+			for _, statistic := range tables.DdrSongStatistics {
+				if statistic.PlayerCode == code &&
+					statistic.SongId == difficulty.SongId &&
+					statistic.Mode == difficulty.Mode &&
+					statistic.Difficulty == difficulty.Difficulty {
+					row.Lamp = statistic.Lamp
+					row.Rank = statistic.Rank
+					row.Score = statistic.BestScore
+					row.PlayCount = statistic.PlayCount
+					row.ClearCount = statistic.ClearCount
+					row.MaxCombo = statistic.MaxCombo
+					break
+				}
+			}
+			stats = append(stats, row)
+		}
+	})
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Mode != stats[j].Mode {
+			return stats[i].Mode > stats[j].Mode
+		}
+		return stats[i].Level < stats[j].Level
+	})
+
+	result, err := json.Marshal(stats)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to convert loaded extended statistics to json for code %d: %s", code, err.Error()))
+		return
+	}
+
+	statisticsJson = string(result)
+	return
+}
+
+// Transaction will run fn, discarding all of its changes if it returns
+// any errors. Calls made while already within a transaction join the
+// outer one.
+func (dbcomm DdrDbCommunicationMemory) Transaction(fn func(tx DdrDbCommunication) (errs []error)) (errs []error) {
+	if dbcomm.inTransaction {
+		return fn(dbcomm)
+	}
+	return dbcomm.store.Transaction(func() []error {
+		return fn(DdrDbCommunicationMemory{store: dbcomm.store, inTransaction: true})
+	})
+}
+
+func findDdrSong(tables *db_memory.Tables, songId string) int {
+	for i := range tables.DdrSongs {
+		if tables.DdrSongs[i].Id == songId {
+			return i
+		}
+	}
+	return -1
+}
+
+func findDdrDifficulty(tables *db_memory.Tables, songId string, mode string, difficulty string) int {
+	for i := range tables.DdrDifficulties {
+		d := tables.DdrDifficulties[i]
+		if d.SongId == songId && d.Mode == mode && d.Difficulty == difficulty {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package ddr_db
+
+import (
+	"github.com/chris-sg/bst_api/db/db_builder"
+	"github.com/chris-sg/bst_api/db/db_dialect"
+	"github.com/jinzhu/gorm"
+)
+
+// Migrations are the schema changes to the ddr tables made since the
+// baseline. They are registered by the ddr game module.
+var Migrations = []db_builder.Migration{
+	{
+		Version: 11,
+		Name:    "ddr_chart_details",
+		Up:      ddrChartDetailsUp,
+		Down:    ddrChartDetailsDown,
+	},
+	{
+		Version: 12,
+		Name:    "ddr_song_info",
+		Up:      ddrSongInfoUp,
+		Down:    ddrSongInfoDown,
+	},
+}
+
+// chartDetailsDifficulty is the columns added to ddrSongDifficulties by
+// the chart details migration.
+type chartDetailsDifficulty struct {
+	Stream       int16 `gorm:"column:stream"`
+	Voltage      int16 `gorm:"column:voltage"`
+	Air          int16 `gorm:"column:air"`
+	Freeze       int16 `gorm:"column:freeze"`
+	Chaos        int16 `gorm:"column:chaos"`
+	Notes        int   `gorm:"column:notes"`
+	FreezeArrows int   `gorm:"column:freeze_arrows"`
+	ShockArrows  int   `gorm:"column:shock_arrows"`
+}
+
+func (chartDetailsDifficulty) TableName() string {
+	return "ddrSongDifficulties"
+}
+
+// ddrChartDetailsUp adds the groove radar and step counts of each chart.
+func ddrChartDetailsUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&chartDetailsDifficulty{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func ddrChartDetailsDown(tx *gorm.DB) (errs []error) {
+	// sqlite cannot drop columns, the unused columns are left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	for _, column := range []string{"stream", "voltage", "air", "freeze", "chaos", "notes", "freeze_arrows", "shock_arrows"} {
+		errors := tx.Model(&chartDetailsDifficulty{}).DropColumn(column).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
+
+// songInfoSong is the columns added to ddrSongs by the song info
+// migration.
+type songInfoSong struct {
+	MinBpm       int16  `gorm:"column:min_bpm"`
+	MaxBpm       int16  `gorm:"column:max_bpm"`
+	Version      string `gorm:"column:version"`
+	Availability string `gorm:"column:availability"`
+}
+
+func (songInfoSong) TableName() string {
+	return "ddrSongs"
+}
+
+// ddrSongInfoUp adds the bpm, version and availability of each song.
+func ddrSongInfoUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&songInfoSong{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func ddrSongInfoDown(tx *gorm.DB) (errs []error) {
+	// sqlite cannot drop columns, the unused columns are left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	for _, column := range []string{"min_bpm", "max_bpm", "version", "availability"} {
+		errors := tx.Model(&songInfoSong{}).DropColumn(column).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
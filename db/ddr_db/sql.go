@@ -3,10 +3,10 @@ package ddr_db
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/chris-sg/bst_api/db/db_dialect"
 	"github.com/chris-sg/bst_api/models/ddr_models"
 	"github.com/golang/glog"
 	"github.com/jinzhu/gorm"
-	"github.com/lib/pq"
 	"strconv"
 	"strings"
 	"time"
@@ -18,12 +18,14 @@ type DdrDbCommunication interface {
 	RetrieveSongsById(songIds []string, ordering []string) (songs []ddr_models.Song, errs []error)
 	RetrieveJacketForSongId(songId string) (jacket string, errs []error)
 	RetrieveJacketsForSongIds(songIds []string) (jackets map[string] string, errs []error)
+	UpdateSongInfo(songs []ddr_models.Song) (errs []error)
 
 	AddDifficulties(difficulties []ddr_models.SongDifficulty) (errs []error)
 	RetrieveDifficulties() (difficulties []ddr_models.SongDifficulty, errs []error)
 	RetrieveValidDifficulties() (difficulties []ddr_models.SongDifficulty, errs []error)
 	RetrieveDifficultiesById(songIds []string) (difficulties []ddr_models.SongDifficulty, errs []error)
 	RetrieveValidDifficultiesById(songIds []string) (difficulties []ddr_models.SongDifficulty, errs []error)
+	UpdateChartDetails(charts []ddr_models.SongDifficulty) (errs []error)
 
 	AddPlayerDetails(details ddr_models.PlayerDetails) (errs []error)
 	RetrievePlayerDetailsByEaGateUser(eaGateUser string) (details ddr_models.PlayerDetails, exists bool, errs []error)
@@ -46,14 +48,18 @@ type DdrDbCommunication interface {
 	RetrieveWorkoutDataByPlayerCodeInDateRange(code int, startDate time.Time, endDate time.Time) (workoutData []ddr_models.WorkoutData, errs []error)
 
 	RetrieveExtendedScoreStatisticsByPlayerCode(code int) (statisticsJson string, errs []error)
+
+	Transaction(fn func(tx DdrDbCommunication) (errs []error)) (errs []error)
 }
 
 func CreateDdrDbCommunicationPostgres(db *gorm.DB) DdrDbCommunicationPostgres {
-	return DdrDbCommunicationPostgres{db}
+	return DdrDbCommunicationPostgres{db: db}
 }
 
 type DdrDbCommunicationPostgres struct {
 	db *gorm.DB
+
+	inTransaction bool
 }
 
 const maxBatchSize = 100
@@ -75,7 +81,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddSongs(songs []ddr_models.Song) (errs
 	processedCount := 0
 	statements := make([]string, 0)
 	var statement string
-	statementBegin := `INSERT INTO public."ddrSongs" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "ddrSongs") + ` (id, name, artist, image) VALUES `
 	statementEnd := ` ON CONFLICT DO NOTHING;`
 	for i := len(songs)-1; i >= 0; i-- {
 		statement = fmt.Sprintf("%s ('%s', '%s', '%s', '%s')", statement, songs[i].Id, cleanString(songs[i].Name), cleanString(songs[i].Artist), songs[i].Image)
@@ -86,6 +92,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddSongs(songs []ddr_models.Song) (errs
 			statement = fmt.Sprintf("%s%s%s", statementBegin, statement, statementEnd)
 			statements = append(statements, statement)
 			statement = ""
+			batchCount = 0
 		} else {
 			statement = fmt.Sprintf("%s,", statement)
 		}
@@ -101,7 +108,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddSongs(songs []ddr_models.Song) (errs
 		totalRowsAffected += resultDb.RowsAffected
 	}
 	glog.Infof("AddSongs: %d rows affected", totalRowsAffected)
-	return nil
+	return
 }
 
 func (dbcomm DdrDbCommunicationPostgres) RetrieveSongIds() (songIds []string, errs []error) {
@@ -116,7 +123,7 @@ func (dbcomm DdrDbCommunicationPostgres) RetrieveSongIds() (songIds []string, er
 
 func (dbcomm DdrDbCommunicationPostgres) RetrieveSongsById(songIds []string, ordering []string) (songs []ddr_models.Song, errs []error) {
 	glog.Infof("RetrieveSongsByIds for %d ids\n", len(songIds))
-	resultDb := dbcomm.db.Model(&ddr_models.Song{}).Select([]string{"id", "name", "artist"}).Where("id IN (?)", songIds)
+	resultDb := dbcomm.db.Model(&ddr_models.Song{}).Select([]string{"id", "name", "artist", "min_bpm", "max_bpm", "version", "availability"}).Where("id IN (?)", songIds)
 	for _, order := range ordering {
 		resultDb = resultDb.Order(order)
 	}
@@ -128,6 +135,29 @@ func (dbcomm DdrDbCommunicationPostgres) RetrieveSongsById(songIds []string, ord
 	return
 }
 
+func (dbcomm DdrDbCommunicationPostgres) UpdateSongInfo(songs []ddr_models.Song) (errs []error) {
+	glog.Infof("UpdateSongInfo for %d songs\n", len(songs))
+	totalRowsAffected := int64(0)
+	for _, song := range songs {
+		resultDb := dbcomm.db.Model(&ddr_models.Song{}).
+			Where("id = ?", song.Id).
+			Updates(map[string]interface{}{
+				"min_bpm":      song.MinBpm,
+				"max_bpm":      song.MaxBpm,
+				"version":      song.Version,
+				"availability": song.Availability,
+			})
+		errors := resultDb.GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+		totalRowsAffected += resultDb.RowsAffected
+	}
+	glog.Infof("UpdateSongInfo: %d rows affected\n", totalRowsAffected)
+	return
+}
+
 func (dbcomm DdrDbCommunicationPostgres) RetrieveJacketForSongId(songId string) (jacket string, errs []error) {
 	glog.Infof("getting for id %s\n", songId)
 
@@ -188,7 +218,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddDifficulties(difficulties []ddr_mode
 	processedCount := 0
 	statements := make([]string, 0)
 	var statement string
-	statementBegin := `INSERT INTO public."ddrSongDifficulties" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "ddrSongDifficulties") + ` (song_id, mode, difficulty, difficulty_value) VALUES `
 	statementEnd := ` ON CONFLICT (song_id, mode, difficulty) DO UPDATE SET difficulty_value=EXCLUDED.difficulty_value;`
 	for i := range difficulties {
 		statement = fmt.Sprintf("%s ('%s', '%s', '%s', %d)",
@@ -204,6 +234,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddDifficulties(difficulties []ddr_mode
 			statement = fmt.Sprintf("%s%s%s", statementBegin, statement, statementEnd)
 			statements = append(statements, statement)
 			statement = ""
+			batchCount = 0
 		} else {
 			statement = fmt.Sprintf("%s,", statement)
 		}
@@ -222,6 +253,35 @@ func (dbcomm DdrDbCommunicationPostgres) AddDifficulties(difficulties []ddr_mode
 	return
 }
 
+// UpdateChartDetails will set the groove radar and step counts of
+// charts already in the database. Difficulty values are left unchanged.
+func (dbcomm DdrDbCommunicationPostgres) UpdateChartDetails(charts []ddr_models.SongDifficulty) (errs []error) {
+	glog.Infof("UpdateChartDetails for %d charts\n", len(charts))
+	totalRowsAffected := int64(0)
+	for _, chart := range charts {
+		resultDb := dbcomm.db.Model(&ddr_models.SongDifficulty{}).
+			Where("song_id = ? AND mode = ? AND difficulty = ?", chart.SongId, chart.Mode, chart.Difficulty).
+			Updates(map[string]interface{}{
+				"stream":        chart.Stream,
+				"voltage":       chart.Voltage,
+				"air":           chart.Air,
+				"freeze":        chart.Freeze,
+				"chaos":         chart.Chaos,
+				"notes":         chart.Notes,
+				"freeze_arrows": chart.FreezeArrows,
+				"shock_arrows":  chart.ShockArrows,
+			})
+		errors := resultDb.GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+		totalRowsAffected += resultDb.RowsAffected
+	}
+	glog.Infof("UpdateChartDetails: %d rows affected\n", totalRowsAffected)
+	return
+}
+
 func (dbcomm DdrDbCommunicationPostgres) RetrieveDifficulties() (difficulties []ddr_models.SongDifficulty, errs []error) {
 	glog.Infoln("RetrieveAllSongDifficulties")
 	resultDb := dbcomm.db.Model(&ddr_models.SongDifficulty{}).Scan(&difficulties)
@@ -306,20 +366,23 @@ func (dbcomm DdrDbCommunicationPostgres) RetrievePlayerDetailsByPlayerCode(code
 
 func (dbcomm DdrDbCommunicationPostgres) AddPlaycounts(playcountDetails []ddr_models.Playcount) (errs []error) {
 	glog.Infof("AddPlaycounts adding %d datapoints\n", len(playcountDetails))
+	if len(playcountDetails) == 0 {
+		return
+	}
 
 	processedCount := 0
 	var statement string
-	statementBegin := `INSERT INTO public."ddrPlaycount" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "ddrPlaycount") + ` (playcount, last_play_date, single_playcount, last_single_play_date, double_playcount, last_double_play_date, player_code) VALUES `
 	statementEnd := ` ON CONFLICT (last_play_date, player_code) do nothing;`
 	for _, playcount := range playcountDetails {
 		statement = fmt.Sprintf("%s (%d, '%s', %d, '%s', %d, '%s', %d)",
 			statement,
 			playcount.Playcount,
-			pq.FormatTimestamp(playcount.LastPlayDate),
+			db_dialect.Timestamp(dbcomm.db, playcount.LastPlayDate),
 			playcount.SinglePlaycount,
-			pq.FormatTimestamp(playcount.SingleLastPlayDate),
+			db_dialect.Timestamp(dbcomm.db, playcount.SingleLastPlayDate),
 			playcount.DoublePlaycount,
-			pq.FormatTimestamp(playcount.DoubleLastPlayDate),
+			db_dialect.Timestamp(dbcomm.db, playcount.DoubleLastPlayDate),
 			playcount.PlayerCode)
 
 		processedCount++
@@ -364,7 +427,7 @@ func (dbcomm DdrDbCommunicationPostgres) RetrieveLatestPlaycountByPlayerCode(cod
 func (dbcomm DdrDbCommunicationPostgres) RetrievePlaycountsByPlayerCodeInDateRange(code int, startDate time.Time, endDate time.Time) (playcounts []ddr_models.Playcount, errs []error) {
 	glog.Infof("RetrievePlaycountsByPlayerCodeInDateRange for playerCode %d range %d-%d\n", code, startDate.String(), endDate.String())
 	resultDb := dbcomm.db.Model(&ddr_models.Playcount{}).Where("player_code = ?", code).
-		Where("last_play_date between ? and ?", pq.FormatTimestamp(startDate), pq.FormatTimestamp(endDate)).
+		Where("last_play_date between ? and ?", startDate, endDate).
 		Scan(&playcounts)
 
 	errors := resultDb.GetErrors()
@@ -399,7 +462,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddSongStatistics(statistics []ddr_mode
 	processedCount := 0
 	statements := make([]string, 0)
 	var statement string
-	statementBegin := `INSERT INTO public."ddrSongStatistics" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "ddrSongStatistics") + ` (score_record, clear_lamp, rank, playcount, clearcount, maxcombo, lastplayed, song_id, mode, difficulty, player_code) VALUES `
 	statementEnd := ` ON CONFLICT (song_id, mode, difficulty, player_code) DO UPDATE SET ` +
 		`score_record=EXCLUDED.score_record, ` +
 		`clear_lamp=EXCLUDED.clear_lamp, ` +
@@ -417,7 +480,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddSongStatistics(statistics []ddr_mode
 			statistics[i].PlayCount,
 			statistics[i].ClearCount,
 			statistics[i].MaxCombo,
-			pq.FormatTimestamp(statistics[i].LastPlayed),
+			db_dialect.Timestamp(dbcomm.db, statistics[i].LastPlayed),
 			statistics[i].SongId,
 			statistics[i].Mode,
 			statistics[i].Difficulty,
@@ -429,6 +492,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddSongStatistics(statistics []ddr_mode
 			statement = fmt.Sprintf("%s%s%s", statementBegin, statement, statementEnd)
 			statements = append(statements, statement)
 			statement = ""
+			batchCount = 0
 		} else {
 			statement = fmt.Sprintf("%s,", statement)
 		}
@@ -444,7 +508,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddSongStatistics(statistics []ddr_mode
 		totalRowsAffected += resultDb.RowsAffected
 	}
 	glog.Infof("AddSongStatistics for playerCode %d: %d rows affected\n", statistics[0].PlayerCode, totalRowsAffected)
-	return nil
+	return
 
 }
 
@@ -469,14 +533,14 @@ func (dbcomm DdrDbCommunicationPostgres) AddScores(scores []ddr_models.Score) (e
 	processedCount := 0
 	statements := make([]string, 0)
 	var statement string
-	statementBegin := `INSERT INTO public."ddrScores" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "ddrScores") + ` (score, cleared, time_played, song_id, mode, difficulty, player_code) VALUES `
 	statementEnd := ` ON CONFLICT DO NOTHING;`
 	for i := range scores {
 		statement = fmt.Sprintf("%s (%d, '%s', '%s', '%s', '%s', '%s', %d)",
 			statement,
 			scores[i].Score,
 			strconv.FormatBool(scores[i].ClearStatus),
-			pq.FormatTimestamp(scores[i].TimePlayed),
+			db_dialect.Timestamp(dbcomm.db, scores[i].TimePlayed),
 			scores[i].SongId,
 			scores[i].Mode,
 			scores[i].Difficulty,
@@ -488,6 +552,7 @@ func (dbcomm DdrDbCommunicationPostgres) AddScores(scores []ddr_models.Score) (e
 			statement = fmt.Sprintf("%s%s%s", statementBegin, statement, statementEnd)
 			statements = append(statements, statement)
 			statement = ""
+			batchCount = 0
 		} else {
 			statement = fmt.Sprintf("%s,", statement)
 		}
@@ -552,14 +617,17 @@ func (dbcomm DdrDbCommunicationPostgres) RetrieveSongScores(code int, songId str
 
 func (dbcomm DdrDbCommunicationPostgres) AddWorkoutData(workoutData []ddr_models.WorkoutData) (errs []error) {
 	glog.Infof("AddWorkoutData: %d data points\n", len(workoutData))
+	if len(workoutData) == 0 {
+		return
+	}
 	processedCount := 0
 	var statement string
-	statementBegin := `INSERT INTO public."ddrWorkoutData" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "ddrWorkoutData") + ` (date, playcount, kcal, player_code) VALUES `
 	statementEnd := ` ON CONFLICT (date, player_code) DO UPDATE SET playcount=EXCLUDED.playcount, kcal=EXCLUDED.kcal;`
 	for i := range workoutData {
 		statement = fmt.Sprintf("%s ('%s', '%d', '%f', %d)",
 			statement,
-			pq.FormatTimestamp(workoutData[i].Date),
+			db_dialect.Timestamp(dbcomm.db, workoutData[i].Date),
 			workoutData[i].PlayCount,
 			workoutData[i].Kcal,
 			workoutData[i].PlayerCode)
@@ -621,13 +689,24 @@ type DdrStatisticsTable struct {
 	ClearCount int `gorm:"column:clearcount" json:"clearcount"`
 	MaxCombo int `gorm:"column:maxcombo" json:"maxcombo"`
 	Id string `gorm:"column:id" json:"id"`
+	Stream int `json:"stream"`
+	Voltage int `json:"voltage"`
+	Air int `json:"air"`
+	Freeze int `json:"freeze"`
+	Chaos int `json:"chaos"`
+	Notes int `json:"notes"`
+	FreezeArrows int `gorm:"column:freeze_arrows" json:"freezearrows"`
+	ShockArrows int `gorm:"column:shock_arrows" json:"shockarrows"`
+	Version string `json:"version"`
+	MinBpm int `gorm:"column:min_bpm" json:"minbpm"`
+	MaxBpm int `gorm:"column:max_bpm" json:"maxbpm"`
 }
 
 func (dbcomm DdrDbCommunicationPostgres) RetrieveExtendedScoreStatisticsByPlayerCode(code int) (statisticsJson string, errs []error) {
 	stats := make([]DdrStatisticsTable, 0)
 
 	resultDb := dbcomm.db.
-		Table("public.\"ddrSongDifficulties\" diff").
+		Table(db_dialect.Table(dbcomm.db, "ddrSongDifficulties") + " diff").
 		Select("diff.difficulty_value as level," +
 			"diff.mode as mode," +
 			"diff.difficulty as difficulty," +
@@ -639,9 +718,20 @@ func (dbcomm DdrDbCommunicationPostgres) RetrieveExtendedScoreStatisticsByPlayer
 			"stat.playcount as playcount," +
 			"stat.clearcount as clearcount," +
 			"stat.maxcombo as maxcombo," +
-			"diff.song_id as id").
-		Joins("inner join public.\"ddrSongs\" song on diff.song_id = song.id").
-		Joins("left outer join public.\"ddrSongStatistics\" stat on " +
+			"diff.song_id as id," +
+			"diff.stream as stream," +
+			"diff.voltage as voltage," +
+			"diff.air as air," +
+			"diff.freeze as freeze," +
+			"diff.chaos as chaos," +
+			"diff.notes as notes," +
+			"diff.freeze_arrows as freeze_arrows," +
+			"diff.shock_arrows as shock_arrows," +
+			"song.version as version," +
+			"song.min_bpm as min_bpm," +
+			"song.max_bpm as max_bpm").
+		Joins("inner join " + db_dialect.Table(dbcomm.db, "ddrSongs") + " song on diff.song_id = song.id").
+		Joins("left outer join " + db_dialect.Table(dbcomm.db, "ddrSongStatistics") + " stat on " +
 			"diff.song_id = stat.song_id AND " +
 			"diff.mode = stat.mode AND " +
 			"diff.difficulty = stat.difficulty AND " +
@@ -670,6 +760,41 @@ func (dbcomm DdrDbCommunicationPostgres) RetrieveExtendedScoreStatisticsByPlayer
 	return
 }
 
+// Transaction will run fn against a DdrDbCommunication bound to a
+// single transaction, committing only if fn returns no errors. Calls
+// made while already within a transaction join the outer one.
+func (dbcomm DdrDbCommunicationPostgres) Transaction(fn func(tx DdrDbCommunication) (errs []error)) (errs []error) {
+	if dbcomm.inTransaction {
+		return fn(dbcomm)
+	}
+
+	tx := dbcomm.db.Begin()
+	errors := tx.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	errs = fn(DdrDbCommunicationPostgres{db: tx, inTransaction: true})
+	if len(errs) > 0 {
+		glog.Warningf("rolling back transaction after %d errors\n", len(errs))
+		tx.Rollback()
+		return
+	}
+
+	errors = tx.Commit().GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
 func cleanString(in string) string {
 	return strings.ReplaceAll(in, "'", "&#39;")
 }
@@ -0,0 +1,698 @@
+package drs_db
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chris-sg/bst_api/db/db_dialect"
+	"github.com/chris-sg/bst_api/db/db_memory"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func CreateDrsDbCommunicationMemory(store *db_memory.Store) DrsDbCommunicationMemory {
+	return DrsDbCommunicationMemory{store: store}
+}
+
+// DrsDbCommunicationMemory keeps all data in a db_memory.Store, with
+// the same conflict handling and ordering as the postgres queries.
+type DrsDbCommunicationMemory struct {
+	store *db_memory.Store
+
+	inTransaction bool
+}
+
+func (dbcomm DrsDbCommunicationMemory) AddPlayerDetails(details drs_models.PlayerDetails) (errs []error) {
+	details.RefreshedAt = db_memory.Timestamp(details.RefreshedAt)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for i := range tables.DrsPlayerDetails {
+			if tables.DrsPlayerDetails[i].Code == details.Code {
+				tables.DrsPlayerDetails[i] = details
+				return
+			}
+		}
+		tables.DrsPlayerDetails = append(tables.DrsPlayerDetails, details)
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) AddPlayerProfileSnapshot(snapshot drs_models.PlayerProfileSnapshot) (errs []error) {
+	snapshot.LastPlayed = db_memory.Timestamp(snapshot.LastPlayed)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for i, existing := range tables.DrsProfileSnapshots {
+			if existing.PlayerCode == snapshot.PlayerCode && existing.PlayCount == snapshot.PlayCount {
+				tables.DrsProfileSnapshots[i] = snapshot
+				return
+			}
+		}
+		tables.DrsProfileSnapshots = append(tables.DrsProfileSnapshots, snapshot)
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) AddSongs(songs []drs_models.Song) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, song := range songs {
+			song.SongName = cleanString(song.SongName)
+			song.SongYomigana = cleanString(song.SongYomigana)
+			song.ArtistName = cleanString(song.ArtistName)
+			song.ArtistYomigana = cleanString(song.ArtistYomigana)
+			song.License = cleanString(song.License)
+			for i, existing := range tables.DrsSongs {
+				if existing.SongId == song.SongId {
+					tables.DrsSongs[i].SongYomigana = song.SongYomigana
+					tables.DrsSongs[i].ArtistYomigana = song.ArtistYomigana
+					continue next
+				}
+			}
+			tables.DrsSongs = append(tables.DrsSongs, song)
+		}
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) AddDifficulties(difficulties []drs_models.Difficulty) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, difficulty := range difficulties {
+			for _, existing := range tables.DrsDifficulties {
+				if existing.SongId == difficulty.SongId &&
+					existing.Mode == difficulty.Mode &&
+					existing.Difficulty == difficulty.Difficulty {
+					continue next
+				}
+			}
+			tables.DrsDifficulties = append(tables.DrsDifficulties, difficulty)
+		}
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) AddPlayerSongStats(stats []drs_models.PlayerSongStats) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, stat := range stats {
+			stat.BestScoreDateTime = db_memory.Timestamp(stat.BestScoreDateTime)
+			stat.LastPlayDateTime = db_memory.Timestamp(stat.LastPlayDateTime)
+			for i, existing := range tables.DrsPlayerSongStats {
+				if existing.PlayerCode == stat.PlayerCode &&
+					existing.SongId == stat.SongId &&
+					existing.Mode == stat.Mode &&
+					existing.Difficulty == stat.Difficulty {
+					tables.DrsPlayerSongStats[i] = stat
+					continue next
+				}
+			}
+			tables.DrsPlayerSongStats = append(tables.DrsPlayerSongStats, stat)
+		}
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) AddPlayerScores(scores []drs_models.PlayerScore) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, score := range scores {
+			score.Shop = cleanString(score.Shop)
+			score.PlayTime = db_memory.Timestamp(score.PlayTime)
+			for _, existing := range tables.DrsPlayerScores {
+				if existing.PlayerCode == score.PlayerCode &&
+					existing.SongId == score.SongId &&
+					existing.Mode == score.Mode &&
+					existing.Difficulty == score.Difficulty &&
+					existing.PlayTime.Equal(score.PlayTime) {
+					continue next
+				}
+			}
+			tables.DrsPlayerScores = append(tables.DrsPlayerScores, score)
+		}
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePlayerDetailsByPlayerCode(code int) (details drs_models.PlayerDetails, errs []error) {
+	found := false
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, d := range tables.DrsPlayerDetails {
+			if d.Code == code {
+				details = d
+				found = true
+				return
+			}
+		}
+	})
+	if !found {
+		errs = append(errs, gorm.ErrRecordNotFound)
+	}
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePlayerDetailsByPlayerCodes(codes []int) (details []drs_models.PlayerDetails, errs []error) {
+	details = make([]drs_models.PlayerDetails, 0)
+	wanted := make(map[int]bool)
+	for _, code := range codes {
+		wanted[code] = true
+	}
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, d := range tables.DrsPlayerDetails {
+			if wanted[d.Code] {
+				details = append(details, d)
+			}
+		}
+	})
+	sort.Slice(details, func(i, j int) bool {
+		return details[i].Code < details[j].Code
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePlayerDetailsByEaGateUser(eaUser string) (details drs_models.PlayerDetails, errs []error) {
+	found := false
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, d := range tables.DrsPlayerDetails {
+			if d.EaGateUser != nil && *d.EaGateUser == eaUser {
+				details = d
+				found = true
+				return
+			}
+		}
+	})
+	if !found {
+		errs = append(errs, gorm.ErrRecordNotFound)
+	}
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveRecentPlayerProfileSnapshot(code int) (snapshot drs_models.PlayerProfileSnapshot, errs []error) {
+	found := false
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, s := range tables.DrsProfileSnapshots {
+			if s.PlayerCode == code && (!found || s.PlayCount > snapshot.PlayCount) {
+				snapshot = s
+				found = true
+			}
+		}
+	})
+	if !found {
+		errs = append(errs, gorm.ErrRecordNotFound)
+	}
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePlayerProfileSnapshots(code int, dateFrom time.Time, dateTo time.Time) (snapshots []drs_models.PlayerProfileSnapshot, errs []error) {
+	snapshots = make([]drs_models.PlayerProfileSnapshot, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, s := range tables.DrsProfileSnapshots {
+			if s.PlayerCode == code && db_memory.Between(s.LastPlayed, dateFrom, dateTo) {
+				snapshots = append(snapshots, s)
+			}
+		}
+	})
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].PlayCount < snapshots[j].PlayCount
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePlayerProfileSnapshotBefore(code int, before time.Time) (snapshot drs_models.PlayerProfileSnapshot, errs []error) {
+	found := false
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, s := range tables.DrsProfileSnapshots {
+			if s.PlayerCode == code && s.LastPlayed.Before(before) && (!found || s.PlayCount > snapshot.PlayCount) {
+				snapshot = s
+				found = true
+			}
+		}
+	})
+	if !found {
+		errs = append(errs, gorm.ErrRecordNotFound)
+	}
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) AddPlayerUnlocks(unlocks []drs_models.PlayerUnlock) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, unlock := range unlocks {
+			unlock.SongId = cleanString(unlock.SongId)
+			if unlock.UnlockedAt != nil {
+				unlockedAt := db_memory.Timestamp(*unlock.UnlockedAt)
+				unlock.UnlockedAt = &unlockedAt
+			}
+			for _, existing := range tables.DrsPlayerUnlocks {
+				if existing.PlayerCode == unlock.PlayerCode && existing.SongId == unlock.SongId {
+					continue next
+				}
+			}
+			tables.DrsPlayerUnlocks = append(tables.DrsPlayerUnlocks, unlock)
+		}
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveSongs() (songs []drs_models.Song, errs []error) {
+	songs = make([]drs_models.Song, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, song := range tables.DrsSongs {
+			song.SongName = fixString(song.SongName)
+			song.SongYomigana = fixString(song.SongYomigana)
+			song.ArtistName = fixString(song.ArtistName)
+			song.ArtistYomigana = fixString(song.ArtistYomigana)
+			song.License = fixString(song.License)
+			songs = append(songs, song)
+		}
+	})
+	sort.SliceStable(songs, func(i, j int) bool {
+		return songs[i].SongId < songs[j].SongId
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePlayerUnlocks(code int) (unlocks []drs_models.PlayerUnlock, errs []error) {
+	unlocks = make([]drs_models.PlayerUnlock, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, unlock := range tables.DrsPlayerUnlocks {
+			if unlock.PlayerCode == code {
+				unlock.SongId = fixString(unlock.SongId)
+				unlocks = append(unlocks, unlock)
+			}
+		}
+	})
+	sort.SliceStable(unlocks, func(i, j int) bool {
+		a, b := unlocks[i].UnlockedAt, unlocks[j].UnlockedAt
+		if (a == nil) != (b == nil) {
+			return a == nil
+		}
+		if a != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return unlocks[i].SongId < unlocks[j].SongId
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePublicPlayerCodes() (codes []int, errs []error) {
+	codes = make([]int, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, details := range tables.DrsPlayerDetails {
+			if details.EaGateUser == nil {
+				continue
+			}
+			public := false
+			for _, u := range tables.Users {
+				if u.Name != *details.EaGateUser {
+					continue
+				}
+				for _, p := range tables.Profiles {
+					if strings.ToLower(p.User) == u.WebUser && p.Public {
+						public = true
+					}
+				}
+			}
+			if public {
+				codes = append(codes, details.Code)
+			}
+		}
+	})
+	sort.Ints(codes)
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePublicShopActivity() (shops []ShopActivity, errs []error) {
+	codes, errs := dbcomm.RetrievePublicPlayerCodes()
+	public := make(map[int]bool)
+	for _, code := range codes {
+		public[code] = true
+	}
+
+	activity := make(map[string]*ShopActivity)
+	plays := make(map[string]bool)
+	players := make(map[string]bool)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, score := range tables.DrsPlayerScores {
+			if !public[score.PlayerCode] {
+				continue
+			}
+			shop, exists := activity[score.Shop]
+			if !exists {
+				shop = &ShopActivity{Shop: score.Shop}
+				activity[score.Shop] = shop
+			}
+			play := fmt.Sprintf("%s/%s/%s/%s/%s", score.Shop, score.PlayTime, score.SongId, score.Mode, score.Difficulty)
+			if !plays[play] {
+				plays[play] = true
+				shop.Plays++
+			}
+			player := fmt.Sprintf("%s/%d", score.Shop, score.PlayerCode)
+			if !players[player] {
+				players[player] = true
+				shop.Players++
+			}
+			if score.PlayTime.After(shop.LastVisit) {
+				shop.LastVisit = score.PlayTime
+			}
+		}
+	})
+
+	shops = make([]ShopActivity, 0, len(activity))
+	for _, shop := range activity {
+		shop.Shop = fixString(shop.Shop)
+		shops = append(shops, *shop)
+	}
+	sort.Slice(shops, func(i, j int) bool {
+		if shops[i].Plays != shops[j].Plays {
+			return shops[i].Plays > shops[j].Plays
+		}
+		return shops[i].Shop < shops[j].Shop
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveSongStatisticsByPlayerCode(code int) (stats []drs_models.PlayerSongStats, errs []error) {
+	stats = make([]drs_models.PlayerSongStats, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, stat := range tables.DrsPlayerSongStats {
+			if stat.PlayerCode == code {
+				stats = append(stats, stat)
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrievePlayerScores(code int) (scores []drs_models.PlayerScore, errs []error) {
+	scores = make([]drs_models.PlayerScore, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, score := range tables.DrsPlayerScores {
+			if score.PlayerCode == code {
+				scores = append(scores, score)
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveFilteredPlayerScores(code int, filter PlayerScoreFilter) (scores []drs_models.PlayerScore, total int, errs []error) {
+	scores = make([]drs_models.PlayerScore, 0)
+	orderings, err := db_dialect.ParseOrdering(filter.Ordering)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, score := range tables.DrsPlayerScores {
+			if score.PlayerCode != code {
+				continue
+			}
+			if !filter.From.IsZero() && score.PlayTime.Before(filter.From) {
+				continue
+			}
+			if !filter.To.IsZero() && score.PlayTime.After(filter.To) {
+				continue
+			}
+			if filter.SongId != "" && score.SongId != filter.SongId {
+				continue
+			}
+			if filter.Mode != "" && !strings.EqualFold(score.Mode, filter.Mode) {
+				continue
+			}
+			if filter.Difficulty != "" && !strings.EqualFold(score.Difficulty, filter.Difficulty) {
+				continue
+			}
+			scores = append(scores, score)
+		}
+	})
+
+	columns := db_memory.Columns{
+		"play_time":  func(i, j int) int { return db_memory.CompareTime(scores[i].PlayTime, scores[j].PlayTime) },
+		"score":      func(i, j int) int { return db_memory.CompareInt(scores[i].Score, scores[j].Score) },
+		"max_combo":  func(i, j int) int { return db_memory.CompareInt(scores[i].MaxCombo, scores[j].MaxCombo) },
+		"shop":       func(i, j int) int { return db_memory.CompareString(scores[i].Shop, scores[j].Shop) },
+		"song_id":    func(i, j int) int { return db_memory.CompareString(scores[i].SongId, scores[j].SongId) },
+		"mode":       func(i, j int) int { return db_memory.CompareString(scores[i].Mode, scores[j].Mode) },
+		"difficulty": func(i, j int) int { return db_memory.CompareString(scores[i].Difficulty, scores[j].Difficulty) },
+	}
+	if err := db_memory.CheckColumns(orderings, columns); err != nil {
+		errs = append(errs, err)
+		scores = nil
+		return
+	}
+	if len(orderings) == 0 {
+		orderings = []db_dialect.Ordering{{Column: "play_time", Descending: true}}
+	}
+	sort.SliceStable(scores, db_memory.Less(orderings, columns))
+
+	total = len(scores)
+	if filter.Offset >= len(scores) {
+		scores = scores[:0]
+		return
+	}
+	scores = scores[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(scores) {
+		scores = scores[:filter.Limit]
+	}
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) AddArchivedVideo(video drs_models.ArchivedVideo) (errs []error) {
+	video.ArchivedAt = db_memory.Timestamp(video.ArchivedAt)
+	video.PlayTime = db_memory.Timestamp(video.PlayTime)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, existing := range tables.DrsArchivedVideos {
+			if existing.VideoUrl == video.VideoUrl {
+				errs = append(errs, fmt.Errorf("duplicate key value violates unique constraint on video_url %s", video.VideoUrl))
+				return
+			}
+		}
+		tables.LastArchivedVideoId++
+		video.Id = tables.LastArchivedVideoId
+		tables.DrsArchivedVideos = append(tables.DrsArchivedVideos, video)
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) DeleteArchivedVideo(id int) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		videos := tables.DrsArchivedVideos[:0]
+		for _, video := range tables.DrsArchivedVideos {
+			if video.Id != id {
+				videos = append(videos, video)
+			}
+		}
+		tables.DrsArchivedVideos = videos
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveArchivedVideo(id int) (video drs_models.ArchivedVideo, errs []error) {
+	found := false
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, v := range tables.DrsArchivedVideos {
+			if v.Id == id {
+				video = v
+				found = true
+				return
+			}
+		}
+	})
+	if !found {
+		errs = append(errs, gorm.ErrRecordNotFound)
+	}
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveArchivedVideos(code int) (videos []drs_models.ArchivedVideo, errs []error) {
+	videos = make([]drs_models.ArchivedVideo, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, video := range tables.DrsArchivedVideos {
+			if code == 0 || video.PlayerCode == code {
+				videos = append(videos, video)
+			}
+		}
+	})
+	sort.SliceStable(videos, func(i, j int) bool {
+		return videos[i].ArchivedAt.Before(videos[j].ArchivedAt)
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveUnarchivedVideoScores(since time.Time) (scores []drs_models.PlayerScore, errs []error) {
+	scores = make([]drs_models.PlayerScore, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+	next:
+		for _, score := range tables.DrsPlayerScores {
+			if score.VideoUrl == nil || *score.VideoUrl == "" || score.PlayTime.Before(since) {
+				continue
+			}
+			for _, video := range tables.DrsArchivedVideos {
+				if video.VideoUrl == *score.VideoUrl {
+					continue next
+				}
+			}
+			scores = append(scores, score)
+		}
+	})
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].PlayTime.Before(scores[j].PlayTime)
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveVideoCatalog(code int) (entries []VideoCatalogEntry, errs []error) {
+	entries = make([]VideoCatalogEntry, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, score := range tables.DrsPlayerScores {
+			if score.PlayerCode != code || score.VideoUrl == nil || *score.VideoUrl == "" {
+				continue
+			}
+			var song *drs_models.Song
+			for i := range tables.DrsSongs {
+				if tables.DrsSongs[i].SongId == score.SongId {
+					song = &tables.DrsSongs[i]
+					break
+				}
+			}
+			var difficulty *drs_models.Difficulty
+			for i := range tables.DrsDifficulties {
+				d := &tables.DrsDifficulties[i]
+				if d.SongId == score.SongId && d.Mode == score.Mode && d.Difficulty == score.Difficulty {
+					difficulty = d
+					break
+				}
+			}
+			if song == nil || difficulty == nil {
+				continue
+			}
+
+			entry := VideoCatalogEntry{
+				SongId:     score.SongId,
+				Title:      fixString(song.SongName),
+				Artist:     fixString(song.ArtistName),
+				Mode:       score.Mode,
+				Difficulty: score.Difficulty,
+				Level:      difficulty.Level,
+				Score:      score.Score,
+				PlayTime:   score.PlayTime,
+				VideoUrl:   *score.VideoUrl,
+			}
+			for _, video := range tables.DrsArchivedVideos {
+				if video.VideoUrl == entry.VideoUrl && video.File != "" {
+					id := video.Id
+					entry.ArchiveId = &id
+					break
+				}
+			}
+			entries = append(entries, entry)
+		}
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].PlayTime.After(entries[j].PlayTime)
+	})
+	return
+}
+
+func (dbcomm DrsDbCommunicationMemory) RetrieveDataForTable(code int) (resultJson string, errs []error) {
+	stats := make([]DrsDataTable, 0)
+	levels := make([]int, 0)
+
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, difficulty := range tables.DrsDifficulties {
+			var song *drs_models.Song
+			for i := range tables.DrsSongs {
+				if tables.DrsSongs[i].SongId == difficulty.SongId {
+					song = &tables.DrsSongs[i]
+					break
+				}
+			}
+			if song == nil {
+				continue
+			}
+
+			row := DrsDataTable{
+				Title:          fixString(song.SongName),
+				TitleYomigana:  fixString(song.SongYomigana),
+				Artist:         fixString(song.ArtistName),
+				ArtistYomigana: fixString(song.ArtistYomigana),
+				Mode:           difficulty.Mode,
+				Difficulty:     difficulty.Difficulty,
+				Level:          strconv.Itoa(difficulty.Level),
+				SongId:         difficulty.SongId,
+			}
+			for _, stat := range tables.DrsPlayerSongStats {
+				if stat.PlayerCode == code &&
+					stat.SongId == difficulty.SongId &&
+					stat.Mode == difficulty.Mode &&
+					stat.Difficulty == difficulty.Difficulty {
+					row.Score = stat.BestScore
+					row.PlayCount = stat.PlayCount
+					row.BestScoreDateTime = stat.BestScoreDateTime
+					row.P1Code = stat.P1Code
+					row.P1Perfects = stat.P1Perfects
+					row.P1Greats = stat.P1Greats
+					row.P1Goods = stat.P1Goods
+					row.P1Bads = stat.P1Bads
+					row.P2Code = intOrZero(stat.P2Code)
+					row.P2Perfects = intOrZero(stat.P2Perfects)
+					row.P2Greats = intOrZero(stat.P2Greats)
+					row.P2Goods = intOrZero(stat.P2Goods)
+					row.P2Bads = intOrZero(stat.P2Bads)
+					row.Code = stat.PlayerCode
+					row.Rank = stat.Rank
+					row.Param = stat.Param
+					break
+				}
+			}
+			stats = append(stats, row)
+			levels = append(levels, difficulty.Level)
+		}
+	})
+
+	order := make([]int, len(stats))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if stats[a].Mode != stats[b].Mode {
+			return stats[a].Mode > stats[b].Mode
+		}
+		return levels[a] < levels[b]
+	})
+	sorted := make([]DrsDataTable, 0, len(stats))
+	for _, i := range order {
+		sorted = append(sorted, stats[i])
+	}
+
+	result, err := json.Marshal(sorted)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to convert loaded extended statistics to json for code %d: %s", code, err.Error()))
+		return
+	}
+
+	resultJson = string(result)
+	return
+}
+
+// Transaction will run fn, discarding all of its changes if it returns
+// any errors. Calls made while already within a transaction join the
+// outer one.
+func (dbcomm DrsDbCommunicationMemory) Transaction(fn func(tx DrsDbCommunication) (errs []error)) (errs []error) {
+	if dbcomm.inTransaction {
+		return fn(dbcomm)
+	}
+	return dbcomm.store.Transaction(func() []error {
+		return fn(DrsDbCommunicationMemory{store: dbcomm.store, inTransaction: true})
+	})
+}
+
+func intOrZero(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
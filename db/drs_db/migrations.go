@@ -0,0 +1,305 @@
+package drs_db
+
+import (
+	"github.com/chris-sg/bst_api/db/db_builder"
+	"github.com/chris-sg/bst_api/db/db_dialect"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Migrations are the schema changes to the drs tables made since the
+// baseline. They are registered by the drs game module.
+var Migrations = []db_builder.Migration{
+	{
+		Version: 4,
+		Name:    "drs_score_history",
+		Up:      drsScoreHistoryUp,
+	},
+	{
+		Version: 5,
+		Name:    "drs_video_archive",
+		Up:      drsVideoArchiveUp,
+		Down:    drsVideoArchiveDown,
+	},
+	{
+		Version: 6,
+		Name:    "drs_unlocks",
+		Up:      drsUnlocksUp,
+		Down:    drsUnlocksDown,
+	},
+	{
+		Version: 7,
+		Name:    "drs_grades",
+		Up:      drsGradesUp,
+		Down:    drsGradesDown,
+	},
+	{
+		Version: 8,
+		Name:    "drs_song_readings",
+		Up:      drsSongReadingsUp,
+		Down:    drsSongReadingsDown,
+	},
+	{
+		Version: 13,
+		Name:    "drs_unknown_unlock_times",
+		Up:      drsUnknownUnlockTimesUp,
+	},
+}
+
+// scoreHistoryPlayerScore is drsPlayerScores as rebuilt on sqlite by
+// the score history migration, with play_time in its key.
+type scoreHistoryPlayerScore struct {
+	Shop     string    `gorm:"column:shop"`
+	Score    int       `gorm:"column:score"`
+	MaxCombo int       `gorm:"column:max_combo"`
+	Param    int       `gorm:"column:param"`
+	PlayTime time.Time `gorm:"column:play_time;primary_key"`
+
+	P1Code     int `gorm:"column:p1_code"`
+	P1Score    int `gorm:"column:p1_score"`
+	P1Perfects int `gorm:"column:p1_perfects"`
+	P1Greats   int `gorm:"column:p1_greats"`
+	P1Goods    int `gorm:"column:p1_goods"`
+	P1Bads     int `gorm:"column:p1_bads"`
+
+	P2Code     *int `gorm:"column:p2_code"`
+	P2Score    *int `gorm:"column:p2_score"`
+	P2Perfects *int `gorm:"column:p2_perfects"`
+	P2Greats   *int `gorm:"column:p2_greats"`
+	P2Goods    *int `gorm:"column:p2_goods"`
+	P2Bads     *int `gorm:"column:p2_bads"`
+
+	VideoUrl *string `gorm:"column:video_url"`
+
+	PlayerCode int    `gorm:"column:player_code;primary_key;auto_increment:false"`
+	SongId     string `gorm:"column:song_id;primary_key"`
+	Mode       string `gorm:"column:mode;primary_key"`
+	Difficulty string `gorm:"column:difficulty;primary_key"`
+}
+
+func (scoreHistoryPlayerScore) TableName() string {
+	return "drsPlayerScores"
+}
+
+// drsScoreHistoryUp adds play_time to the drsPlayerScores primary key.
+// Previously only the first play of each chart was kept, as every later
+// play conflicted with it. This cannot be reversed without discarding
+// history, so there is no down migration.
+func drsScoreHistoryUp(tx *gorm.DB) (errs []error) {
+	table := db_dialect.Table(tx, "drsPlayerScores")
+	statements := []string{
+		`ALTER TABLE ` + table + ` DROP CONSTRAINT IF EXISTS "drsPlayerScores_pkey"`,
+		`ALTER TABLE ` + table + ` ADD PRIMARY KEY (player_code, song_id, mode, difficulty, play_time)`,
+	}
+
+	// sqlite cannot change a primary key, so the table is rebuilt
+	if db_dialect.IsSqlite(tx) {
+		columns := `shop, score, max_combo, param, play_time, ` +
+			`p1_code, p1_score, p1_perfects, p1_greats, p1_goods, p1_bads, ` +
+			`p2_code, p2_score, p2_perfects, p2_greats, p2_goods, p2_bads, ` +
+			`video_url, player_code, song_id, mode, difficulty`
+		statements = []string{
+			`ALTER TABLE "drsPlayerScores" RENAME TO "drsPlayerScores_old"`,
+		}
+		errors := db_builder.ExecAll(tx, statements)
+		if len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+		errors = tx.CreateTable(&scoreHistoryPlayerScore{}).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+		statements = []string{
+			`INSERT INTO "drsPlayerScores" (` + columns + `) SELECT ` + columns + ` FROM "drsPlayerScores_old"`,
+			`DROP TABLE "drsPlayerScores_old"`,
+		}
+	}
+
+	errors := db_builder.ExecAll(tx, statements)
+	if len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// videoArchiveVideo is drsArchivedVideos as created by the video archive
+// migration.
+type videoArchiveVideo struct {
+	Id         int       `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	VideoUrl   string    `gorm:"column:video_url;unique_index"`
+	PlayerCode int       `gorm:"column:player_code;index"`
+	File       string    `gorm:"column:file"`
+	Size       int64     `gorm:"column:size"`
+	PlayTime   time.Time `gorm:"column:play_time"`
+	ArchivedAt time.Time `gorm:"column:archived_at"`
+}
+
+func (videoArchiveVideo) TableName() string {
+	return "drsArchivedVideos"
+}
+
+func drsVideoArchiveUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&videoArchiveVideo{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func drsVideoArchiveDown(tx *gorm.DB) (errs []error) {
+	errors := tx.DropTableIfExists(&videoArchiveVideo{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// unlocksUnlock is drsPlayerUnlocks as created by the unlocks migration.
+type unlocksUnlock struct {
+	UnlockedAt time.Time `gorm:"column:unlocked_at"`
+	PlayerCode int       `gorm:"column:player_code;primary_key;auto_increment:false"`
+	SongId     string    `gorm:"column:song_id;primary_key"`
+}
+
+func (unlocksUnlock) TableName() string {
+	return "drsPlayerUnlocks"
+}
+
+// unlocksSnapshot is the columns added to drsPlayerProfileSnapshots by
+// the unlocks migration.
+type unlocksSnapshot struct {
+	StarLimit   int `gorm:"column:star_limit"`
+	VoteRights1 int `gorm:"column:vote_rights_1"`
+	VoteRights2 int `gorm:"column:vote_rights_2"`
+}
+
+func (unlocksSnapshot) TableName() string {
+	return "drsPlayerProfileSnapshots"
+}
+
+// drsUnlocksUp adds the songs each player has unlocked, and the star
+// limit and camp vote rights to profile snapshots.
+func drsUnlocksUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&unlocksUnlock{}, &unlocksSnapshot{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func drsUnlocksDown(tx *gorm.DB) (errs []error) {
+	errors := tx.DropTableIfExists(&unlocksUnlock{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+
+	// sqlite cannot drop columns, the unused columns are left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	for _, column := range []string{"star_limit", "vote_rights_1", "vote_rights_2"} {
+		errors = tx.Model(&unlocksSnapshot{}).DropColumn(column).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
+
+// gradesSongStats and gradesScore are the columns added to
+// drsPlayerSongStats and drsPlayerScores by the grades migration.
+type gradesSongStats struct {
+	Rank int `gorm:"column:rank"`
+}
+
+func (gradesSongStats) TableName() string {
+	return "drsPlayerSongStats"
+}
+
+type gradesScore struct {
+	Rank int `gorm:"column:rank"`
+}
+
+func (gradesScore) TableName() string {
+	return "drsPlayerScores"
+}
+
+// drsGradesUp adds the rank of the best score and of each play.
+func drsGradesUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&gradesSongStats{}, &gradesScore{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func drsGradesDown(tx *gorm.DB) (errs []error) {
+	// sqlite cannot drop columns, the unused columns are left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	for _, model := range []interface{}{&gradesSongStats{}, &gradesScore{}} {
+		errors := tx.Model(model).DropColumn("rank").GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
+
+// songReadingsSong is the columns added to drsSongs by the song readings
+// migration.
+type songReadingsSong struct {
+	SongYomigana   string `gorm:"column:title_yomigana"`
+	ArtistYomigana string `gorm:"column:artist_yomigana"`
+}
+
+func (songReadingsSong) TableName() string {
+	return "drsSongs"
+}
+
+// drsSongReadingsUp adds the yomigana of song titles and artists.
+func drsSongReadingsUp(tx *gorm.DB) (errs []error) {
+	errors := tx.AutoMigrate(&songReadingsSong{}).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func drsSongReadingsDown(tx *gorm.DB) (errs []error) {
+	// sqlite cannot drop columns, the unused columns are left in place
+	if db_dialect.IsSqlite(tx) {
+		return
+	}
+	for _, column := range []string{"title_yomigana", "artist_yomigana"} {
+		errors := tx.Model(&songReadingsSong{}).DropColumn(column).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
+
+// drsUnknownUnlockTimesUp clears the time of the unlocks recorded by
+// each player's first refresh. Those were stamped with the last play of
+// that refresh, though they could have been unlocked at any time
+// before. The times are not kept, so there is no down migration.
+func drsUnknownUnlockTimesUp(tx *gorm.DB) (errs []error) {
+	table := db_dialect.Table(tx, "drsPlayerUnlocks")
+	statements := []string{
+		`UPDATE ` + table + ` SET unlocked_at = NULL WHERE (player_code, unlocked_at) IN ` +
+			`(SELECT player_code, MIN(unlocked_at) FROM ` + table + ` GROUP BY player_code)`,
+	}
+	errors := db_builder.ExecAll(tx, statements)
+	if len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
@@ -3,10 +3,10 @@ package drs_db
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/chris-sg/bst_api/db/db_dialect"
 	"github.com/chris-sg/bst_api/models/drs_models"
 	"github.com/golang/glog"
 	"github.com/jinzhu/gorm"
-	"github.com/lib/pq"
 	"strings"
 	"time"
 )
@@ -18,25 +18,43 @@ type DrsDbCommunication interface {
 	AddDifficulties(songs []drs_models.Difficulty) (errs []error)
 	AddPlayerSongStats(stats []drs_models.PlayerSongStats) (errs []error)
 	AddPlayerScores(scores []drs_models.PlayerScore) (errs []error)
+	AddPlayerUnlocks(unlocks []drs_models.PlayerUnlock) (errs []error)
 
 	RetrievePlayerDetailsByPlayerCode(code int) (details drs_models.PlayerDetails, errs []error)
+	RetrievePlayerDetailsByPlayerCodes(codes []int) (details []drs_models.PlayerDetails, errs []error)
 	RetrievePlayerDetailsByEaGateUser(eaUser string) (details drs_models.PlayerDetails, errs []error)
 	RetrieveRecentPlayerProfileSnapshot(code int) (snapshot drs_models.PlayerProfileSnapshot, errs []error)
-	//RetrievePlayerProfileSnapshots(code int, dateFrom time.Time, dateTo time.Time) (snapshots []drs_models.PlayerProfileSnapshot, errs []error)
-	//RetrieveSongs() (songs []drs_models.Song, errs []error)
+	RetrievePlayerProfileSnapshots(code int, dateFrom time.Time, dateTo time.Time) (snapshots []drs_models.PlayerProfileSnapshot, errs []error)
+	RetrievePlayerProfileSnapshotBefore(code int, before time.Time) (snapshot drs_models.PlayerProfileSnapshot, errs []error)
+	RetrieveSongs() (songs []drs_models.Song, errs []error)
 	//RetrieveDifficulties(songs []drs_models.Song) (difficulties []drs_models.Difficulty, errs []error)
 	RetrieveSongStatisticsByPlayerCode(code int) (stats []drs_models.PlayerSongStats, errs []error)
-	//RetrievePlayerScores(code int) (scores []drs_models.PlayerScore, errs []error)
+	RetrievePlayerScores(code int) (scores []drs_models.PlayerScore, errs []error)
+	RetrieveFilteredPlayerScores(code int, filter PlayerScoreFilter) (scores []drs_models.PlayerScore, total int, errs []error)
+	RetrievePlayerUnlocks(code int) (unlocks []drs_models.PlayerUnlock, errs []error)
+	RetrievePublicPlayerCodes() (codes []int, errs []error)
+	RetrievePublicShopActivity() (shops []ShopActivity, errs []error)
 
 	RetrieveDataForTable(code int) (json string, errs []error)
+
+	AddArchivedVideo(video drs_models.ArchivedVideo) (errs []error)
+	DeleteArchivedVideo(id int) (errs []error)
+	RetrieveArchivedVideo(id int) (video drs_models.ArchivedVideo, errs []error)
+	RetrieveArchivedVideos(code int) (videos []drs_models.ArchivedVideo, errs []error)
+	RetrieveUnarchivedVideoScores(since time.Time) (scores []drs_models.PlayerScore, errs []error)
+	RetrieveVideoCatalog(code int) (entries []VideoCatalogEntry, errs []error)
+
+	Transaction(fn func(tx DrsDbCommunication) (errs []error)) (errs []error)
 }
 
 func CreateDrsDbCommunicationPostgres(db *gorm.DB) DrsDbCommunicationPostgres {
-	return DrsDbCommunicationPostgres{db}
+	return DrsDbCommunicationPostgres{db: db}
 }
 
 type DrsDbCommunicationPostgres struct {
 	db *gorm.DB
+
+	inTransaction bool
 }
 
 const maxBatchSize = 100
@@ -74,14 +92,18 @@ func (dbcomm DrsDbCommunicationPostgres) AddSongs(songs []drs_models.Song) (errs
 	processedCount := 0
 	statements := make([]string, 0)
 	var statement string
-	statementBegin := `INSERT INTO public."drsSongs" VALUES `
-	statementEnd := ` ON CONFLICT DO NOTHING;`
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "drsSongs") + ` (song_id, name, title_yomigana, artist, artist_yomigana, max_bpm, min_bpm, limitation_type, genre, video_flags, license) VALUES `
+	statementEnd := ` ON CONFLICT (song_id) DO UPDATE SET ` +
+		`title_yomigana=EXCLUDED.title_yomigana, ` +
+		`artist_yomigana=EXCLUDED.artist_yomigana;`
 	for i := len(songs) - 1; i >= 0; i-- {
-		statement = fmt.Sprintf("%s ('%s', '%s', '%s', %d, %d, %d, %d, %d, '%s')",
+		statement = fmt.Sprintf("%s ('%s', '%s', '%s', '%s', '%s', %d, %d, %d, %d, %d, '%s')",
 			statement,
 			songs[i].SongId,
 			cleanString(songs[i].SongName),
+			cleanString(songs[i].SongYomigana),
 			cleanString(songs[i].ArtistName),
+			cleanString(songs[i].ArtistYomigana),
 			songs[i].MaxBpm,
 			songs[i].MinBpm,
 			songs[i].LimitationType,
@@ -95,6 +117,7 @@ func (dbcomm DrsDbCommunicationPostgres) AddSongs(songs []drs_models.Song) (errs
 			statement = fmt.Sprintf("%s%s%s", statementBegin, statement, statementEnd)
 			statements = append(statements, statement)
 			statement = ""
+			batchCount = 0
 		} else {
 			statement = fmt.Sprintf("%s,", statement)
 		}
@@ -110,7 +133,7 @@ func (dbcomm DrsDbCommunicationPostgres) AddSongs(songs []drs_models.Song) (errs
 		totalRowsAffected += resultDb.RowsAffected
 	}
 	glog.Infof("AddSongs: %d rows affected", totalRowsAffected)
-	return nil
+	return
 }
 
 func (dbcomm DrsDbCommunicationPostgres) AddDifficulties(difficulties []drs_models.Difficulty) (errs []error) {
@@ -120,7 +143,7 @@ func (dbcomm DrsDbCommunicationPostgres) AddDifficulties(difficulties []drs_mode
 	processedCount := 0
 	statements := make([]string, 0)
 	var statement string
-	statementBegin := `INSERT INTO public."drsDifficulties" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "drsDifficulties") + ` (mode, difficulty, level, song_id) VALUES `
 	statementEnd := ` ON CONFLICT DO NOTHING;`
 	for i := len(difficulties) - 1; i >= 0; i-- {
 		statement = fmt.Sprintf("%s ('%s', '%s', %d, '%s')", statement, difficulties[i].Mode, difficulties[i].Difficulty, difficulties[i].Level, difficulties[i].SongId)
@@ -131,6 +154,7 @@ func (dbcomm DrsDbCommunicationPostgres) AddDifficulties(difficulties []drs_mode
 			statement = fmt.Sprintf("%s%s%s", statementBegin, statement, statementEnd)
 			statements = append(statements, statement)
 			statement = ""
+			batchCount = 0
 		} else {
 			statement = fmt.Sprintf("%s,", statement)
 		}
@@ -146,7 +170,7 @@ func (dbcomm DrsDbCommunicationPostgres) AddDifficulties(difficulties []drs_mode
 		totalRowsAffected += resultDb.RowsAffected
 	}
 	glog.Infof("AddDifficulties: %d rows affected", totalRowsAffected)
-	return nil
+	return
 }
 
 func (dbcomm DrsDbCommunicationPostgres) AddPlayerSongStats(stats []drs_models.PlayerSongStats) (errs []error) {
@@ -174,11 +198,15 @@ func (dbcomm DrsDbCommunicationPostgres) AddPlayerSongStats(stats []drs_models.P
 	processedCount := 0
 	statements := make([]string, 0)
 	var statement string
-	statementBegin := `INSERT INTO public."drsPlayerSongStats" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "drsPlayerSongStats") + ` (` +
+		`best_score, combo, play_count, rank, param, best_score_time, last_play_time, ` +
+		`p1_code, p1_score, p1_perfects, p1_greats, p1_goods, p1_bads, ` +
+		`p2_code, p2_score, p2_perfects, p2_greats, p2_goods, p2_bads, player_code, song_id, mode, difficulty) VALUES `
 	statementEnd := ` ON CONFLICT (song_id, mode, difficulty, player_code) DO UPDATE SET ` +
 		`best_score=EXCLUDED.best_score, ` +
 		`combo=EXCLUDED.combo, ` +
 		`play_count=EXCLUDED.play_count, ` +
+		`rank=EXCLUDED.rank, ` +
 		`param=EXCLUDED.param, ` +
 		`best_score_time=EXCLUDED.best_score_time, ` +
 		`last_play_time=EXCLUDED.last_play_time, ` +
@@ -196,14 +224,15 @@ func (dbcomm DrsDbCommunicationPostgres) AddPlayerSongStats(stats []drs_models.P
 		`p2_bads=EXCLUDED.p2_bads;`
 
 	for i := range stats {
-		statement = fmt.Sprintf("%s (%d, %d, %d, %d, '%s', '%s', %d, %d, %d, %d, %d, %d",
+		statement = fmt.Sprintf("%s (%d, %d, %d, %d, %d, '%s', '%s', %d, %d, %d, %d, %d, %d",
 			statement,
 			stats[i].BestScore,
 			stats[i].Combo,
 			stats[i].PlayCount,
+			stats[i].Rank,
 			stats[i].Param,
-			pq.FormatTimestamp(stats[i].BestScoreDateTime),
-			pq.FormatTimestamp(stats[i].LastPlayDateTime),
+			db_dialect.Timestamp(dbcomm.db, stats[i].BestScoreDateTime),
+			db_dialect.Timestamp(dbcomm.db, stats[i].LastPlayDateTime),
 			stats[i].P1Code,
 			stats[i].P1Score,
 			stats[i].P1Perfects,
@@ -237,6 +266,7 @@ func (dbcomm DrsDbCommunicationPostgres) AddPlayerSongStats(stats []drs_models.P
 			statement = fmt.Sprintf("%s%s%s", statementBegin, statement, statementEnd)
 			statements = append(statements, statement)
 			statement = ""
+			batchCount = 0
 		} else {
 			statement = fmt.Sprintf("%s,", statement)
 		}
@@ -252,7 +282,7 @@ func (dbcomm DrsDbCommunicationPostgres) AddPlayerSongStats(stats []drs_models.P
 		totalRowsAffected += resultDb.RowsAffected
 	}
 	glog.Infof("AddPlayerSongStats for playerCode %d: %d rows affected\n", stats[0].PlayerCode, totalRowsAffected)
-	return nil
+	return
 }
 
 func (dbcomm DrsDbCommunicationPostgres) AddPlayerScores(scores []drs_models.PlayerScore) (errs []error) {
@@ -261,16 +291,20 @@ func (dbcomm DrsDbCommunicationPostgres) AddPlayerScores(scores []drs_models.Pla
 	processedCount := 0
 	statements := make([]string, 0)
 	var statement string
-	statementBegin := `INSERT INTO public."drsPlayerScores" VALUES `
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "drsPlayerScores") + ` (` +
+		`shop, score, max_combo, rank, param, play_time, ` +
+		`p1_code, p1_score, p1_perfects, p1_greats, p1_goods, p1_bads, ` +
+		`p2_code, p2_score, p2_perfects, p2_greats, p2_goods, p2_bads, video_url, player_code, song_id, mode, difficulty) VALUES `
 	statementEnd := ` ON CONFLICT DO NOTHING;`
 	for i := range scores {
-		statement = fmt.Sprintf("%s ('%s', %d, %d, %d, '%s', %d, %d, %d, %d, %d, %d",
+		statement = fmt.Sprintf("%s ('%s', %d, %d, %d, %d, '%s', %d, %d, %d, %d, %d, %d",
 			statement,
 			cleanString(scores[i].Shop),
 			scores[i].Score,
 			scores[i].MaxCombo,
+			scores[i].Rank,
 			scores[i].Param,
-			pq.FormatTimestamp(scores[i].PlayTime),
+			db_dialect.Timestamp(dbcomm.db, scores[i].PlayTime),
 			scores[i].P1Code,
 			scores[i].P1Score,
 			scores[i].P1Perfects,
@@ -310,6 +344,7 @@ func (dbcomm DrsDbCommunicationPostgres) AddPlayerScores(scores []drs_models.Pla
 			statement = fmt.Sprintf("%s%s%s", statementBegin, statement, statementEnd)
 			statements = append(statements, statement)
 			statement = ""
+			batchCount = 0
 		} else {
 			statement = fmt.Sprintf("%s,", statement)
 		}
@@ -333,7 +368,24 @@ func (dbcomm DrsDbCommunicationPostgres) AddPlayerScores(scores []drs_models.Pla
 
 func (dbcomm DrsDbCommunicationPostgres) RetrievePlayerDetailsByPlayerCode(code int) (details drs_models.PlayerDetails, errs []error) {
 	glog.Infof("Retrieve player details for code %d\n", code)
-	resultDb := dbcomm.db.Model(&drs_models.PlayerDetails{}).Where("player_code = ?", code).First(&details)
+	resultDb := dbcomm.db.Model(&drs_models.PlayerDetails{}).Where("code = ?", code).First(&details)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// RetrievePlayerDetailsByPlayerCodes will return the details of each
+// player with one of the codes, ordered by code. Unknown codes are left
+// out.
+func (dbcomm DrsDbCommunicationPostgres) RetrievePlayerDetailsByPlayerCodes(codes []int) (details []drs_models.PlayerDetails, errs []error) {
+	details = make([]drs_models.PlayerDetails, 0)
+	if len(codes) == 0 {
+		return
+	}
+	resultDb := dbcomm.db.Model(&drs_models.PlayerDetails{}).Where("code IN (?)", codes).Order("code").Find(&details)
 
 	errors := resultDb.GetErrors()
 	if errors != nil && len(errors) != 0 {
@@ -364,6 +416,35 @@ func (dbcomm DrsDbCommunicationPostgres) RetrieveRecentPlayerProfileSnapshot(cod
 	return
 }
 
+func (dbcomm DrsDbCommunicationPostgres) RetrievePlayerProfileSnapshots(code int, dateFrom time.Time, dateTo time.Time) (snapshots []drs_models.PlayerProfileSnapshot, errs []error) {
+	glog.Infof("Retrieve snapshots for code %d (%s - %s)\n", code, dateFrom.String(), dateTo.String())
+	resultDb := dbcomm.db.Model(&drs_models.PlayerProfileSnapshot{}).
+		Where("player_code = ? AND last_played BETWEEN ? AND ?", code, dateFrom, dateTo).
+		Order("play_count asc").
+		Scan(&snapshots)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// RetrievePlayerProfileSnapshotBefore will return the snapshot with the
+// highest play count last played before the given time.
+func (dbcomm DrsDbCommunicationPostgres) RetrievePlayerProfileSnapshotBefore(code int, before time.Time) (snapshot drs_models.PlayerProfileSnapshot, errs []error) {
+	resultDb := dbcomm.db.Model(&drs_models.PlayerProfileSnapshot{}).
+		Where("player_code = ? AND last_played < ?", code, before).
+		Order("play_count desc").
+		First(&snapshot)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
 func (dbcomm DrsDbCommunicationPostgres) RetrieveSongStatisticsByPlayerCode(code int) (stats []drs_models.PlayerSongStats, errs []error) {
 	glog.Infof("RetrieveSongStatisticsByPlayerCode for player code %d\n", code)
 	resultDb := dbcomm.db.Model(&drs_models.PlayerSongStats{}).Where("player_code = ?", code).Scan(&stats)
@@ -375,9 +456,166 @@ func (dbcomm DrsDbCommunicationPostgres) RetrieveSongStatisticsByPlayerCode(code
 	return
 }
 
+// AddPlayerUnlocks will add any unlocks not already recorded. Existing
+// unlocks keep the time they were first seen.
+func (dbcomm DrsDbCommunicationPostgres) AddPlayerUnlocks(unlocks []drs_models.PlayerUnlock) (errs []error) {
+	if len(unlocks) == 0 {
+		glog.Infof("AddPlayerUnlocks - no unlocks to add, aborting")
+		return
+	}
+	glog.Infof("AddPlayerUnlocks for playerCode %d (%d unlocks)\n", unlocks[0].PlayerCode, len(unlocks))
+
+	batchCount := 0
+	statements := make([]string, 0)
+	var statement string
+	statementBegin := `INSERT INTO ` + db_dialect.Table(dbcomm.db, "drsPlayerUnlocks") + ` (unlocked_at, player_code, song_id) VALUES `
+	statementEnd := ` ON CONFLICT DO NOTHING;`
+	for i := range unlocks {
+		unlockedAt := "NULL"
+		if unlocks[i].UnlockedAt != nil {
+			unlockedAt = fmt.Sprintf("'%s'", db_dialect.Timestamp(dbcomm.db, *unlocks[i].UnlockedAt))
+		}
+		statement = fmt.Sprintf("%s (%s, %d, '%s')",
+			statement,
+			unlockedAt,
+			unlocks[i].PlayerCode,
+			cleanString(unlocks[i].SongId))
+		batchCount++
+		if batchCount == maxBatchSize || i == len(unlocks)-1 {
+			statements = append(statements, statementBegin+statement+statementEnd)
+			statement = ""
+			batchCount = 0
+		} else {
+			statement = fmt.Sprintf("%s,", statement)
+		}
+	}
+
+	totalRowsAffected := int64(0)
+	for _, completeStatement := range statements {
+		resultDb := dbcomm.db.Exec(completeStatement)
+		errors := resultDb.GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+		}
+		totalRowsAffected += resultDb.RowsAffected
+	}
+	glog.Infof("AddPlayerUnlocks for playerCode %d: %d rows affected\n", unlocks[0].PlayerCode, totalRowsAffected)
+	return
+}
+
+func (dbcomm DrsDbCommunicationPostgres) RetrieveSongs() (songs []drs_models.Song, errs []error) {
+	glog.Infof("RetrieveSongs\n")
+	resultDb := dbcomm.db.Model(&drs_models.Song{}).Order("song_id asc").Scan(&songs)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	for i := range songs {
+		songs[i].SongName = fixString(songs[i].SongName)
+		songs[i].SongYomigana = fixString(songs[i].SongYomigana)
+		songs[i].ArtistName = fixString(songs[i].ArtistName)
+		songs[i].ArtistYomigana = fixString(songs[i].ArtistYomigana)
+		songs[i].License = fixString(songs[i].License)
+	}
+	return
+}
+
+// RetrievePlayerUnlocks will return the songs unlocked by a player, in
+// the order they were unlocked.
+func (dbcomm DrsDbCommunicationPostgres) RetrievePlayerUnlocks(code int) (unlocks []drs_models.PlayerUnlock, errs []error) {
+	glog.Infof("RetrievePlayerUnlocks for player code %d\n", code)
+	resultDb := dbcomm.db.Model(&drs_models.PlayerUnlock{}).
+		Where("player_code = ?", code).
+		Order("unlocked_at IS NOT NULL, unlocked_at asc, song_id asc").
+		Scan(&unlocks)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	for i := range unlocks {
+		unlocks[i].SongId = fixString(unlocks[i].SongId)
+	}
+	return
+}
+
+// RetrievePublicPlayerCodes will return the codes of every player linked
+// to a public profile.
+func (dbcomm DrsDbCommunicationPostgres) RetrievePublicPlayerCodes() (codes []int, errs []error) {
+	glog.Infof("RetrievePublicPlayerCodes\n")
+	codes = make([]int, 0)
+	resultDb := dbcomm.db.Table(db_dialect.Table(dbcomm.db, "drsPlayerDetails") + " d").
+		Joins("inner join " + db_dialect.Table(dbcomm.db, "eaGateUser") + " e on d.eagate_user = e.account_name").
+		Joins("inner join "+db_dialect.Table(dbcomm.db, "bstProfile")+" p on LOWER(p.user_sub) = e.web_user and p.public = ?", true).
+		Order("d.code").
+		Pluck("d.code", &codes)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// ShopActivity is the play at a shop across every player with a public
+// profile. A two player play by two public players counts once.
+type ShopActivity struct {
+	Shop      string    `json:"shop" gorm:"column:shop"`
+	Plays     int       `json:"plays" gorm:"column:plays"`
+	Players   int       `json:"players" gorm:"column:players"`
+	LastVisit time.Time `json:"lastvisit" gorm:"column:last_visit"`
+}
+
+// RetrievePublicShopActivity will return the play at each shop by
+// players with a public profile, most played first.
+func (dbcomm DrsDbCommunicationPostgres) RetrievePublicShopActivity() (shops []ShopActivity, errs []error) {
+	glog.Infof("RetrievePublicShopActivity\n")
+	shops = make([]ShopActivity, 0)
+	rows := make([]struct {
+		Shop      string `gorm:"column:shop"`
+		Plays     int    `gorm:"column:plays"`
+		Players   int    `gorm:"column:players"`
+		LastVisit string `gorm:"column:last_visit"`
+	}, 0)
+	resultDb := dbcomm.db.Table(db_dialect.Table(dbcomm.db, "drsPlayerScores") + " score").
+		Select("score.shop as shop, " +
+			"COUNT(DISTINCT CAST(score.play_time AS TEXT) || '/' || score.song_id || '/' || score.mode || '/' || score.difficulty) as plays, " +
+			"COUNT(DISTINCT score.player_code) as players, " +
+			"MAX(score.play_time) as last_visit").
+		Joins("inner join " + db_dialect.Table(dbcomm.db, "drsPlayerDetails") + " d on d.code = score.player_code").
+		Joins("inner join " + db_dialect.Table(dbcomm.db, "eaGateUser") + " e on d.eagate_user = e.account_name").
+		Joins("inner join "+db_dialect.Table(dbcomm.db, "bstProfile")+" p on LOWER(p.user_sub) = e.web_user and p.public = ?", true).
+		Group("score.shop").
+		Order("plays desc, shop").
+		Scan(&rows)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+	for _, row := range rows {
+		lastVisit, err := db_dialect.ParseTimestamp(dbcomm.db, row.LastVisit)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		shops = append(shops, ShopActivity{
+			Shop:      fixString(row.Shop),
+			Plays:     row.Plays,
+			Players:   row.Players,
+			LastVisit: lastVisit.UTC(),
+		})
+	}
+	return
+}
+
 type DrsDataTable struct {
 	Title string `json:"title"`
+	TitleYomigana string `json:"titleyomigana" gorm:"column:titleyomigana"`
 	Artist string `json:"artist"`
+	ArtistYomigana string `json:"artistyomigana" gorm:"column:artistyomigana"`
 	Mode string `json:"mode"`
 	Difficulty string `json:"difficulty"`
 	Level string `json:"level"`
@@ -400,23 +638,127 @@ type DrsDataTable struct {
 
 	SongId string `json:"id" gorm:"column:id"`
 	Code int `json:"code"`
+	Rank int `json:"rank"`
 	Param int `json:"param"`
 
 	//Combo
 	//LastPlayDateTime
 }
 
+func (dbcomm DrsDbCommunicationPostgres) RetrievePlayerScores(code int) (scores []drs_models.PlayerScore, errs []error) {
+	glog.Infof("RetrievePlayerScores for player code %d\n", code)
+	resultDb := dbcomm.db.Model(&drs_models.PlayerScore{}).Where("player_code = ?", code).Scan(&scores)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// PlayerScoreFilter narrows the scores returned by
+// RetrieveFilteredPlayerScores. Mode and Difficulty are matched without
+// regard to case. Zero values are not filtered on, and a
+// zero Limit returns every remaining score. Scores are ordered newest
+// first when no Ordering is given.
+type PlayerScoreFilter struct {
+	From       time.Time
+	To         time.Time
+	SongId     string
+	Mode       string
+	Difficulty string
+	Ordering   []string
+	Limit      int
+	Offset     int
+}
+
+// PlayerScoreColumns are the columns scores may be ordered by.
+var PlayerScoreColumns = []string{"play_time", "score", "max_combo", "shop", "song_id", "mode", "difficulty"}
+
+// RetrieveFilteredPlayerScores will retrieve a page of the player's
+// scores, along with the number of scores matching the filter.
+func (dbcomm DrsDbCommunicationPostgres) RetrieveFilteredPlayerScores(code int, filter PlayerScoreFilter) (scores []drs_models.PlayerScore, total int, errs []error) {
+	glog.Infof("RetrieveFilteredPlayerScores for player code %d\n", code)
+	scores = make([]drs_models.PlayerScore, 0)
+	orderings, err := db_dialect.ParseOrdering(filter.Ordering)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	chain := dbcomm.db.Model(&drs_models.PlayerScore{}).Where("player_code = ?", code)
+	if !filter.From.IsZero() {
+		chain = chain.Where("play_time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		chain = chain.Where("play_time <= ?", filter.To)
+	}
+	if filter.SongId != "" {
+		chain = chain.Where("song_id = ?", filter.SongId)
+	}
+	if filter.Mode != "" {
+		chain = chain.Where("LOWER(mode) = ?", strings.ToLower(filter.Mode))
+	}
+	if filter.Difficulty != "" {
+		chain = chain.Where("LOWER(difficulty) = ?", strings.ToLower(filter.Difficulty))
+	}
+
+	errors := chain.Count(&total).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+
+	if len(orderings) == 0 {
+		orderings = []db_dialect.Ordering{{Column: "play_time", Descending: true}}
+	}
+	for _, ordering := range orderings {
+		if !containsString(PlayerScoreColumns, ordering.Column) {
+			errs = append(errs, fmt.Errorf("column \"%s\" does not exist", ordering.Column))
+			return
+		}
+		order := ordering.Column
+		if ordering.Descending {
+			order += " desc"
+		}
+		chain = chain.Order(order)
+	}
+	if filter.Limit > 0 {
+		chain = chain.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		chain = chain.Offset(filter.Offset)
+	}
+
+	errors = chain.Scan(&scores).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func (dbcomm DrsDbCommunicationPostgres) RetrieveDataForTable(code int) (resultJson string, errs []error) {
 	stats := make([]DrsDataTable, 0)
 
 	resultDb := dbcomm.db.
-		Table("public.\"drsDifficulties\" diff").
+		Table(db_dialect.Table(dbcomm.db, "drsDifficulties") + " diff").
 		Select("diff.level as level," +
 			"diff.mode as mode," +
 			"diff.difficulty as difficulty," +
 			"diff.level as level," +
 			"song.name as title," +
+			"song.title_yomigana as titleyomigana," +
 			"song.artist as artist," +
+			"song.artist_yomigana as artistyomigana," +
 			"stat.best_score as score," +
 			"stat.play_count as playcount," +
 			"stat.best_score_time as bestscoredatetime," +
@@ -432,9 +774,10 @@ func (dbcomm DrsDbCommunicationPostgres) RetrieveDataForTable(code int) (resultJ
 			"stat.p2_bads as p2bads," +
 			"diff.song_id as id," +
 			"stat.player_code as code," +
+			"stat.rank as rank," +
 			"stat.param as param").
-		Joins("inner join public.\"drsSongs\" song on diff.song_id = song.song_id").
-		Joins("left outer join public.\"drsPlayerSongStats\" stat on " +
+		Joins("inner join " + db_dialect.Table(dbcomm.db, "drsSongs") + " song on diff.song_id = song.song_id").
+		Joins("left outer join " + db_dialect.Table(dbcomm.db, "drsPlayerSongStats") + " stat on " +
 			"diff.song_id = stat.song_id AND " +
 			"diff.mode = stat.mode AND " +
 			"diff.difficulty = stat.difficulty AND " +
@@ -450,7 +793,9 @@ func (dbcomm DrsDbCommunicationPostgres) RetrieveDataForTable(code int) (resultJ
 
 	for i := range stats {
 		stats[i].Title = fixString(stats[i].Title)
+		stats[i].TitleYomigana = fixString(stats[i].TitleYomigana)
 		stats[i].Artist = fixString(stats[i].Artist)
+		stats[i].ArtistYomigana = fixString(stats[i].ArtistYomigana)
 	}
 
 	result, err := json.Marshal(stats)
@@ -463,6 +808,167 @@ func (dbcomm DrsDbCommunicationPostgres) RetrieveDataForTable(code int) (resultJ
 	return
 }
 
+// VideoCatalogEntry is a play with a video, along with the id of the
+// archived copy of the video if there is one.
+type VideoCatalogEntry struct {
+	SongId     string    `json:"id" gorm:"column:id"`
+	Title      string    `json:"title" gorm:"column:title"`
+	Artist     string    `json:"artist" gorm:"column:artist"`
+	Mode       string    `json:"mode" gorm:"column:mode"`
+	Difficulty string    `json:"difficulty" gorm:"column:difficulty"`
+	Level      int       `json:"level" gorm:"column:level"`
+	Score      int       `json:"score" gorm:"column:score"`
+	PlayTime   time.Time `json:"playtime" gorm:"column:play_time"`
+	VideoUrl   string    `json:"videourl" gorm:"column:video_url"`
+	ArchiveId  *int      `json:"archiveid" gorm:"column:archive_id"`
+}
+
+func (dbcomm DrsDbCommunicationPostgres) AddArchivedVideo(video drs_models.ArchivedVideo) (errs []error) {
+	video.Id = 0
+	resultDb := dbcomm.db.Create(&video)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+func (dbcomm DrsDbCommunicationPostgres) DeleteArchivedVideo(id int) (errs []error) {
+	resultDb := dbcomm.db.Where("id = ?", id).Delete(&drs_models.ArchivedVideo{})
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// RetrieveArchivedVideo will return the archived video with the id.
+func (dbcomm DrsDbCommunicationPostgres) RetrieveArchivedVideo(id int) (video drs_models.ArchivedVideo, errs []error) {
+	resultDb := dbcomm.db.Model(&drs_models.ArchivedVideo{}).Where("id = ?", id).First(&video)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// RetrieveArchivedVideos will return the archived videos for a player,
+// oldest first. A code of 0 will return archived videos for all players.
+func (dbcomm DrsDbCommunicationPostgres) RetrieveArchivedVideos(code int) (videos []drs_models.ArchivedVideo, errs []error) {
+	videos = make([]drs_models.ArchivedVideo, 0)
+	resultDb := dbcomm.db.Model(&drs_models.ArchivedVideo{})
+	if code != 0 {
+		resultDb = resultDb.Where("player_code = ?", code)
+	}
+	resultDb = resultDb.Order("archived_at, id").Scan(&videos)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// RetrieveUnarchivedVideoScores will return every score played since
+// the given time with a video that has not been archived, oldest first
+// as those links expire soonest. A video shared by both players appears
+// once for each.
+func (dbcomm DrsDbCommunicationPostgres) RetrieveUnarchivedVideoScores(since time.Time) (scores []drs_models.PlayerScore, errs []error) {
+	scores = make([]drs_models.PlayerScore, 0)
+	resultDb := dbcomm.db.
+		Table(db_dialect.Table(dbcomm.db, "drsPlayerScores") + " score").
+		Select("score.*").
+		Joins("left outer join " + db_dialect.Table(dbcomm.db, "drsArchivedVideos") + " archive on " +
+			"score.video_url = archive.video_url").
+		Where("score.video_url IS NOT NULL AND score.video_url <> '' AND archive.id IS NULL AND score.play_time >= ?", since).
+		Order("score.play_time").
+		Scan(&scores)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
+
+// RetrieveVideoCatalog will return every play with a video for the
+// player, newest first.
+func (dbcomm DrsDbCommunicationPostgres) RetrieveVideoCatalog(code int) (entries []VideoCatalogEntry, errs []error) {
+	entries = make([]VideoCatalogEntry, 0)
+	resultDb := dbcomm.db.
+		Table(db_dialect.Table(dbcomm.db, "drsPlayerScores") + " score").
+		Select("score.song_id as id," +
+			"song.name as title," +
+			"song.title_yomigana as titleyomigana," +
+			"song.artist as artist," +
+			"song.artist_yomigana as artistyomigana," +
+			"score.mode as mode," +
+			"score.difficulty as difficulty," +
+			"diff.level as level," +
+			"score.score as score," +
+			"score.play_time as play_time," +
+			"score.video_url as video_url," +
+			"archive.id as archive_id").
+		Joins("inner join " + db_dialect.Table(dbcomm.db, "drsSongs") + " song on score.song_id = song.song_id").
+		Joins("inner join " + db_dialect.Table(dbcomm.db, "drsDifficulties") + " diff on " +
+			"score.song_id = diff.song_id AND " +
+			"score.mode = diff.mode AND " +
+			"score.difficulty = diff.difficulty").
+		Joins("left outer join " + db_dialect.Table(dbcomm.db, "drsArchivedVideos") + " archive on " +
+			"score.video_url = archive.video_url AND archive.file <> ''").
+		Where("score.player_code = ? AND score.video_url IS NOT NULL AND score.video_url <> ''", code).
+		Order("score.play_time desc").
+		Scan(&entries)
+
+	errors := resultDb.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+
+	for i := range entries {
+		entries[i].Title = fixString(entries[i].Title)
+		entries[i].Artist = fixString(entries[i].Artist)
+	}
+	return
+}
+
+// Transaction will run fn against a DrsDbCommunication bound to a
+// single transaction, committing only if fn returns no errors. Calls
+// made while already within a transaction join the outer one.
+func (dbcomm DrsDbCommunicationPostgres) Transaction(fn func(tx DrsDbCommunication) (errs []error)) (errs []error) {
+	if dbcomm.inTransaction {
+		return fn(dbcomm)
+	}
+
+	tx := dbcomm.db.Begin()
+	errors := tx.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	errs = fn(DrsDbCommunicationPostgres{db: tx, inTransaction: true})
+	if len(errs) > 0 {
+		glog.Warningf("rolling back transaction after %d errors\n", len(errs))
+		tx.Rollback()
+		return
+	}
+
+	errors = tx.Commit().GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+	}
+	return
+}
 
 func cleanString(in string) string {
 	return strings.ReplaceAll(in, "'", "&#39;")
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chris-sg/bst_api/db/ddr_db"
+	"github.com/chris-sg/bst_api/db/drs_db"
+	"github.com/chris-sg/bst_api/models/api_models"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	"github.com/chris-sg/bst_api/models/ddr_models"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exerciseDb runs the same operations against the current db
+// communications, recording every result so implementations can be
+// compared.
+func exerciseDb(t *testing.T) (results []string) {
+	record := func(name string, value interface{}, errs []error) {
+		if len(errs) > 0 {
+			results = append(results, fmt.Sprintf("%s: errors %d", name, len(errs)))
+			return
+		}
+		bytes, err := json.Marshal(value)
+		if err != nil {
+			t.Fatalf("%s: failed to encode result: %s", name, err.Error())
+		}
+		results = append(results, fmt.Sprintf("%s: %s", name, bytes))
+	}
+
+	base := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	ea := "player"
+	web := "auth0|web"
+
+	record("subscription", nil, GetUserDb().SetSubscriptionForUser("Player", "e-amusement ベーシックコース"))
+	record("web user", nil, GetUserDb().SetWebUserForEaUser("player", web))
+	record("cookie", nil, GetUserDb().SetCookieForUser("player", &http.Cookie{Name: "M573SSID", Value: "abc", Expires: base}))
+	user, exists, errs := GetUserDb().RetrieveUserByUserId("PLAYER")
+	record("user", []interface{}{user, exists}, errs)
+	usernames, errs := GetUserDb().RetrieveUsernamesByWebId(web)
+	record("usernames", usernames, errs)
+	helper, errs := GetUserDb().RetrieveRandomHelper()
+	record("helper", helper.Name, errs)
+
+	record("profile", nil, GetApiDb().SetProfile(bst_models.BstProfile{User: web, Nickname: "nick", Timezone: "Asia/Tokyo"}))
+	record("duplicate profile", nil, GetApiDb().SetProfile(bst_models.BstProfile{User: web}))
+	profile, errs := GetApiDb().RetrieveProfile(web)
+	record("profile read", profile, errs)
+	profile.Public = true
+	record("profile update", nil, GetApiDb().SetProfile(profile))
+	profiles, errs := GetApiDb().RetrieveUpdateableProfiles()
+	record("updateable", profiles, errs)
+
+	record("ddr songs", nil, GetDdrDb().AddSongs([]ddr_models.Song{
+		{Id: "s1", Name: "It's", Artist: "a", Image: "j1"},
+		{Id: "s2", Name: "b", Artist: "b", Image: "j2"},
+	}))
+	record("ddr songs again", nil, GetDdrDb().AddSongs([]ddr_models.Song{{Id: "s1", Name: "changed", MaxBpm: 1}}))
+	record("ddr song info", nil, GetDdrDb().UpdateSongInfo([]ddr_models.Song{
+		{Id: "s1", MinBpm: 75, MaxBpm: 300, Version: "DanceDanceRevolution A20 PLUS", Availability: "event"},
+		{Id: "s9", MinBpm: 1, MaxBpm: 1},
+	}))
+	songs, errs := GetDdrDb().RetrieveSongsById([]string{"s1", "s2"}, []string{"name desc"})
+	record("ddr songs by id", songs, errs)
+	songs, errs = GetDdrDb().RetrieveSongsById([]string{"s1", "s2"}, []string{"max_bpm desc"})
+	record("ddr songs by bpm", songs, errs)
+	jacket, errs := GetDdrDb().RetrieveJacketForSongId("s2")
+	record("ddr jacket", jacket, errs)
+
+	record("ddr difficulties", nil, GetDdrDb().AddDifficulties([]ddr_models.SongDifficulty{
+		{SongId: "s1", Mode: "SINGLE", Difficulty: "EXPERT", DifficultyValue: 12},
+		{SongId: "s1", Mode: "DOUBLE", Difficulty: "EXPERT", DifficultyValue: 13},
+		{SongId: "s2", Mode: "SINGLE", Difficulty: "BASIC", DifficultyValue: -1},
+	}))
+	record("ddr difficulties update", nil, GetDdrDb().AddDifficulties([]ddr_models.SongDifficulty{
+		{SongId: "s1", Mode: "SINGLE", Difficulty: "EXPERT", DifficultyValue: 11},
+	}))
+	record("ddr chart details", nil, GetDdrDb().UpdateChartDetails([]ddr_models.SongDifficulty{
+		{SongId: "s1", Mode: "SINGLE", Difficulty: "EXPERT", Stream: 80, Voltage: 60, Air: 30, Freeze: 20, Chaos: 40, Notes: 500, FreezeArrows: 12, ShockArrows: 3},
+		{SongId: "s9", Mode: "SINGLE", Difficulty: "EXPERT", Notes: 1},
+	}))
+	difficulties, errs := GetDdrDb().RetrieveValidDifficultiesById([]string{"s1", "s2"})
+	// unordered, and sqlite happens to return these in key order
+	sort.Slice(difficulties, func(i, j int) bool {
+		return difficulties[i].Mode < difficulties[j].Mode
+	})
+	record("ddr valid difficulties", difficulties, errs)
+
+	record("ddr details", nil, GetDdrDb().AddPlayerDetails(ddr_models.PlayerDetails{Code: 1, Name: "P", RefreshedAt: base, EaGateUser: &ea}))
+	details, exists, errs := GetDdrDb().RetrievePlayerDetailsByEaGateUser("PLAYER")
+	record("ddr details read", []interface{}{details, exists}, errs)
+	_, errs = GetDdrDb().RetrievePlayerDetailsByPlayerCode(2)
+	record("ddr missing details", nil, errs)
+
+	record("ddr playcounts", nil, GetDdrDb().AddPlaycounts([]ddr_models.Playcount{
+		{Playcount: 1, LastPlayDate: base, PlayerCode: 1},
+		{Playcount: 2, LastPlayDate: base.Add(48 * time.Hour), PlayerCode: 1},
+	}))
+	record("ddr playcounts again", nil, GetDdrDb().AddPlaycounts([]ddr_models.Playcount{{Playcount: 9, LastPlayDate: base, PlayerCode: 1}}))
+	playcounts, errs := GetDdrDb().RetrievePlaycountsByPlayerCodeInDateRange(1, base, base.Add(time.Hour))
+	record("ddr playcount range", playcounts, errs)
+	latest, errs := GetDdrDb().RetrieveLatestPlaycountByPlayerCode(1)
+	record("ddr latest playcount", latest, errs)
+
+	record("ddr statistics", nil, GetDdrDb().AddSongStatistics([]ddr_models.SongStatistics{
+		{BestScore: 900000, Lamp: "GOOD", Rank: "AA", PlayCount: 1, LastPlayed: base, SongId: "s1", Mode: "SINGLE", Difficulty: "EXPERT", PlayerCode: 1},
+	}))
+	record("ddr statistics update", nil, GetDdrDb().AddSongStatistics([]ddr_models.SongStatistics{
+		{BestScore: 950000, Lamp: "GREAT", Rank: "AA+", PlayCount: 2, LastPlayed: base, SongId: "s1", Mode: "SINGLE", Difficulty: "EXPERT", PlayerCode: 1},
+	}))
+	statistics, errs := GetDdrDb().RetrieveSongStatisticsByPlayerCode(1, []string{"s1"})
+	record("ddr statistics read", statistics, errs)
+	extended, errs := GetDdrDb().RetrieveExtendedScoreStatisticsByPlayerCode(1)
+	record("ddr extended", extended, errs)
+
+	record("ddr scores", nil, GetDdrDb().AddScores([]ddr_models.Score{
+		{Score: 900000, TimePlayed: base, SongId: "s1", Mode: "SINGLE", Difficulty: "EXPERT", PlayerCode: 1},
+		{Score: 950000, ClearStatus: true, TimePlayed: base.Add(time.Hour), SongId: "s1", Mode: "SINGLE", Difficulty: "EXPERT", PlayerCode: 1},
+		{Score: 1, TimePlayed: base, SongId: "s1", Mode: "SINGLE", Difficulty: "EXPERT", PlayerCode: 1},
+	}))
+	scores, errs := GetDdrDb().RetrieveSongScores(1, "s1", "single", "", []string{"score desc"})
+	record("ddr song scores", scores, errs)
+
+	record("ddr workout", nil, GetDdrDb().AddWorkoutData([]ddr_models.WorkoutData{{Date: base, PlayCount: 1, Kcal: 1.5, PlayerCode: 1}}))
+	record("ddr workout update", nil, GetDdrDb().AddWorkoutData([]ddr_models.WorkoutData{{Date: base, PlayCount: 3, Kcal: 4.5, PlayerCode: 1}}))
+	workout, errs := GetDdrDb().RetrieveWorkoutDataByPlayerCodeInDateRange(1, base.Add(-time.Hour), base)
+	record("ddr workout range", workout, errs)
+
+	record("ddr rolled back", nil, GetDdrDb().Transaction(func(tx ddr_db.DdrDbCommunication) (errs []error) {
+		tx.AddSongs([]ddr_models.Song{{Id: "s3", Name: "rolled back"}})
+		return []error{fmt.Errorf("failed")}
+	}))
+	songIds, errs := GetDdrDb().RetrieveSongIds()
+	record("ddr song ids", songIds, errs)
+
+	record("drs details", nil, GetDrsDb().AddPlayerDetails(drs_models.PlayerDetails{Code: 2, Name: "D", RefreshedAt: base, EaGateUser: &ea}))
+	record("drs private details", nil, GetDrsDb().AddPlayerDetails(drs_models.PlayerDetails{Code: 3, Name: "P"}))
+	drsDetails, errs := GetDrsDb().RetrievePlayerDetailsByPlayerCodes([]int{3, 2, 4})
+	record("drs details by codes", drsDetails, errs)
+	publicCodes, errs := GetDrsDb().RetrievePublicPlayerCodes()
+	record("drs public codes", publicCodes, errs)
+	record("drs snapshots", nil, GetDrsDb().AddPlayerProfileSnapshot(drs_models.PlayerProfileSnapshot{PlayCount: 2, StarLimit: 999, VoteRights1: 1, LastPlayed: base.Add(time.Hour), PlayerCode: 2}))
+	record("drs snapshots", nil, GetDrsDb().AddPlayerProfileSnapshot(drs_models.PlayerProfileSnapshot{PlayCount: 1, LastPlayed: base, PlayerCode: 2}))
+	snapshot, errs := GetDrsDb().RetrieveRecentPlayerProfileSnapshot(2)
+	record("drs recent snapshot", snapshot, errs)
+	snapshots, errs := GetDrsDb().RetrievePlayerProfileSnapshots(2, base, base.Add(time.Hour))
+	record("drs snapshot range", snapshots, errs)
+	snapshot, errs = GetDrsDb().RetrievePlayerProfileSnapshotBefore(2, base.Add(time.Hour))
+	record("drs snapshot before", snapshot, errs)
+	_, errs = GetDrsDb().RetrievePlayerProfileSnapshotBefore(2, base)
+	record("drs no snapshot before", nil, errs)
+
+	record("drs songs", nil, GetDrsDb().AddSongs([]drs_models.Song{{SongId: "d1", SongName: "Don't", ArtistName: "x"}, {SongId: "d0", LimitationType: 1}}))
+	record("drs songs readings", nil, GetDrsDb().AddSongs([]drs_models.Song{{SongId: "d1", SongName: "changed", SongYomigana: "ドント", ArtistName: "x", ArtistYomigana: "エックス"}}))
+	drsSongs, errs := GetDrsDb().RetrieveSongs()
+	record("drs songs read", drsSongs, errs)
+	unlockedAt, laterUnlockedAt := base.Add(time.Hour), base.Add(2*time.Hour)
+	record("drs unlocks", nil, GetDrsDb().AddPlayerUnlocks([]drs_models.PlayerUnlock{
+		{UnlockedAt: &unlockedAt, PlayerCode: 2, SongId: "d1"},
+		{UnlockedAt: &base, PlayerCode: 2, SongId: "d0"},
+		{PlayerCode: 2, SongId: "d'2"},
+	}))
+	record("drs unlocks again", nil, GetDrsDb().AddPlayerUnlocks([]drs_models.PlayerUnlock{{UnlockedAt: &laterUnlockedAt, PlayerCode: 2, SongId: "d1"}}))
+	unlocks, errs := GetDrsDb().RetrievePlayerUnlocks(2)
+	record("drs unlocks read", unlocks, errs)
+	record("drs difficulties", nil, GetDrsDb().AddDifficulties([]drs_models.Difficulty{
+		{Mode: "SINGLE", Difficulty: "NORMAL", Level: 3, SongId: "d1"},
+		{Mode: "SINGLE", Difficulty: "EASY", Level: 1, SongId: "d1"},
+		{Mode: "DOUBLE", Difficulty: "EASY", Level: 2, SongId: "d1"},
+	}))
+	p2 := 5
+	record("drs stats", nil, GetDrsDb().AddPlayerSongStats([]drs_models.PlayerSongStats{
+		{BestScore: 10, PlayCount: 1, Rank: 3, Param: 1, BestScoreDateTime: base, LastPlayDateTime: base, P1Code: 2, P2Code: &p2, P2Score: &p2, P2Perfects: &p2, P2Greats: &p2, P2Goods: &p2, P2Bads: &p2, PlayerCode: 2, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY"},
+	}))
+	videoUrl := "https://example.com/video.mp4"
+	expiredUrl := "https://example.com/expired.mp4"
+	record("drs scores", nil, GetDrsDb().AddPlayerScores([]drs_models.PlayerScore{
+		{Shop: "It's", Score: 10, Rank: 2, PlayTime: base, P1Code: 2, PlayerCode: 2, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY"},
+		{Shop: "b", Score: 20, PlayTime: base.Add(time.Hour), P1Code: 2, PlayerCode: 2, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY"},
+		{Shop: "b", Score: 15, PlayTime: base.Add(2 * time.Hour), P1Code: 2, PlayerCode: 2, SongId: "d1", Mode: "SINGLE", Difficulty: "NORMAL"},
+		{Shop: "b", Score: 30, PlayTime: base.Add(3 * time.Hour), P1Code: 2, PlayerCode: 2, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY", VideoUrl: &videoUrl},
+		{Shop: "b", Score: 31, PlayTime: base.Add(4 * time.Hour), P1Code: 2, PlayerCode: 2, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY", VideoUrl: &expiredUrl},
+	}))
+	unarchived, errs := GetDrsDb().RetrieveUnarchivedVideoScores(base)
+	record("drs unarchived videos", unarchived, errs)
+	record("drs archive video", nil, GetDrsDb().AddArchivedVideo(drs_models.ArchivedVideo{VideoUrl: videoUrl, PlayerCode: 2, File: "2/a.mp4", Size: 10, PlayTime: base.Add(3 * time.Hour), ArchivedAt: base}))
+	record("drs archive expired video", nil, GetDrsDb().AddArchivedVideo(drs_models.ArchivedVideo{VideoUrl: expiredUrl, PlayerCode: 2, PlayTime: base.Add(4 * time.Hour), ArchivedAt: base}))
+	record("drs archive duplicate video", nil, GetDrsDb().AddArchivedVideo(drs_models.ArchivedVideo{VideoUrl: videoUrl, PlayerCode: 2, ArchivedAt: base}))
+	unarchived, errs = GetDrsDb().RetrieveUnarchivedVideoScores(base)
+	record("drs unarchived videos after archive", unarchived, errs)
+	catalog, errs := GetDrsDb().RetrieveVideoCatalog(2)
+	record("drs video catalog", catalog, errs)
+	archivedVideos, errs := GetDrsDb().RetrieveArchivedVideos(0)
+	record("drs archived videos", archivedVideos, errs)
+	archivedVideo, errs := GetDrsDb().RetrieveArchivedVideo(1)
+	record("drs archived video", archivedVideo, errs)
+	_, errs = GetDrsDb().RetrieveArchivedVideo(100)
+	record("drs missing archived video", nil, errs)
+	filteredScores, total, errs := GetDrsDb().RetrieveFilteredPlayerScores(2, drs_db.PlayerScoreFilter{From: base.Add(time.Minute), Difficulty: "easy"})
+	record("drs filtered scores", []interface{}{filteredScores, total}, errs)
+	filteredScores, total, errs = GetDrsDb().RetrieveFilteredPlayerScores(2, drs_db.PlayerScoreFilter{Ordering: []string{"score desc"}, Limit: 1, Offset: 1})
+	record("drs scores page", []interface{}{filteredScores, total}, errs)
+	_, _, errs = GetDrsDb().RetrieveFilteredPlayerScores(2, drs_db.PlayerScoreFilter{Ordering: []string{"p1_code; drop table x"}})
+	record("drs scores bad ordering", nil, errs)
+	drsScores, errs := GetDrsDb().RetrievePlayerScores(2)
+	record("drs scores read", drsScores, errs)
+	table, errs := GetDrsDb().RetrieveDataForTable(2)
+	record("drs table", table, errs)
+	_, errs = GetDrsDb().RetrievePlayerDetailsByEaGateUser("nobody")
+	record("drs missing details", nil, errs)
+
+	partnerEa := "partner"
+	record("partner web user", nil, GetUserDb().SetWebUserForEaUser(partnerEa, "auth0|partner"))
+	record("partner profile", nil, GetApiDb().SetProfile(bst_models.BstProfile{User: "auth0|partner", Public: true}))
+	record("drs partner details", nil, GetDrsDb().AddPlayerDetails(drs_models.PlayerDetails{Code: 4, Name: "Q", EaGateUser: &partnerEa}))
+	record("drs partner scores", nil, GetDrsDb().AddPlayerScores([]drs_models.PlayerScore{
+		{Shop: "b", Score: 20, PlayTime: base.Add(time.Hour), P1Code: 2, PlayerCode: 4, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY"},
+		{Shop: "c", Score: 20, PlayTime: base.Add(5 * time.Hour), P1Code: 4, PlayerCode: 4, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY"},
+		{Shop: "b", Score: 30, PlayTime: base.Add(3 * time.Hour), P1Code: 2, P2Code: &p2, P2Score: &p2, P2Perfects: &p2, P2Greats: &p2, P2Goods: &p2, P2Bads: &p2, PlayerCode: 4, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY", VideoUrl: &videoUrl},
+		{Shop: "private", Score: 20, PlayTime: base, P1Code: 3, PlayerCode: 3, SongId: "d1", Mode: "SINGLE", Difficulty: "EASY"},
+	}))
+	shops, errs := GetDrsDb().RetrievePublicShopActivity()
+	record("drs public shops", shops, errs)
+
+	record("campaign play", nil, GetApiDb().AddCampaignPlay(api_models.CampaignPlay{WebUser: web, EaGateUser: ea, Campaign: "c1", Time: base, Choice: "0", Result: "win", Outcome: "played"}))
+	campaignPlays, errs := GetApiDb().RetrieveCampaignPlays(web)
+	record("campaign plays", campaignPlays, errs)
+
+	record("audit", nil, GetApiDb().AddAuditEntry(api_models.AuditEntry{Time: base, Actor: web, EffectiveUser: web, Action: "a", Target: ea}))
+	record("delete", nil, GetUserDb().DeleteWebUser(web, "deleted:1"))
+	entries, errs := GetApiDb().RetrieveAuditEntries("", base, base)
+	record("audit after delete", entries, errs)
+	_, exists, errs = GetUserDb().RetrieveUserByUserId(ea)
+	record("user after delete", exists, errs)
+	campaignPlays, errs = GetApiDb().RetrieveCampaignPlays(web)
+	record("campaign plays after delete", campaignPlays, errs)
+	statistics, errs = GetDdrDb().RetrieveSongStatisticsByPlayerCode(1, nil)
+	record("ddr statistics after delete", statistics, errs)
+	snapshots, errs = GetDrsDb().RetrievePlayerProfileSnapshots(2, base, base.Add(time.Hour))
+	record("drs snapshots after delete", snapshots, errs)
+	archivedVideos, errs = GetDrsDb().RetrieveArchivedVideos(0)
+	record("drs archived videos after delete", archivedVideos, errs)
+	// the partner still has the shared video, the expired one is gone
+	if len(archivedVideos) != 1 || archivedVideos[0].VideoUrl != videoUrl || archivedVideos[0].PlayerCode != 4 {
+		t.Errorf("expected the shared video to be kept for the partner, got %+v", archivedVideos)
+	}
+	unlocks, errs = GetDrsDb().RetrievePlayerUnlocks(2)
+	record("drs unlocks after delete", unlocks, errs)
+
+	return
+}
+
+func TestMemoryMatchesSqlite(t *testing.T) {
+	registerGameMigrations()
+	if err := openDbSqlite(":memory:"); err != nil {
+		t.Fatalf("failed to open sqlite: %s", err.Error())
+	}
+	if _, errs := GetMigrator().Migrate(); len(errs) > 0 {
+		t.Fatalf("failed to migrate sqlite: %v", errs)
+	}
+	expected := exerciseDb(t)
+	db.Close()
+
+	OpenDbMemory()
+	actual := exerciseDb(t)
+
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("result differs\nsqlite: %s\nmemory: %s", expected[i], actual[i])
+		}
+	}
+	if t.Failed() {
+		t.Logf("all sqlite results:\n%s", strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"github.com/chris-sg/bst_api/db/db_builder"
+	"github.com/chris-sg/bst_api/db/ddr_db"
+	"github.com/chris-sg/bst_api/db/drs_db"
+	"github.com/chris-sg/bst_api/models/api_models"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	"github.com/chris-sg/bst_api/models/ddr_models"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/chris-sg/bst_api/models/user_models"
+	"sync"
+	"testing"
+)
+
+var registerGameMigrationsOnce sync.Once
+
+// registerGameMigrations adds the migrations otherwise registered by
+// the game modules.
+func registerGameMigrations() {
+	registerGameMigrationsOnce.Do(func() {
+		for _, migration := range append(ddr_db.Migrations, drs_db.Migrations...) {
+			db_builder.RegisterMigration(migration)
+		}
+	})
+}
+
+// TestMigrationsCreateModelColumns checks that the pinned schema of
+// every migration adds up to the columns the models use.
+func TestMigrationsCreateModelColumns(t *testing.T) {
+	registerGameMigrations()
+	if err := openDbSqlite(":memory:"); err != nil {
+		t.Fatalf("failed to open sqlite: %s", err.Error())
+	}
+	defer db.Close()
+	if _, errs := GetMigrator().Migrate(); len(errs) > 0 {
+		t.Fatalf("failed to migrate sqlite: %v", errs)
+	}
+
+	models := []interface{}{
+		&user_models.User{},
+		&api_models.AuditEntry{}, &api_models.CampaignPlay{},
+		&bst_models.BstProfile{},
+		&ddr_models.Song{}, &ddr_models.SongDifficulty{},
+		&ddr_models.PlayerDetails{}, &ddr_models.Playcount{},
+		&ddr_models.Score{}, &ddr_models.SongStatistics{},
+		&ddr_models.WorkoutData{},
+		&drs_models.Song{}, &drs_models.Difficulty{},
+		&drs_models.PlayerDetails{}, &drs_models.PlayerProfileSnapshot{},
+		&drs_models.PlayerSongStats{}, &drs_models.PlayerScore{},
+		&drs_models.PlayerUnlock{}, &drs_models.ArchivedVideo{},
+	}
+	for _, model := range models {
+		scope := db.NewScope(model)
+		table := scope.TableName()
+		if !scope.Dialect().HasTable(table) {
+			t.Errorf("table %s was not created", table)
+			continue
+		}
+		for _, field := range scope.Fields() {
+			if !field.IsNormal || field.IsIgnored {
+				continue
+			}
+			if !scope.Dialect().HasColumn(table, field.DBName) {
+				t.Errorf("column %s.%s was not created", table, field.DBName)
+			}
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package user_db
+
+import (
+	"github.com/chris-sg/bst_api/db/db_memory"
+	"github.com/chris-sg/bst_api/models/user_models"
+	"github.com/jinzhu/gorm"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+func CreateUserDbCommunicationMemory(store *db_memory.Store) UserDbCommunicationMemory {
+	return UserDbCommunicationMemory{store}
+}
+
+// UserDbCommunicationMemory keeps all data in a db_memory.Store, with
+// the same behaviour as the postgres queries.
+type UserDbCommunicationMemory struct {
+	store *db_memory.Store
+}
+
+func (dbcomm UserDbCommunicationMemory) SetCookieForUser(userId string, cookie *http.Cookie) (errs []error) {
+	userId = strings.ToLower(userId)
+	eaGateUser, exists, errs := dbcomm.RetrieveUserByUserId(userId)
+	if len(errs) > 0 {
+		return
+	}
+	if !exists || eaGateUser.Name == "" {
+		eaGateUser = user_models.User{}
+	}
+	eaGateUser.Name = strings.ToLower(eaGateUser.Name)
+	eaGateUser.Cookie = cookie.String()
+	eaGateUser.Expiration = cookie.Expires.UnixNano() / 1000
+
+	return dbcomm.UpdateUser(eaGateUser)
+}
+
+func (dbcomm UserDbCommunicationMemory) SetSubscriptionForUser(userId string, sub string) (errs []error) {
+	userId = strings.ToLower(userId)
+	eaGateUser, exists, errs := dbcomm.RetrieveUserByUserId(userId)
+	if len(errs) > 0 {
+		return
+	}
+	if !exists || eaGateUser.Name == "" {
+		eaGateUser = user_models.User{}
+		eaGateUser.Name = userId
+	}
+
+	eaGateUser.Name = strings.ToLower(eaGateUser.Name)
+	eaGateUser.EaSubscription = sub
+
+	return dbcomm.UpdateUser(eaGateUser)
+}
+
+func (dbcomm UserDbCommunicationMemory) RetrieveUserByUserId(userId string) (user user_models.User, userExists bool, errs []error) {
+	userId = strings.ToLower(userId)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, u := range tables.Users {
+			if u.Name == userId {
+				user = u
+				userExists = true
+				return
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm UserDbCommunicationMemory) RetrieveUsernamesByWebId(webUserId string) (users []string, errs []error) {
+	webUserId = strings.ToLower(webUserId)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, u := range tables.Users {
+			if u.WebUser == webUserId {
+				users = append(users, u.Name)
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm UserDbCommunicationMemory) SetWebUserForEaUser(userId string, webUserId string) (errs []error) {
+	userId = strings.ToLower(userId)
+	webUserId = strings.ToLower(webUserId)
+	eaGateUser, exists, errs := dbcomm.RetrieveUserByUserId(userId)
+	if len(errs) > 0 {
+		return
+	}
+	if !exists || len(eaGateUser.Name) == 0 {
+		eaGateUser.Name = strings.ToLower(userId)
+	}
+
+	eaGateUser.WebUser = webUserId
+	return dbcomm.UpdateUser(eaGateUser)
+}
+
+func (dbcomm UserDbCommunicationMemory) RetrieveUsersForUpdate() (users []user_models.User, errs []error) {
+	users = make([]user_models.User, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, u := range tables.Users {
+			if u.Cookie != "" {
+				users = append(users, u)
+			}
+		}
+	})
+	return
+}
+
+func (dbcomm UserDbCommunicationMemory) UpdateUser(user user_models.User) (errs []error) {
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for i := range tables.Users {
+			if tables.Users[i].Name == user.Name {
+				tables.Users[i] = user
+				return
+			}
+		}
+		tables.Users = append(tables.Users, user)
+	})
+	return
+}
+
+func (dbcomm UserDbCommunicationMemory) RetrieveRandomHelper() (user user_models.User, errs []error) {
+	helpers := make([]user_models.User, 0)
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		for _, u := range tables.Users {
+			if u.Cookie != "" && u.EaSubscription == "e-amusement ベーシックコース" {
+				helpers = append(helpers, u)
+			}
+		}
+	})
+	if len(helpers) == 0 {
+		errs = append(errs, gorm.ErrRecordNotFound)
+		return
+	}
+	user = helpers[rand.Intn(len(helpers))]
+	return
+}
+
+// DeleteWebUser will remove every row tied to the web user, as the
+// postgres implementation does, and pseudonymise their audit entries.
+// The store is held for the whole deletion, so it is all or nothing.
+func (dbcomm UserDbCommunicationMemory) DeleteWebUser(webUserId string, pseudonym string) (errs []error) {
+	webUserId = strings.ToLower(webUserId)
+
+	dbcomm.store.Do(func(tables *db_memory.Tables) {
+		eaUsers := make([]string, 0)
+		users := tables.Users[:0]
+		for _, u := range tables.Users {
+			if u.WebUser == webUserId {
+				eaUsers = append(eaUsers, u.Name)
+				continue
+			}
+			users = append(users, u)
+		}
+		tables.Users = users
+
+		linked := func(eaGateUser *string) bool {
+			return eaGateUser != nil && containsString(eaUsers, *eaGateUser)
+		}
+
+		ddrCodes := make([]int, 0)
+		ddrDetails := tables.DdrPlayerDetails[:0]
+		for _, d := range tables.DdrPlayerDetails {
+			if linked(d.EaGateUser) {
+				ddrCodes = append(ddrCodes, d.Code)
+				continue
+			}
+			ddrDetails = append(ddrDetails, d)
+		}
+		tables.DdrPlayerDetails = ddrDetails
+
+		drsCodes := make([]int, 0)
+		drsDetails := tables.DrsPlayerDetails[:0]
+		for _, d := range tables.DrsPlayerDetails {
+			if linked(d.EaGateUser) {
+				drsCodes = append(drsCodes, d.Code)
+				continue
+			}
+			drsDetails = append(drsDetails, d)
+		}
+		tables.DrsPlayerDetails = drsDetails
+
+		scores := tables.DdrScores[:0]
+		for _, row := range tables.DdrScores {
+			if !containsInt(ddrCodes, row.PlayerCode) {
+				scores = append(scores, row)
+			}
+		}
+		tables.DdrScores = scores
+		statistics := tables.DdrSongStatistics[:0]
+		for _, row := range tables.DdrSongStatistics {
+			if !containsInt(ddrCodes, row.PlayerCode) {
+				statistics = append(statistics, row)
+			}
+		}
+		tables.DdrSongStatistics = statistics
+		playcounts := tables.DdrPlaycounts[:0]
+		for _, row := range tables.DdrPlaycounts {
+			if !containsInt(ddrCodes, row.PlayerCode) {
+				playcounts = append(playcounts, row)
+			}
+		}
+		tables.DdrPlaycounts = playcounts
+		workoutData := tables.DdrWorkoutData[:0]
+		for _, row := range tables.DdrWorkoutData {
+			if !containsInt(ddrCodes, row.PlayerCode) {
+				workoutData = append(workoutData, row)
+			}
+		}
+		tables.DdrWorkoutData = workoutData
+
+		drsScores := tables.DrsPlayerScores[:0]
+		for _, row := range tables.DrsPlayerScores {
+			if !containsInt(drsCodes, row.PlayerCode) {
+				drsScores = append(drsScores, row)
+			}
+		}
+		tables.DrsPlayerScores = drsScores
+		drsStats := tables.DrsPlayerSongStats[:0]
+		for _, row := range tables.DrsPlayerSongStats {
+			if !containsInt(drsCodes, row.PlayerCode) {
+				drsStats = append(drsStats, row)
+			}
+		}
+		tables.DrsPlayerSongStats = drsStats
+		snapshots := tables.DrsProfileSnapshots[:0]
+		for _, row := range tables.DrsProfileSnapshots {
+			if !containsInt(drsCodes, row.PlayerCode) {
+				snapshots = append(snapshots, row)
+			}
+		}
+		tables.DrsProfileSnapshots = snapshots
+		// the remaining scores are those of other players, so any still
+		// linking to an archived video keep it for the lowest such code
+		partnerCodes := make(map[string]int)
+		for _, row := range tables.DrsPlayerScores {
+			if row.VideoUrl == nil {
+				continue
+			}
+			if code, ok := partnerCodes[*row.VideoUrl]; !ok || row.PlayerCode < code {
+				partnerCodes[*row.VideoUrl] = row.PlayerCode
+			}
+		}
+		archivedVideos := tables.DrsArchivedVideos[:0]
+		for _, row := range tables.DrsArchivedVideos {
+			if containsInt(drsCodes, row.PlayerCode) {
+				code, ok := partnerCodes[row.VideoUrl]
+				if !ok {
+					continue
+				}
+				row.PlayerCode = code
+			}
+			archivedVideos = append(archivedVideos, row)
+		}
+		tables.DrsArchivedVideos = archivedVideos
+		unlocks := tables.DrsPlayerUnlocks[:0]
+		for _, row := range tables.DrsPlayerUnlocks {
+			if !containsInt(drsCodes, row.PlayerCode) {
+				unlocks = append(unlocks, row)
+			}
+		}
+		tables.DrsPlayerUnlocks = unlocks
+
+		profiles := tables.Profiles[:0]
+		for _, p := range tables.Profiles {
+			if p.User != webUserId {
+				profiles = append(profiles, p)
+			}
+		}
+		tables.Profiles = profiles
+		campaignPlays := tables.CampaignPlays[:0]
+		for _, play := range tables.CampaignPlays {
+			if play.WebUser != webUserId {
+				campaignPlays = append(campaignPlays, play)
+			}
+		}
+		tables.CampaignPlays = campaignPlays
+
+		identities := append([]string{webUserId}, eaUsers...)
+		for i := range tables.AuditEntries {
+			entry := &tables.AuditEntries[i]
+			if containsString(identities, entry.Actor) {
+				entry.Actor = pseudonym
+			}
+			if containsString(identities, entry.EffectiveUser) {
+				entry.EffectiveUser = pseudonym
+			}
+			if containsString(identities, entry.Target) {
+				entry.Target = pseudonym
+			}
+		}
+	})
+	return
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
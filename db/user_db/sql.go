@@ -1,6 +1,10 @@
 package user_db
 
 import (
+	"github.com/chris-sg/bst_api/models/api_models"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	"github.com/chris-sg/bst_api/models/ddr_models"
+	"github.com/chris-sg/bst_api/models/drs_models"
 	"github.com/chris-sg/bst_api/models/user_models"
 	"github.com/golang/glog"
 	"github.com/jinzhu/gorm"
@@ -18,6 +22,8 @@ type UserDbCommunication interface {
 
 	RetrieveUsersForUpdate() (users []user_models.User, errs []error)
 	RetrieveRandomHelper() (user user_models.User, errs []error)
+
+	DeleteWebUser(webUserId string, pseudonym string) (errs []error)
 }
 
 func CreateUserDbCommunicationPostgres(db *gorm.DB) UserDbCommunicationPostgres {
@@ -155,7 +161,7 @@ func (dbcomm UserDbCommunicationPostgres) RetrieveRandomHelper() (user user_mode
 	resultDb := dbcomm.db.Model(&user_models.User{}).
 		Where("login_cookie <> ?", "").
 		Where("subscription in (?)", []string{"e-amusement ベーシックコース"}).
-		Order("rand()").
+		Order("random()").
 		First(&user)
 
 	errors := resultDb.GetErrors()
@@ -163,4 +169,147 @@ func (dbcomm UserDbCommunicationPostgres) RetrieveRandomHelper() (user user_mode
 		errs = append(errs, errors...)
 	}
 	return
-}
\ No newline at end of file
+}
+
+// DeleteWebUser will remove every row tied to the web user and the
+// eagate accounts (and their player codes) linked to it. Audit log
+// entries are kept, but references to the user are replaced with the
+// provided pseudonym. Everything happens within a single transaction,
+// deleting children before parents so the RESTRICT foreign keys hold.
+// Archived videos which another player's scores still link to are handed
+// to that player rather than deleted.
+func (dbcomm UserDbCommunicationPostgres) DeleteWebUser(webUserId string, pseudonym string) (errs []error) {
+	glog.Infof("DeleteWebUser for web id %s\n", webUserId)
+	webUserId = strings.ToLower(webUserId)
+
+	tx := dbcomm.db.Begin()
+	errors := tx.GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+	defer func() {
+		if len(errs) > 0 {
+			tx.Rollback()
+			return
+		}
+		errors := tx.Commit().GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+		}
+	}()
+
+	eaUsers := make([]string, 0)
+	errors = tx.Model(&user_models.User{}).Where("web_user = ?", webUserId).Pluck("account_name", &eaUsers).GetErrors()
+	if errors != nil && len(errors) != 0 {
+		errs = append(errs, errors...)
+		return
+	}
+
+	if len(eaUsers) > 0 {
+		ddrCodes := make([]int, 0)
+		errors = tx.Model(&ddr_models.PlayerDetails{}).Where("eagate_user IN (?)", eaUsers).Pluck("code", &ddrCodes).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+		drsCodes := make([]int, 0)
+		errors = tx.Model(&drs_models.PlayerDetails{}).Where("eagate_user IN (?)", eaUsers).Pluck("code", &drsCodes).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+
+		if len(ddrCodes) > 0 {
+			for _, model := range []interface{}{
+				&ddr_models.Score{}, &ddr_models.SongStatistics{},
+				&ddr_models.Playcount{}, &ddr_models.WorkoutData{},
+			} {
+				errors = tx.Where("player_code IN (?)", ddrCodes).Delete(model).GetErrors()
+				if errors != nil && len(errors) != 0 {
+					errs = append(errs, errors...)
+					return
+				}
+			}
+		}
+
+		if len(drsCodes) > 0 {
+			// both players of a two player play share its video, so an
+			// archive the partner's scores still link to is handed to them
+			archivedVideos := make([]drs_models.ArchivedVideo, 0)
+			errors = tx.Where("player_code IN (?)", drsCodes).Find(&archivedVideos).GetErrors()
+			if errors != nil && len(errors) != 0 {
+				errs = append(errs, errors...)
+				return
+			}
+			for _, video := range archivedVideos {
+				partnerCodes := make([]int, 0)
+				errors = tx.Model(&drs_models.PlayerScore{}).
+					Where("video_url = ? AND player_code NOT IN (?)", video.VideoUrl, drsCodes).
+					Order("player_code").
+					Limit(1).
+					Pluck("player_code", &partnerCodes).
+					GetErrors()
+				if errors != nil && len(errors) != 0 {
+					errs = append(errs, errors...)
+					return
+				}
+				if len(partnerCodes) == 0 {
+					continue
+				}
+				errors = tx.Model(&drs_models.ArchivedVideo{}).Where("id = ?", video.Id).Update("player_code", partnerCodes[0]).GetErrors()
+				if errors != nil && len(errors) != 0 {
+					errs = append(errs, errors...)
+					return
+				}
+			}
+
+			for _, model := range []interface{}{
+				&drs_models.PlayerScore{}, &drs_models.PlayerSongStats{},
+				&drs_models.PlayerProfileSnapshot{}, &drs_models.ArchivedVideo{},
+				&drs_models.PlayerUnlock{},
+			} {
+				errors = tx.Where("player_code IN (?)", drsCodes).Delete(model).GetErrors()
+				if errors != nil && len(errors) != 0 {
+					errs = append(errs, errors...)
+					return
+				}
+			}
+		}
+
+		for _, model := range []interface{}{&ddr_models.PlayerDetails{}, &drs_models.PlayerDetails{}} {
+			errors = tx.Where("eagate_user IN (?)", eaUsers).Delete(model).GetErrors()
+			if errors != nil && len(errors) != 0 {
+				errs = append(errs, errors...)
+				return
+			}
+		}
+
+		errors = tx.Where("account_name IN (?)", eaUsers).Delete(&user_models.User{}).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+
+	for _, model := range []interface{}{&api_models.CampaignPlay{}, &bst_models.BstProfile{}} {
+		errors = tx.Where("user_sub = ?", webUserId).Delete(model).GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+
+	identities := append([]string{webUserId}, eaUsers...)
+	for _, column := range []string{"actor", "effective_user", "target"} {
+		errors = tx.Model(&api_models.AuditEntry{}).
+			Where(column+" IN (?)", identities).
+			Update(column, pseudonym).
+			GetErrors()
+		if errors != nil && len(errors) != 0 {
+			errs = append(errs, errors...)
+			return
+		}
+	}
+	return
+}
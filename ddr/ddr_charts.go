@@ -0,0 +1,206 @@
+package ddr
+
+import (
+	"github.com/chris-sg/bst_api/db/ddr_db"
+	"github.com/chris-sg/bst_api/models/ddr_models"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// chartAttributes are the chart values which can be filtered on with
+// `min_<attribute>` and `max_<attribute>` query parameters.
+var chartAttributes = map[string]func(ddr_models.SongDifficulty) int{
+	"level":        func(d ddr_models.SongDifficulty) int { return int(d.DifficultyValue) },
+	"stream":       func(d ddr_models.SongDifficulty) int { return int(d.Stream) },
+	"voltage":      func(d ddr_models.SongDifficulty) int { return int(d.Voltage) },
+	"air":          func(d ddr_models.SongDifficulty) int { return int(d.Air) },
+	"freeze":       func(d ddr_models.SongDifficulty) int { return int(d.Freeze) },
+	"chaos":        func(d ddr_models.SongDifficulty) int { return int(d.Chaos) },
+	"notes":        func(d ddr_models.SongDifficulty) int { return d.Notes },
+	"freezearrows": func(d ddr_models.SongDifficulty) int { return d.FreezeArrows },
+	"shockarrows":  func(d ddr_models.SongDifficulty) int { return d.ShockArrows },
+}
+
+// chartFilter limits charts by mode, difficulty, level and pattern
+// style, and by the version and bpm of their song. Charts and songs
+// whose details have not been read never match a filter on them.
+type chartFilter struct {
+	Mode       string
+	Difficulty string
+	Min        map[string]int
+	Max        map[string]int
+
+	Version string
+	MinBpm  int
+	MaxBpm  int
+}
+
+// parseChartFilter will read a chartFilter from the `mode`,
+// `difficulty`, `version`, `min_bpm`, `max_bpm`, `min_<attribute>` and
+// `max_<attribute>` query parameters. ok is false if a limit is not a
+// number.
+func parseChartFilter(query url.Values) (filter chartFilter, ok bool) {
+	filter = chartFilter{
+		Mode:       strings.ToUpper(query.Get("mode")),
+		Difficulty: strings.ToUpper(query.Get("difficulty")),
+		Min:        make(map[string]int),
+		Max:        make(map[string]int),
+		Version:    strings.TrimSpace(query.Get("version")),
+	}
+	var e error
+	if s := query.Get("min_bpm"); len(s) > 0 {
+		if filter.MinBpm, e = strconv.Atoi(s); e != nil {
+			return
+		}
+	}
+	if s := query.Get("max_bpm"); len(s) > 0 {
+		if filter.MaxBpm, e = strconv.Atoi(s); e != nil {
+			return
+		}
+	}
+	for attribute := range chartAttributes {
+		if s := query.Get("min_" + attribute); len(s) > 0 {
+			value, e := strconv.Atoi(s)
+			if e != nil {
+				return
+			}
+			filter.Min[attribute] = value
+		}
+		if s := query.Get("max_" + attribute); len(s) > 0 {
+			value, e := strconv.Atoi(s)
+			if e != nil {
+				return
+			}
+			filter.Max[attribute] = value
+		}
+	}
+	ok = true
+	return
+}
+
+// Empty reports whether the filter would match every chart.
+func (filter chartFilter) Empty() bool {
+	return !filter.filtersCharts() && !filter.filtersSongs()
+}
+
+func (filter chartFilter) filtersCharts() bool {
+	return len(filter.Mode) > 0 || len(filter.Difficulty) > 0 || len(filter.Min) > 0 || len(filter.Max) > 0
+}
+
+func (filter chartFilter) filtersSongs() bool {
+	return len(filter.Version) > 0 || filter.MinBpm > 0 || filter.MaxBpm > 0
+}
+
+// MatchesSong reports whether the song is from the filter's version,
+// ignoring case, and its whole bpm range is within the filter's.
+func (filter chartFilter) MatchesSong(song ddr_models.Song) bool {
+	if len(filter.Version) > 0 && !strings.EqualFold(filter.Version, song.Version) {
+		return false
+	}
+	if (filter.MinBpm > 0 || filter.MaxBpm > 0) && !song.HasSongInfo() {
+		return false
+	}
+	if filter.MinBpm > 0 && int(song.MinBpm) < filter.MinBpm {
+		return false
+	}
+	if filter.MaxBpm > 0 && int(song.MaxBpm) > filter.MaxBpm {
+		return false
+	}
+	return true
+}
+
+// Matches reports whether the chart is within every limit of the
+// filter.
+func (filter chartFilter) Matches(chart ddr_models.SongDifficulty) bool {
+	if len(filter.Mode) > 0 && filter.Mode != chart.Mode {
+		return false
+	}
+	if len(filter.Difficulty) > 0 && filter.Difficulty != chart.Difficulty {
+		return false
+	}
+	for attribute, min := range filter.Min {
+		if attribute != "level" && !chart.HasChartDetails() {
+			return false
+		}
+		if chartAttributes[attribute](chart) < min {
+			return false
+		}
+	}
+	for attribute, max := range filter.Max {
+		if attribute != "level" && !chart.HasChartDetails() {
+			return false
+		}
+		if chartAttributes[attribute](chart) > max {
+			return false
+		}
+	}
+	return true
+}
+
+// songListing is a song with the charts it has.
+type songListing struct {
+	ddr_models.Song
+	Difficulties []ddr_models.SongDifficulty
+}
+
+// listSongs will attach each song's charts. When filtering, only the
+// matching songs and charts are kept, and when filtering charts songs
+// without any are left out.
+func listSongs(songs []ddr_models.Song, difficulties []ddr_models.SongDifficulty, filter chartFilter) []songListing {
+	charts := make(map[string][]ddr_models.SongDifficulty)
+	for _, difficulty := range difficulties {
+		if !filter.Matches(difficulty) {
+			continue
+		}
+		charts[difficulty.SongId] = append(charts[difficulty.SongId], difficulty)
+	}
+
+	listings := make([]songListing, 0, len(songs))
+	for _, song := range songs {
+		if !filter.MatchesSong(song) {
+			continue
+		}
+		songCharts, found := charts[song.Id]
+		if !found {
+			if filter.filtersCharts() {
+				continue
+			}
+			songCharts = make([]ddr_models.SongDifficulty, 0)
+		}
+		listings = append(listings, songListing{song, songCharts})
+	}
+	return listings
+}
+
+// filterStatistics will keep the extended statistics rows for charts
+// and songs matching the filter.
+func filterStatistics(rows []ddr_db.DdrStatisticsTable, filter chartFilter) []ddr_db.DdrStatisticsTable {
+	filtered := make([]ddr_db.DdrStatisticsTable, 0, len(rows))
+	for _, row := range rows {
+		chart := ddr_models.SongDifficulty{
+			SongId:          row.Id,
+			Mode:            row.Mode,
+			Difficulty:      row.Difficulty,
+			DifficultyValue: int16(row.Level),
+			Stream:          int16(row.Stream),
+			Voltage:         int16(row.Voltage),
+			Air:             int16(row.Air),
+			Freeze:          int16(row.Freeze),
+			Chaos:           int16(row.Chaos),
+			Notes:           row.Notes,
+			FreezeArrows:    row.FreezeArrows,
+			ShockArrows:     row.ShockArrows,
+		}
+		song := ddr_models.Song{
+			Id:      row.Id,
+			Version: row.Version,
+			MinBpm:  int16(row.MinBpm),
+			MaxBpm:  int16(row.MaxBpm),
+		}
+		if filter.MatchesSong(song) && filter.Matches(chart) {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
@@ -2,6 +2,7 @@ package ddr
 
 import (
 	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/db/ddr_db"
 	"github.com/chris-sg/bst_api/eagate/ddr"
 	"github.com/chris-sg/bst_api/eagate/util"
 	"github.com/chris-sg/bst_api/models/ddr_models"
@@ -9,6 +10,7 @@ import (
 	"github.com/chris-sg/bst_api/utilities"
 	bst_models "github.com/chris-sg/bst_server_models"
 	"github.com/golang/glog"
+	"time"
 )
 
 // checkForNewSongs will load the song list from eagate and compare it
@@ -51,37 +53,69 @@ func checkForNewSongs(client util.EaClient) (newSongs []string, err bst_models.E
 
 // updateNewSongs will load song data and song difficulties for the
 // provided songIds slice. This intends to be used after checkForNewSongs
-// to update the database.
+// to update the database. Songs and their difficulties are written in a
+// single transaction.
 func updateNewSongs(client util.EaClient, songIds []string) bst_models.Error {
 	glog.Infof("Updating %d new songs from user %s\n", len(songIds), client.GetUserModel().Name)
+	songData, difficulties, err := loadNewSongs(client, songIds)
+	if !err.Equals(bst_models.ErrorOK) {
+		return err
+	}
+
+	err = bst_models.ErrorOK
+	errs := db.GetDdrDb().Transaction(func(tx ddr_db.DdrDbCommunication) (errs []error) {
+		errs = tx.AddSongs(songData)
+		if len(errs) > 0 {
+			err = bst_models.ErrorDdrSongDataDbWrite
+			return
+		}
+		errs = tx.AddDifficulties(difficulties)
+		if len(errs) > 0 {
+			err = bst_models.ErrorDdrSongDifficultiesDbWrite
+		}
+		return
+	})
+	if utilities.PrintErrors("failed to add songs to db:", errs) {
+		if err.Equals(bst_models.ErrorOK) {
+			err = bst_models.ErrorDdrSongDataDbWrite
+		}
+		return err
+	}
+	return bst_models.ErrorOK
+}
+
+// loadNewSongs will load song data and song difficulties from eagate
+// for the provided songIds, without writing anything to the database.
+func loadNewSongs(client util.EaClient, songIds []string) (songData []ddr_models.Song, difficulties []ddr_models.SongDifficulty, err bst_models.Error) {
+	err = bst_models.ErrorOK
+	if len(songIds) == 0 {
+		return
+	}
 	if !client.LoginState() {
 		glog.Errorf("Client %s not logged into eagate\n", client.GetUserModel().Name)
-		return bst_models.ErrorBadCookie
+		err = bst_models.ErrorBadCookie
+		return
 	}
 
-	songData, err := ddr.SongDataForClient(client, songIds)
+	songData, err = ddr.SongDataForClient(client, songIds)
 	if !err.Equals(bst_models.ErrorOK) {
 		glog.Errorf("Failed to get song data from client %s\n", client.GetUserModel().Name)
-		return err
+		return
 	}
 	glog.Infof("Update new songs got %d song data points\n", len(songData))
-	errs := db.GetDdrDb().AddSongs(songData)
-	if utilities.PrintErrors("failed to add songs to db:", errs) {
-		return bst_models.ErrorDdrSongDataDbWrite
-	}
-	difficulties, err := ddr.SongDifficultiesForClient(client, songIds)
+
+	difficulties, err = ddr.SongDifficultiesForClient(client, songIds)
 	if !err.Equals(bst_models.ErrorOK) {
 		glog.Errorf("Failed to get song difficulties from client %s\n", client.GetUserModel().Name)
-		return err
+		return
 	}
 	glog.Infof("Update new songs got %d song difficulty points\n", len(difficulties))
-	errs = db.GetDdrDb().AddDifficulties(difficulties)
-	if utilities.PrintErrors("failed to add difficulties to db:", errs) {
-		return bst_models.ErrorDdrSongDifficultiesDbWrite
-	}
-	return bst_models.ErrorOK
+	return
 }
 
+// refreshDdrUser will reload the player information and statistics for
+// every difficulty from eagate. All data is loaded before anything is
+// written, and the writes happen in a single transaction.
 func refreshDdrUser(client util.EaClient) (err bst_models.Error) {
 	err = bst_models.ErrorOK
 	glog.Infof("Refreshing user %s\n", client.GetUserModel().Name)
@@ -96,27 +130,19 @@ func refreshDdrUser(client util.EaClient) (err bst_models.Error) {
 		glog.Errorf("Failed to load player information for client %s: %s\n", client.GetUserModel().Name, err.Message)
 		return
 	}
-
-	errs := db.GetDdrDb().AddPlayerDetails(pi)
-	if utilities.PrintErrors("failed to add player details:", errs) {
-		err = bst_models.ErrorDdrPlayerInfoDbWrite
-		return
-	}
-	errs = db.GetDdrDb().AddPlaycounts([]ddr_models.Playcount{pc})
-	if utilities.PrintErrors("failed to add playcount:", errs) {
-		err = bst_models.ErrorDdrPlayerInfoDbWrite
-		return
-	}
+	eaGateUser := client.GetUserModel().Name
+	pi.EaGateUser = &eaGateUser
+	pi.RefreshedAt = time.Now()
 
 	newSongs, err := checkForNewSongs(client)
 	if !err.Equals(bst_models.ErrorOK) {
 		return
 	}
+	songData := make([]ddr_models.Song, 0)
 	if len(newSongs) > 0 {
-		glog.Infof("Updating %d new songs for client %s\n", len(newSongs), client.GetUserModel().Name)
-		err = updateNewSongs(client, newSongs)
+		songData, err = ddr.SongDataForClient(client, newSongs)
 		if !err.Equals(bst_models.ErrorOK) {
-			glog.Errorf("Failed to update new songs for client %s: %s\n", client.GetUserModel().Name, err.Message)
+			glog.Errorf("Failed to load new songs for client %s: %s\n", client.GetUserModel().Name, err.Message)
 			return
 		}
 	}
@@ -131,60 +157,77 @@ func refreshDdrUser(client util.EaClient) (err bst_models.Error) {
 		glog.Errorf("Failed to load song difficulties for client %s: %s\n", client.GetUserModel().Name, err.Message)
 		return
 	}
-	glog.Infof("Adding song difficulties to db client %s (%d difficulties)\n", client.GetUserModel().Name, len(difficulties))
-	errs = db.GetDdrDb().AddDifficulties(difficulties)
-	if utilities.PrintErrors("failed to add difficulties to db:", errs) {
-		err = bst_models.ErrorDdrSongDifficultiesDbWrite
-		return
-	}
 
-	difficulties, errs = db.GetDdrDb().RetrieveValidDifficulties()
-	if utilities.PrintErrors("failed to retrieve difficulties from db:", errs) {
-		err = bst_models.ErrorDdrSongDifficultiesDbRead
-		return
+	validDifficulties := make([]ddr_models.SongDifficulty, 0)
+	for _, difficulty := range difficulties {
+		if difficulty.DifficultyValue > -1 {
+			validDifficulties = append(validDifficulties, difficulty)
+		}
 	}
 
-	songStats, err := ddr.SongStatisticsForClient(client, difficulties, pi.Code)
+	songStats, err := ddr.SongStatisticsForClient(client, validDifficulties, pi.Code)
 	if !err.Equals(bst_models.ErrorOK) {
 		glog.Errorf("Failed to load song statistics for client %s, code %d: %s\n", client.GetUserModel().Name, pi.Code, err.Message)
 		return
 	}
-	glog.Infof("Adding song statistics to db client %s (%d statistics)", client.GetUserModel().Name, len(songStats))
-	db.GetDdrDb().AddSongStatistics(songStats)
-	if utilities.PrintErrors("failed to add song statistics to db:", errs) {
-		err = bst_models.ErrorDdrStatsDbWrite
-		return
-	}
 
 	recentScores, err := ddr.RecentScoresForClient(client, pi.Code)
 	if !err.Equals(bst_models.ErrorOK) {
 		glog.Errorf("Failed to load recent scores for client %s, code %d: %s\n", client.GetUserModel().Name, pi.Code, err.Message)
 		return
 	}
-	glog.Infof("Adding song scores to db client %s (%d scores)", client.GetUserModel().Name, len(recentScores))
-	errs = db.GetDdrDb().AddScores(recentScores)
-	if utilities.PrintErrors("failed to add scores to db:", errs) {
-		err = bst_models.ErrorDdrStatsDbWrite
-		return
-	}
 
 	workoutData, err := ddr.WorkoutDataForClient(client, pi.Code)
 	if !err.Equals(bst_models.ErrorOK) {
 		glog.Errorf("Failed to load workout data for client %s, code %d: %s\n", client.GetUserModel().Name, pi.Code, err.Message)
 		return
 	}
-	glog.Infof("Adding workout data to db client %s (%d datapoints)", client.GetUserModel().Name, len(workoutData))
-	errs = db.GetDdrDb().AddWorkoutData(workoutData)
-	if utilities.PrintErrors("failed to add workout data to db:", errs) {
-		err = bst_models.ErrorDdrStatsDbWrite
-	}
 
+	glog.Infof("Writing refresh for client %s (%d songs, %d difficulties, %d statistics, %d scores, %d workout datapoints)\n",
+		client.GetUserModel().Name, len(songData), len(difficulties), len(songStats), len(recentScores), len(workoutData))
+	errs := db.GetDdrDb().Transaction(func(tx ddr_db.DdrDbCommunication) (errs []error) {
+		if errs = tx.AddSongs(songData); len(errs) > 0 {
+			err = bst_models.ErrorDdrSongDataDbWrite
+			return
+		}
+		if errs = tx.AddDifficulties(difficulties); len(errs) > 0 {
+			err = bst_models.ErrorDdrSongDifficultiesDbWrite
+			return
+		}
+		if errs = tx.AddPlayerDetails(pi); len(errs) > 0 {
+			err = bst_models.ErrorDdrPlayerInfoDbWrite
+			return
+		}
+		if errs = tx.AddPlaycounts([]ddr_models.Playcount{pc}); len(errs) > 0 {
+			err = bst_models.ErrorDdrPlayerInfoDbWrite
+			return
+		}
+		if errs = tx.AddSongStatistics(songStats); len(errs) > 0 {
+			err = bst_models.ErrorDdrStatsDbWrite
+			return
+		}
+		if errs = tx.AddScores(recentScores); len(errs) > 0 {
+			err = bst_models.ErrorDdrStatsDbWrite
+			return
+		}
+		if errs = tx.AddWorkoutData(workoutData); len(errs) > 0 {
+			err = bst_models.ErrorDdrStatsDbWrite
+		}
+		return
+	})
+	if utilities.PrintErrors("failed to write refresh to db:", errs) {
+		if err.Equals(bst_models.ErrorOK) {
+			err = bst_models.ErrorDdrStatsDbWrite
+		}
+	}
 	return
 }
 
 // updatePlayerProfile will do a full update of the user's profile. This
 // includes updating the player information, the playcount, adding the
-// recent scores and updating song statistics.
+// recent scores and updating song statistics. Everything is loaded from
+// eagate first and then written in a single transaction, with the
+// playcount last so a failed update will be retried next time.
 // TODO: if the user has played more than 50 songs, this will not update
 // unknown song statistics. This can currently still be achieved manually.
 func UpdatePlayerProfile(user user_models.User, client util.EaClient) (err bst_models.Error) {
@@ -201,6 +244,7 @@ func UpdatePlayerProfile(user user_models.User, client util.EaClient) (err bst_m
 		return
 	}
 	newPi.EaGateUser = &user.Name
+	newPi.RefreshedAt = time.Now()
 	dbPi, errs := db.GetDdrDb().RetrievePlayerDetailsByPlayerCode(newPi.Code)
 	if utilities.PrintErrors("failed to retrieve player details:", errs) {
 		err = bst_models.ErrorDdrStatsDbRead
@@ -215,16 +259,19 @@ func UpdatePlayerProfile(user user_models.User, client util.EaClient) (err bst_m
 		}
 		if playcount.Playcount == dbPlaycount.Playcount {
 			glog.Infof("Playcount for %d unchanged. Will not update", dbPi.Code)
+			// the details are still saved so RefreshedAt records the check
+			if utilities.PrintErrors("failed to save player details:", db.GetDdrDb().AddPlayerDetails(newPi)) {
+				err = bst_models.ErrorDdrPlayerInfoDbWrite
+			}
 			return
 		}
 	} else {
 		glog.Infof("Player info not found for code %d, will refresh\n", newPi.Code)
-		refreshDdrUser(client)
-	}
-	errs = db.GetDdrDb().AddPlayerDetails(newPi)
-	if utilities.PrintErrors("failed to update player information:", errs) {
-		err = bst_models.ErrorDdrStatsDbWrite
-		return
+		err = refreshDdrUser(client)
+		if !err.Equals(bst_models.ErrorOK) {
+			glog.Errorf("Failed to refresh user %s: %s\n", client.GetUserModel().Name, err.Message)
+			return
+		}
 	}
 
 	recentScores, err := ddr.RecentScoresForClient(client, newPi.Code)
@@ -275,71 +322,75 @@ func UpdatePlayerProfile(user user_models.User, client util.EaClient) (err bst_m
 		}
 	}
 
-	if len(recentSongIds) > 0 {
-		err = updateNewSongs(client, recentSongIds)
-		if !err.Equals(bst_models.ErrorOK) {
-			glog.Errorf("Failed to update new songs for client %s\n", client.GetUserModel().Name)
-			return
+	songData, difficulties, err := loadNewSongs(client, recentSongIds)
+	if !err.Equals(bst_models.ErrorOK) {
+		glog.Errorf("Failed to load new songs for client %s\n", client.GetUserModel().Name)
+		return
+	}
+
+	songsToUpdate := make([]ddr_models.SongDifficulty, 0)
+	for _, score := range recentScores {
+		added := false
+		for _, song := range songsToUpdate {
+			if score.SongId == song.SongId && score.Mode == song.Mode && score.Difficulty == song.Difficulty {
+				added = true
+				break
+			}
+		}
+		if !added {
+			songsToUpdate = append(songsToUpdate, ddr_models.SongDifficulty{
+				SongId:          score.SongId,
+				Mode:            score.Mode,
+				Difficulty:      score.Difficulty,
+				DifficultyValue: 0,
+			})
 		}
 	}
 
+	statistics, err := ddr.SongStatisticsForClient(client, songsToUpdate, newPi.Code)
+	if !err.Equals(bst_models.ErrorOK) {
+		glog.Errorf("Failed to update song statistics for user %s code %d: %s\n", client.GetUserModel().Name, newPi.Code, err.Message)
+		return
+	}
 
-	if recentScores != nil {
-		errs = db.GetDdrDb().AddScores(recentScores)
-		if utilities.PrintErrors("failed to add recent scores:", errs) {
-			err = bst_models.ErrorDdrStatsDbWrite
+	errs = db.GetDdrDb().Transaction(func(tx ddr_db.DdrDbCommunication) (errs []error) {
+		if errs = tx.AddPlayerDetails(newPi); len(errs) > 0 {
+			err = bst_models.ErrorDdrPlayerInfoDbWrite
 			return
 		}
-
-		songsToUpdate := make([]ddr_models.SongDifficulty, 0)
-
-		for _, score := range recentScores {
-			added := false
-			for _, song := range songsToUpdate {
-				if score.SongId == song.SongId && score.Mode == song.Mode && score.Difficulty == song.Difficulty {
-					added = true
-					break
-				}
-			}
-			if !added {
-				songsToUpdate = append(songsToUpdate, ddr_models.SongDifficulty{
-					SongId:          score.SongId,
-					Mode:            score.Mode,
-					Difficulty:      score.Difficulty,
-					DifficultyValue: 0,
-				})
-			}
+		if errs = tx.AddSongs(songData); len(errs) > 0 {
+			err = bst_models.ErrorDdrSongDataDbWrite
+			return
 		}
-
-		statistics, err2 := ddr.SongStatisticsForClient(client, songsToUpdate, newPi.Code)
-		err = err2
-		if !err.Equals(bst_models.ErrorOK) {
-			glog.Errorf("Failed to update song statistics for user %s code %d: %s\n", client.GetUserModel().Name, newPi.Code, err.Message)
+		if errs = tx.AddDifficulties(difficulties); len(errs) > 0 {
+			err = bst_models.ErrorDdrSongDifficultiesDbWrite
 			return
 		}
-		errs = db.GetDdrDb().AddSongStatistics(statistics)
-		if utilities.PrintErrors("failed to add song statistics to db:", errs) {
+		if errs = tx.AddScores(recentScores); len(errs) > 0 {
 			err = bst_models.ErrorDdrStatsDbWrite
 			return
 		}
-		glog.Infof("Updated song statistics for user %s\n", client.GetUserModel().Name)
-	}
-
-	if workoutData != nil {
-		errs = db.GetDdrDb().AddWorkoutData(workoutData)
-		if utilities.PrintErrors("failed to add workout data to db:", errs) {
+		if errs = tx.AddSongStatistics(statistics); len(errs) > 0 {
 			err = bst_models.ErrorDdrStatsDbWrite
 			return
 		}
-	}
-
-	errs = db.GetDdrDb().AddPlaycounts([]ddr_models.Playcount{playcount})
-	if utilities.PrintErrors("failed to add playcounts:", errs) {
-		err = bst_models.ErrorDdrStatsDbWrite
+		if errs = tx.AddWorkoutData(workoutData); len(errs) > 0 {
+			err = bst_models.ErrorDdrStatsDbWrite
+			return
+		}
+		if errs = tx.AddPlaycounts([]ddr_models.Playcount{playcount}); len(errs) > 0 {
+			err = bst_models.ErrorDdrStatsDbWrite
+		}
+		return
+	})
+	if utilities.PrintErrors("failed to write profile update to db:", errs) {
+		if err.Equals(bst_models.ErrorOK) {
+			err = bst_models.ErrorDdrStatsDbWrite
+		}
 		return
 	}
 
 	glog.Infof("Profile update complete for user %s\n", client.GetUserModel().Name)
 
 	return
-}
\ No newline at end of file
+}
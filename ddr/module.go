@@ -0,0 +1,42 @@
+package ddr
+
+import (
+	"github.com/chris-sg/bst_api/db/db_builder"
+	"github.com/chris-sg/bst_api/db/ddr_db"
+	"github.com/chris-sg/bst_api/eagate/util"
+	"github.com/chris-sg/bst_api/games"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	bstServerModels "github.com/chris-sg/bst_server_models"
+	"github.com/gorilla/mux"
+)
+
+// Module serves and updates DanceDanceRevolution.
+type Module struct{}
+
+func (Module) Name() string {
+	return "ddr"
+}
+
+func (Module) Router() *mux.Router {
+	return CreateDdrRouter()
+}
+
+func (Module) Migrations() []db_builder.Migration {
+	return ddr_db.Migrations
+}
+
+func (Module) AutoUpdate(profile bst_models.BstProfile) bool {
+	return profile.DdrAutoUpdate
+}
+
+func (Module) Update(client util.EaClient) bstServerModels.Error {
+	return UpdatePlayerProfile(client.GetUserModel(), client)
+}
+
+func (Module) Refresh(client util.EaClient) bstServerModels.Error {
+	return refreshDdrUser(client)
+}
+
+func (module Module) Status() games.Status {
+	return games.ParserStatus(module.Name())
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"github.com/chris-sg/bst_api/common"
 	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/db/ddr_db"
 	"github.com/chris-sg/bst_api/eagate/ddr"
 	"github.com/chris-sg/bst_api/eagate/user"
 	"github.com/chris-sg/bst_api/models/ddr_models"
 	"github.com/chris-sg/bst_api/utilities"
 	bst_models "github.com/chris-sg/bst_server_models"
+	"github.com/golang/glog"
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
 	"io/ioutil"
@@ -234,16 +236,25 @@ func ProfileUpdatePatch(rw http.ResponseWriter, r *http.Request) {
 
 // SongsGet will retrieve a list of all songs from the database.
 // Data returned will not include the jacket image, which should
-// be retrieved with the `/ddr/songs/images` endpoint.
+// be retrieved with the `/ddr/songs/images` endpoint. Each song lists
+// its charts, which may be filtered with `mode`, `difficulty` and
+// `min_<attribute>`/`max_<attribute>` for the level, groove radar and
+// step counts. Songs may be filtered by `version`, `min_bpm` and
+// `max_bpm`.
 func SongsGet(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, ok := parseChartFilter(query)
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+		return
+	}
+
 	songIds, errs := db.GetDdrDb().RetrieveSongIds()
 	if utilities.PrintErrors("failed to retrieve song ids from db:", errs) {
 		utilities.RespondWithError(rw, bst_models.ErrorDdrSongIdsDbRead)
 		return
 	}
 
-	query := r.URL.Query()
-
 	var songs []ddr_models.Song
 	songs, errs = db.GetDdrDb().RetrieveSongsById(songIds, query["ordering"])
 
@@ -252,7 +263,13 @@ func SongsGet(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bytes, err := json.Marshal(songs)
+	difficulties, errs := db.GetDdrDb().RetrieveValidDifficultiesById(songIds)
+	if utilities.PrintErrors("failed to retrieve difficulties by id:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDdrSongDataDbRead)
+		return
+	}
+
+	bytes, err := json.Marshal(listSongs(songs, difficulties, filter))
 	if err != nil {
 		utilities.RespondWithError(rw, bst_models.ErrorJsonEncode)
 		return
@@ -265,9 +282,8 @@ func SongsGet(rw http.ResponseWriter, r *http.Request) {
 
 // SongsPatch will attempt to find which songs on eagate are not
 // yet in the database, and proceed to add songs as their difficulties
-// to the database.
-// TODO: if this fails after adding the songs to the database, new
-// difficulties will be missing with no current recovery method.
+// to the database. Songs and difficulties are written in a single
+// transaction.
 func SongsPatch(rw http.ResponseWriter, r *http.Request) {
 	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
 	if !err.Equals(bst_models.ErrorOK) {
@@ -293,34 +309,19 @@ func SongsPatch(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	songData, err := ddr.SongDataForClient(client, newSongs)
+	err = updateNewSongs(client, newSongs)
 	if !err.Equals(bst_models.ErrorOK) {
 		utilities.RespondWithError(rw, err)
 		return
 	}
 
-	errs = db.GetDdrDb().AddSongs(songData)
-	if utilities.PrintErrors("failed to add songs to db:", errs) {
-		utilities.RespondWithError(rw, bst_models.ErrorDdrSongDataDbWrite)
-		return
-	}
-
-	songDifficulties, err := ddr.SongDifficultiesForClient(client, newSongs)
-	if !err.Equals(bst_models.ErrorOK) {
-		utilities.RespondWithError(rw, err)
-		return
-	}
-
-	errs = db.GetDdrDb().AddDifficulties(songDifficulties)
-	if utilities.PrintErrors("failed to add difficulties to db:", errs) {
-		utilities.RespondWithError(rw, bst_models.ErrorDdrSongDifficultiesDbWrite)
-		return
-	}
-
 	utilities.RespondWithError(rw, bst_models.ErrorOK)
 	return
 }
 
+// SongsReloadPatch will reload every song on eagate, adding any which
+// are missing and updating the bpm, version and availability of those
+// already in the database.
 func SongsReloadPatch(rw http.ResponseWriter, r *http.Request) {
 	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
 	if !err.Equals(bst_models.ErrorOK) {
@@ -346,30 +347,12 @@ func SongsReloadPatch(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	songData, err := ddr.SongDataForClient(client, songIds)
+	err = updateNewSongs(client, songIds)
 	if !err.Equals(bst_models.ErrorOK) {
 		utilities.RespondWithError(rw, err)
 		return
 	}
 
-	errs = db.GetDdrDb().AddSongs(songData)
-	if utilities.PrintErrors("failed to add songs to db:", errs) {
-		utilities.RespondWithError(rw, bst_models.ErrorDdrSongDataDbWrite)
-		return
-	}
-
-	songDifficulties, err := ddr.SongDifficultiesForClient(client, songIds)
-	if !err.Equals(bst_models.ErrorOK) {
-		utilities.RespondWithError(rw, err)
-		return
-	}
-
-	errs = db.GetDdrDb().AddDifficulties(songDifficulties)
-	if utilities.PrintErrors("failed to add difficulties to db:", errs) {
-		utilities.RespondWithError(rw, bst_models.ErrorDdrSongDifficultiesDbWrite)
-		return
-	}
-
 	utilities.RespondWithError(rw, bst_models.ErrorOK)
 	return
 }
@@ -493,7 +476,27 @@ func SongsScoresExtendedGet(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	filter, ok := parseChartFilter(r.URL.Query())
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+		return
+	}
+
 	stats, errs := db.GetDdrDb().RetrieveExtendedScoreStatisticsByPlayerCode(ddrProfile.Code)
+	if utilities.PrintErrors("failed to retrieve extended statistics:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDdrStatsDbRead)
+		return
+	}
+	if !filter.Empty() {
+		rows := make([]ddr_db.DdrStatisticsTable, 0)
+		if e := json.Unmarshal([]byte(stats), &rows); e != nil {
+			glog.Errorf("failed to decode extended statistics for %d: %s\n", ddrProfile.Code, e.Error())
+			utilities.RespondWithError(rw, bst_models.ErrorDdrStatsDbRead)
+			return
+		}
+		bytes, _ := json.Marshal(filterStatistics(rows, filter))
+		stats = string(bytes)
+	}
 
 	rw.WriteHeader(http.StatusOK)
 	_, _ = rw.Write([]byte(stats))
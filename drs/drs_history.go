@@ -0,0 +1,40 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"time"
+)
+
+// profileHistoryEntry is a profile snapshot along with what changed
+// since the snapshot before it.
+type profileHistoryEntry struct {
+	drs_models.PlayerProfileSnapshot
+	Plays         int     `json:"plays"`
+	MinutesDanced float64 `json:"minutesdanced"`
+	StarsEarned   int     `json:"starsearned"`
+	StarsSpent    int     `json:"starsspent"`
+}
+
+// profileHistory will pair each snapshot played from start onwards with
+// its change since the previous snapshot. Snapshots must be ordered by
+// play count and include the last one before start, so the first entry
+// still has a delta. The very first snapshot recorded has nothing to compare
+// against and so has no delta.
+func profileHistory(snapshots []drs_models.PlayerProfileSnapshot, start time.Time) []profileHistoryEntry {
+	history := make([]profileHistoryEntry, 0, len(snapshots))
+	for i, snapshot := range snapshots {
+		if snapshot.LastPlayed.Before(start) {
+			continue
+		}
+		entry := profileHistoryEntry{PlayerProfileSnapshot: snapshot}
+		if i > 0 {
+			previous := snapshots[i-1]
+			entry.Plays = snapshot.PlayCount - previous.PlayCount
+			entry.MinutesDanced = float64(snapshot.PlaySeconds-previous.PlaySeconds) / 60
+			entry.StarsEarned = snapshot.TotalStars - previous.TotalStars
+			entry.StarsSpent = snapshot.UsedStars - previous.UsedStars
+		}
+		history = append(history, entry)
+	}
+	return history
+}
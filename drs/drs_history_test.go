@@ -0,0 +1,45 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"testing"
+	"time"
+)
+
+func TestProfileHistory(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := []drs_models.PlayerProfileSnapshot{
+		{PlayCount: 10, PlaySeconds: 600, TotalStars: 100, UsedStars: 50, LastPlayed: start.Add(-time.Hour)},
+		{PlayCount: 13, PlaySeconds: 780, TotalStars: 130, UsedStars: 50, LastPlayed: start.Add(time.Hour)},
+		{PlayCount: 14, PlaySeconds: 870, TotalStars: 135, UsedStars: 80, LastPlayed: start.Add(2 * time.Hour)},
+	}
+
+	history := profileHistory(snapshots, start)
+	if len(history) != 2 {
+		t.Fatalf("expected 2 entries but got %d", len(history))
+	}
+	expected := []profileHistoryEntry{
+		{PlayerProfileSnapshot: snapshots[1], Plays: 3, MinutesDanced: 3, StarsEarned: 30, StarsSpent: 0},
+		{PlayerProfileSnapshot: snapshots[2], Plays: 1, MinutesDanced: 1.5, StarsEarned: 5, StarsSpent: 30},
+	}
+	for i, entry := range expected {
+		if history[i] != entry {
+			t.Errorf("expected entry %d to be %+v but got %+v", i, entry, history[i])
+		}
+	}
+}
+
+func TestProfileHistoryFirstSnapshotHasNoDelta(t *testing.T) {
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := []drs_models.PlayerProfileSnapshot{
+		{PlayCount: 10, PlaySeconds: 600, TotalStars: 100, LastPlayed: start},
+	}
+
+	history := profileHistory(snapshots, start)
+	if len(history) != 1 {
+		t.Fatalf("expected 1 entry but got %d", len(history))
+	}
+	if history[0].Plays != 0 || history[0].MinutesDanced != 0 || history[0].StarsEarned != 0 {
+		t.Errorf("expected no delta for the first snapshot but got %+v", history[0])
+	}
+}
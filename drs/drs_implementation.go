@@ -2,15 +2,20 @@ package drs
 
 import (
 	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/db/drs_db"
 	"github.com/chris-sg/bst_api/eagate/drs"
 	"github.com/chris-sg/bst_api/eagate/util"
 	"github.com/chris-sg/bst_api/models/drs_models"
 	"github.com/chris-sg/bst_api/utilities"
 	bst_models "github.com/chris-sg/bst_server_models"
 	"github.com/golang/glog"
+	"github.com/jinzhu/gorm"
+	"time"
 )
 
-func refreshDrsUser(client util.EaClient) (err bst_models.Error) {
+// refreshDrsUser will load and save everything eagate has for the
+// user. The report lists anything from eagate that could not be saved.
+func refreshDrsUser(client util.EaClient) (report drs.TransformReport, err bst_models.Error) {
 	err = bst_models.ErrorOK
 	glog.Infof("Refreshing user %s\n", client.GetUserModel().Name)
 	if !client.LoginState() {
@@ -31,26 +36,113 @@ func refreshDrsUser(client util.EaClient) (err bst_models.Error) {
 		return
 	}
 
-
-	playerDetails, profileSnapshot, songs, difficulties, playerSongStats, playerScores := drs.Transform(dancerInfo, musicData, playHist)
+	playerDetails, profileSnapshot, songs, difficulties, playerSongStats, playerScores, report := drs.Transform(dancerInfo, musicData, playHist)
+	if !report.Empty() {
+		glog.Warningf("drs transform for %s: %d empty sections, %d unknown chart types, %d skipped records\n",
+			client.GetUserModel().Name, len(report.EmptySections), len(report.UnknownChartTypes), len(report.Skipped))
+	}
+	// songs unlocked before unlocks were first read have no known time
+	existingUnlocks, errs := db.GetDrsDb().RetrievePlayerUnlocks(playerDetails.Code)
+	if utilities.PrintErrors("failed to retrieve unlocks:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+	var unlockedAt *time.Time
+	if len(existingUnlocks) > 0 {
+		unlockedAt = &profileSnapshot.LastPlayed
+	}
+	unlocks := drs.TransformUnlocks(musicData, unlockedAt)
 	user := client.GetUserModel().Name
 	if len(user) > 0 {
 		playerDetails.EaGateUser = &user
 	}
+	playerDetails.RefreshedAt = time.Now()
+
+	errs = db.GetDrsDb().Transaction(func(tx drs_db.DrsDbCommunication) (errs []error) {
+		if errs = tx.AddSongs(songs); len(errs) > 0 {
+			err = bst_models.ErrorDrsSongDataDbWrite
+			return
+		}
+		if errs = tx.AddDifficulties(difficulties); len(errs) > 0 {
+			err = bst_models.ErrorDrsSongDataDbWrite
+			return
+		}
+		if errs = tx.AddPlayerDetails(playerDetails); len(errs) > 0 {
+			err = bst_models.ErrorDrsPlayerInfoDbWrite
+			return
+		}
+		if errs = tx.AddPlayerProfileSnapshot(profileSnapshot); len(errs) > 0 {
+			err = bst_models.ErrorDrsPlayerInfoDbWrite
+			return
+		}
+		if errs = tx.AddPlayerUnlocks(unlocks); len(errs) > 0 {
+			err = bst_models.ErrorDrsPlayerInfoDbWrite
+			return
+		}
+		if errs = tx.AddPlayerSongStats(playerSongStats); len(errs) > 0 {
+			err = bst_models.ErrorDrsSongDataDbWrite
+			return
+		}
+		if errs = tx.AddPlayerScores(playerScores); len(errs) > 0 {
+			err = bst_models.ErrorDrsSongDataDbWrite
+		}
+		return
+	})
+	if utilities.PrintErrors("failed to write drs refresh to db:", errs) {
+		if err.Equals(bst_models.ErrorOK) {
+			err = bst_models.ErrorDrsSongDataDbWrite
+		}
+	}
 
-	errs := db.GetDrsDb().AddPlayerDetails(playerDetails)
-	utilities.PrintErrors("failed to add player details to db:", errs)
-	errs = db.GetDrsDb().AddPlayerProfileSnapshot(profileSnapshot)
-	utilities.PrintErrors("failed to add player profile snapshot to db:", errs)
-	errs = db.GetDrsDb().AddSongs(songs)
-	utilities.PrintErrors("failed to add songs to db:", errs)
-	errs = db.GetDrsDb().AddDifficulties(difficulties)
-	utilities.PrintErrors("failed to add difficulties to db:", errs)
-	errs = db.GetDrsDb().AddPlayerSongStats(playerSongStats)
-	utilities.PrintErrors("failed to add song stats to db:", errs)
-	errs = db.GetDrsDb().AddPlayerScores(playerScores)
-	utilities.PrintErrors("failed to add player scores to db:", errs)
+	return
+}
+
+// updateDrsUser will refresh the user if their play count has changed
+// since they were last refreshed. eagate only offers drs data as a
+// whole, so only the dancer info is loaded when nothing was played.
+func updateDrsUser(client util.EaClient) (err bst_models.Error) {
+	err = bst_models.ErrorOK
+	glog.Infof("Updating user %s\n", client.GetUserModel().Name)
+	if !client.LoginState() {
+		err = bst_models.ErrorBadCookie
+		return
+	}
 
+	dancerInfo, err := drs.LoadDancerInfo(client)
+	if !err.Equals(bst_models.ErrorOK) {
+		return
+	}
+	details, errs := db.GetDrsDb().RetrievePlayerDetailsByEaGateUser(client.GetUserModel().Name)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		glog.Infof("Player details not found for %s, will refresh\n", client.GetUserModel().Name)
+		_, err = refreshDrsUser(client)
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve player details:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+	snapshot, errs := db.GetDrsDb().RetrieveRecentPlayerProfileSnapshot(details.Code)
+	found := true
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		found = false
+		errs = nil
+	}
+	if utilities.PrintErrors("failed to retrieve recent snapshot:", errs) {
+		err = bst_models.ErrorDrsPlayerInfoDbRead
+		return
+	}
+
+	if found && snapshot.PlayCount == dancerInfo.Data.EaSite.Statistics.PlayCount {
+		glog.Infof("Playcount for %d unchanged. Will not refresh", details.Code)
+		// the details are still saved so RefreshedAt records the check
+		details.RefreshedAt = time.Now()
+		if utilities.PrintErrors("failed to save player details:", db.GetDrsDb().AddPlayerDetails(details)) {
+			err = bst_models.ErrorDrsPlayerInfoDbWrite
+		}
+		return
+	}
+	_, err = refreshDrsUser(client)
 	return
 }
 
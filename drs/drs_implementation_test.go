@@ -0,0 +1,94 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/eagate/fake_eagate"
+	"github.com/chris-sg/bst_api/eagate/user"
+	"github.com/chris-sg/bst_api/eagate/util"
+	"github.com/chris-sg/bst_api/models/user_models"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"testing"
+)
+
+func TestRefreshWithEmptyHistory(t *testing.T) {
+	db.OpenDbMemory()
+	server := fake_eagate.NewServer()
+	defer server.Close()
+	server.AddUser("bst", "password", "")
+	for md5, character := range fake_eagate.CaptchaChecksums() {
+		user.RegisterCaptchaChecksum(md5, character)
+	}
+	base := util.EaBaseURI()
+	util.SetEaBaseURI(server.URL)
+	defer util.SetEaBaseURI(base)
+
+	// a player with no recent plays has no music in their history
+	server.OverridePlayerData("play_hist", []byte(`{"status":0,"data":{"status":0,"easite_get_playerdata":{"result":0,"userid":{"code":12345678},"music_hist":{}}}}`))
+
+	client := util.GenerateClient()
+	if err := user.GetCookieFromEaGate("bst", "password", "", client); !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("login failed: %s", err.Message)
+	}
+	report, err := refreshDrsUser(client)
+	if !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("failed to refresh: %s", err.Message)
+	}
+	if len(report.EmptySections) != 1 || report.EmptySections[0] != "music_hist" {
+		t.Errorf("expected music_hist to be reported empty, got %v", report.EmptySections)
+	}
+
+	details, errs := db.GetDrsDb().RetrievePlayerDetailsByPlayerCode(12345678)
+	if len(errs) > 0 || details.Name != "FAKEDANCER" {
+		t.Fatalf("player details were not saved: %v %+v", errs, details)
+	}
+	stats, errs := db.GetDrsDb().RetrieveSongStatisticsByPlayerCode(12345678)
+	if len(errs) > 0 || len(stats) != 2 {
+		t.Errorf("expected 2 best scores to be saved, got %d %v", len(stats), errs)
+	}
+	scores, errs := db.GetDrsDb().RetrievePlayerScores(12345678)
+	if len(errs) > 0 || len(scores) != 0 {
+		t.Errorf("expected no plays to be saved, got %d %v", len(scores), errs)
+	}
+}
+
+func TestUpdateOnlyRefreshesNewPlays(t *testing.T) {
+	db.OpenDbMemory()
+	server := fake_eagate.NewServer()
+	defer server.Close()
+	server.AddUser("bst", "password", "")
+	for md5, character := range fake_eagate.CaptchaChecksums() {
+		user.RegisterCaptchaChecksum(md5, character)
+	}
+	base := util.EaBaseURI()
+	util.SetEaBaseURI(server.URL)
+	defer util.SetEaBaseURI(base)
+
+	client := util.GenerateClient()
+	client.SetUserModel(user_models.User{Name: "bst"})
+	if err := user.GetCookieFromEaGate("bst", "password", "", client); !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("login failed: %s", err.Message)
+	}
+	if err := updateDrsUser(client); !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("failed to update a new player: %s", err.Message)
+	}
+	details, errs := db.GetDrsDb().RetrievePlayerDetailsByPlayerCode(12345678)
+	if len(errs) > 0 {
+		t.Fatalf("player details were not saved: %v", errs)
+	}
+
+	// the play history is only loaded by a refresh, so a refresh would
+	// now fail validation
+	server.OverridePlayerData("play_hist", []byte(`{"status":0,"data":{"status":0,"easite_get_playerdata":{"result":0}}}`))
+	if err := updateDrsUser(client); !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("expected an unchanged play count not to refresh: %s", err.Message)
+	}
+	checked, errs := db.GetDrsDb().RetrievePlayerDetailsByPlayerCode(12345678)
+	if len(errs) > 0 || !checked.RefreshedAt.After(details.RefreshedAt) {
+		t.Errorf("expected the check to be recorded, got %s after %s %v", checked.RefreshedAt, details.RefreshedAt, errs)
+	}
+
+	server.OverridePlayerData("dancer_info", []byte(`{"status":0,"data":{"status":0,"easite_get_playerdata":{"result":0,"profile":{"name":"FAKEDANCER"},"statics_play":{"play_cnt":43,"play_sec":5400},"normal_dance_coin":{"total":120,"used":80,"limit":999},"camp":{"vote_rights_1":1,"vote_rights_2":0}}}}`))
+	if err := updateDrsUser(client); err.Equals(bst_models.ErrorOK) {
+		t.Errorf("expected a new play to refresh the player")
+	}
+}
@@ -0,0 +1,151 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"sort"
+	"time"
+)
+
+// partnerSummary is everything played by a player together with one
+// partner. Score is always the combined score of both players.
+type partnerSummary struct {
+	Code       int              `json:"code"`
+	Name       string           `json:"name"`
+	Plays      int              `json:"plays"`
+	LastPlayed time.Time        `json:"lastplayed"`
+	Trend      []partnerTrend   `json:"trend"`
+	Player     partnerJudgments `json:"player"`
+	Partner    partnerJudgments `json:"partner"`
+	BestCharts []partnerChart   `json:"bestcharts"`
+}
+
+// partnerTrend is the combined score of the plays made together in a
+// single month.
+type partnerTrend struct {
+	Month        string `json:"month"`
+	Plays        int    `json:"plays"`
+	AverageScore int    `json:"averagescore"`
+	BestScore    int    `json:"bestscore"`
+}
+
+// partnerJudgments are the totals of one side of every play made
+// together.
+type partnerJudgments struct {
+	Score    int `json:"score"`
+	Perfects int `json:"perfects"`
+	Greats   int `json:"greats"`
+	Goods    int `json:"goods"`
+	Bads     int `json:"bads"`
+}
+
+// partnerChart is the best combined score for a chart played together.
+type partnerChart struct {
+	SongId       string    `json:"id"`
+	Mode         string    `json:"mode"`
+	Difficulty   string    `json:"difficulty"`
+	Score        int       `json:"score"`
+	PlayerScore  int       `json:"playerscore"`
+	PartnerScore int       `json:"partnerscore"`
+	PlayTime     time.Time `json:"playtime"`
+}
+
+// summarisePartners will group the two player scores of the player with
+// code by partner, ordered by the number of plays together.
+func summarisePartners(code int, scores []drs_models.PlayerScore) []partnerSummary {
+	summaries := make(map[int]*partnerSummary)
+	months := make(map[int]map[string]*partnerTrend)
+	charts := make(map[int]map[string]*partnerChart)
+
+	for _, score := range scores {
+		if score.P2Code == nil {
+			continue
+		}
+		player := partnerJudgments{score.P1Score, score.P1Perfects, score.P1Greats, score.P1Goods, score.P1Bads}
+		partner := partnerJudgments{*score.P2Score, *score.P2Perfects, *score.P2Greats, *score.P2Goods, *score.P2Bads}
+		partnerCode := *score.P2Code
+		if score.P1Code != code {
+			player, partner = partner, player
+			partnerCode = score.P1Code
+		}
+
+		summary, exists := summaries[partnerCode]
+		if !exists {
+			summary = &partnerSummary{Code: partnerCode}
+			summaries[partnerCode] = summary
+			months[partnerCode] = make(map[string]*partnerTrend)
+			charts[partnerCode] = make(map[string]*partnerChart)
+		}
+		summary.Plays++
+		if score.PlayTime.After(summary.LastPlayed) {
+			summary.LastPlayed = score.PlayTime
+		}
+		summary.Player.add(player)
+		summary.Partner.add(partner)
+
+		month := score.PlayTime.UTC().Format("2006-01")
+		trend, exists := months[partnerCode][month]
+		if !exists {
+			trend = &partnerTrend{Month: month}
+			months[partnerCode][month] = trend
+		}
+		// AverageScore holds the running total until every play is added
+		trend.Plays++
+		trend.AverageScore += score.Score
+		if score.Score > trend.BestScore {
+			trend.BestScore = score.Score
+		}
+
+		chartKey := score.SongId + "/" + score.Mode + "/" + score.Difficulty
+		chart, exists := charts[partnerCode][chartKey]
+		if !exists || score.Score > chart.Score {
+			charts[partnerCode][chartKey] = &partnerChart{
+				SongId:       score.SongId,
+				Mode:         score.Mode,
+				Difficulty:   score.Difficulty,
+				Score:        score.Score,
+				PlayerScore:  player.Score,
+				PartnerScore: partner.Score,
+				PlayTime:     score.PlayTime,
+			}
+		}
+	}
+
+	result := make([]partnerSummary, 0, len(summaries))
+	for partnerCode, summary := range summaries {
+		summary.Trend = make([]partnerTrend, 0, len(months[partnerCode]))
+		for _, trend := range months[partnerCode] {
+			trend.AverageScore /= trend.Plays
+			summary.Trend = append(summary.Trend, *trend)
+		}
+		sort.Slice(summary.Trend, func(i, j int) bool {
+			return summary.Trend[i].Month < summary.Trend[j].Month
+		})
+
+		summary.BestCharts = make([]partnerChart, 0, len(charts[partnerCode]))
+		for _, chart := range charts[partnerCode] {
+			summary.BestCharts = append(summary.BestCharts, *chart)
+		}
+		sort.Slice(summary.BestCharts, func(i, j int) bool {
+			if summary.BestCharts[i].Score != summary.BestCharts[j].Score {
+				return summary.BestCharts[i].Score > summary.BestCharts[j].Score
+			}
+			return summary.BestCharts[i].PlayTime.Before(summary.BestCharts[j].PlayTime)
+		})
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Plays != result[j].Plays {
+			return result[i].Plays > result[j].Plays
+		}
+		return result[i].LastPlayed.After(result[j].LastPlayed)
+	})
+	return result
+}
+
+func (judgments *partnerJudgments) add(other partnerJudgments) {
+	judgments.Score += other.Score
+	judgments.Perfects += other.Perfects
+	judgments.Greats += other.Greats
+	judgments.Goods += other.Goods
+	judgments.Bads += other.Bads
+}
@@ -0,0 +1,85 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"testing"
+	"time"
+)
+
+func twoPlayerScore(p1 int, p1Score int, p2 int, p2Score int, song string, playTime time.Time) drs_models.PlayerScore {
+	zero := 0
+	return drs_models.PlayerScore{
+		Score:      p1Score + p2Score,
+		PlayTime:   playTime,
+		P1Code:     p1,
+		P1Score:    p1Score,
+		P1Perfects: p1Score / 100,
+		P2Code:     &p2,
+		P2Score:    &p2Score,
+		P2Perfects: &zero,
+		P2Greats:   &zero,
+		P2Goods:    &zero,
+		P2Bads:     &zero,
+		PlayerCode: 1,
+		SongId:     song,
+		Mode:       "DOUBLE",
+		Difficulty: "NORMAL",
+	}
+}
+
+func TestSummarisePartners(t *testing.T) {
+	march := time.Date(2021, time.March, 10, 12, 0, 0, 0, time.UTC)
+	april := time.Date(2021, time.April, 2, 12, 0, 0, 0, time.UTC)
+	scores := []drs_models.PlayerScore{
+		twoPlayerScore(1, 400, 2, 300, "a", march),
+		// the player was on the second side of this play
+		twoPlayerScore(2, 200, 1, 600, "a", march.Add(time.Hour)),
+		twoPlayerScore(1, 500, 2, 400, "b", april),
+		twoPlayerScore(1, 100, 3, 100, "a", april),
+		{Score: 1000, PlayTime: april, P1Code: 1, P1Score: 1000, PlayerCode: 1, SongId: "c"},
+	}
+
+	partners := summarisePartners(1, scores)
+	if len(partners) != 2 {
+		t.Fatalf("expected 2 partners but got %d", len(partners))
+	}
+	if partners[0].Code != 2 || partners[1].Code != 3 {
+		t.Fatalf("expected partners 2 then 3 but got %d then %d", partners[0].Code, partners[1].Code)
+	}
+
+	partner := partners[0]
+	if partner.Plays != 3 || !partner.LastPlayed.Equal(april) {
+		t.Errorf("expected 3 plays last played %s, got %d last played %s", april, partner.Plays, partner.LastPlayed)
+	}
+	if partner.Player.Score != 1500 || partner.Partner.Score != 900 {
+		t.Errorf("expected scores 1500 and 900 but got %d and %d", partner.Player.Score, partner.Partner.Score)
+	}
+	if partner.Player.Perfects != 9 || partner.Partner.Perfects != 2 {
+		t.Errorf("expected perfects 9 and 2 but got %d and %d", partner.Player.Perfects, partner.Partner.Perfects)
+	}
+
+	expectedTrend := []partnerTrend{
+		{Month: "2021-03", Plays: 2, AverageScore: 750, BestScore: 800},
+		{Month: "2021-04", Plays: 1, AverageScore: 900, BestScore: 900},
+	}
+	if len(partner.Trend) != len(expectedTrend) {
+		t.Fatalf("expected %d months but got %d", len(expectedTrend), len(partner.Trend))
+	}
+	for i, trend := range expectedTrend {
+		if partner.Trend[i] != trend {
+			t.Errorf("expected month %v but got %v", trend, partner.Trend[i])
+		}
+	}
+
+	if len(partner.BestCharts) != 2 {
+		t.Fatalf("expected 2 charts but got %d", len(partner.BestCharts))
+	}
+	best := partner.BestCharts[0]
+	if best.SongId != "b" || best.Score != 900 {
+		t.Errorf("expected song b with 900 first but got %s with %d", best.SongId, best.Score)
+	}
+	chart := partner.BestCharts[1]
+	if chart.SongId != "a" || chart.Score != 800 || chart.PlayerScore != 600 || chart.PartnerScore != 200 {
+		t.Errorf("expected song a with 600 and 200 from the second side, got %+v", chart)
+	}
+}
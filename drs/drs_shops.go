@@ -0,0 +1,106 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"html"
+	"sort"
+	"time"
+)
+
+// favouriteChartCount is the number of most played charts listed for
+// each shop.
+const favouriteChartCount = 5
+
+// shopSummary is where a player has played and what they play there.
+type shopSummary struct {
+	Shop            string      `json:"shop"`
+	Plays           int         `json:"plays"`
+	FirstVisit      time.Time   `json:"firstvisit"`
+	LastVisit       time.Time   `json:"lastvisit"`
+	FavouriteCharts []shopChart `json:"favouritecharts"`
+}
+
+type shopChart struct {
+	SongId     string `json:"id"`
+	Title      string `json:"title"`
+	Mode       string `json:"mode"`
+	Difficulty string `json:"difficulty"`
+	Plays      int    `json:"plays"`
+	BestScore  int    `json:"bestscore"`
+}
+
+// summariseShops will group a player's scores by shop, most played
+// first.
+func summariseShops(scores []drs_models.PlayerScore, songs []drs_models.Song) []shopSummary {
+	titles := make(map[string]string)
+	for _, song := range songs {
+		titles[song.SongId] = song.SongName
+	}
+
+	summaries := make(map[string]*shopSummary)
+	charts := make(map[string]map[string]*shopChart)
+	for _, score := range scores {
+		shop := html.UnescapeString(score.Shop)
+		summary, exists := summaries[shop]
+		if !exists {
+			summary = &shopSummary{Shop: shop, FirstVisit: score.PlayTime, LastVisit: score.PlayTime}
+			summaries[shop] = summary
+			charts[shop] = make(map[string]*shopChart)
+		}
+		summary.Plays++
+		if score.PlayTime.Before(summary.FirstVisit) {
+			summary.FirstVisit = score.PlayTime
+		}
+		if score.PlayTime.After(summary.LastVisit) {
+			summary.LastVisit = score.PlayTime
+		}
+
+		chartKey := score.SongId + "/" + score.Mode + "/" + score.Difficulty
+		chart, exists := charts[shop][chartKey]
+		if !exists {
+			chart = &shopChart{
+				SongId:     score.SongId,
+				Title:      titles[score.SongId],
+				Mode:       score.Mode,
+				Difficulty: score.Difficulty,
+			}
+			charts[shop][chartKey] = chart
+		}
+		chart.Plays++
+		if score.Score > chart.BestScore {
+			chart.BestScore = score.Score
+		}
+	}
+
+	result := make([]shopSummary, 0, len(summaries))
+	for shop, summary := range summaries {
+		summary.FavouriteCharts = make([]shopChart, 0, len(charts[shop]))
+		for _, chart := range charts[shop] {
+			summary.FavouriteCharts = append(summary.FavouriteCharts, *chart)
+		}
+		sort.Slice(summary.FavouriteCharts, func(i, j int) bool {
+			a, b := summary.FavouriteCharts[i], summary.FavouriteCharts[j]
+			if a.Plays != b.Plays {
+				return a.Plays > b.Plays
+			}
+			if a.SongId != b.SongId {
+				return a.SongId < b.SongId
+			}
+			if a.Mode != b.Mode {
+				return a.Mode < b.Mode
+			}
+			return a.Difficulty < b.Difficulty
+		})
+		if len(summary.FavouriteCharts) > favouriteChartCount {
+			summary.FavouriteCharts = summary.FavouriteCharts[:favouriteChartCount]
+		}
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Plays != result[j].Plays {
+			return result[i].Plays > result[j].Plays
+		}
+		return result[i].Shop < result[j].Shop
+	})
+	return result
+}
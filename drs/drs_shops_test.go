@@ -0,0 +1,93 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"testing"
+	"time"
+)
+
+func shopScore(shop string, song string, difficulty string, score int, playTime time.Time) drs_models.PlayerScore {
+	return drs_models.PlayerScore{
+		Shop:       shop,
+		Score:      score,
+		PlayTime:   playTime,
+		PlayerCode: 1,
+		SongId:     song,
+		Mode:       "SINGLE",
+		Difficulty: difficulty,
+	}
+}
+
+func TestSummariseShops(t *testing.T) {
+	first := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	last := time.Date(2021, time.April, 2, 12, 0, 0, 0, time.UTC)
+	songs := []drs_models.Song{{SongId: "a", SongName: "Song A"}, {SongId: "b", SongName: "Song B"}}
+	scores := []drs_models.PlayerScore{
+		// plays are not in time order
+		shopScore("Arcade &amp; Bar", "b", "EASY", 300, first.AddDate(0, 0, 7)),
+		shopScore("Arcade &amp; Bar", "a", "NORMAL", 500, last),
+		shopScore("Arcade &amp; Bar", "a", "NORMAL", 700, first),
+		shopScore("Arcade &amp; Bar", "a", "EASY", 400, first.AddDate(0, 0, 1)),
+		shopScore("Arcade &amp; Bar", "b", "EASY", 200, first.AddDate(0, 0, 2)),
+		shopScore("Other", "a", "EASY", 100, first),
+	}
+
+	shops := summariseShops(scores, songs)
+	if len(shops) != 2 {
+		t.Fatalf("expected 2 shops but got %d", len(shops))
+	}
+	shop := shops[0]
+	if shop.Shop != "Arcade & Bar" || shop.Plays != 5 {
+		t.Fatalf("expected 5 plays at Arcade & Bar first, got %d at %s", shop.Plays, shop.Shop)
+	}
+	if !shop.FirstVisit.Equal(first) || !shop.LastVisit.Equal(last) {
+		t.Errorf("expected visits from %s to %s, got %s to %s", first, last, shop.FirstVisit, shop.LastVisit)
+	}
+
+	// most played first, with ties broken by song and difficulty
+	expected := []struct {
+		song       string
+		difficulty string
+		plays      int
+		best       int
+	}{
+		{"a", "NORMAL", 2, 700},
+		{"b", "EASY", 2, 300},
+		{"a", "EASY", 1, 400},
+	}
+	if len(shop.FavouriteCharts) != len(expected) {
+		t.Fatalf("expected %d favourite charts but got %d", len(expected), len(shop.FavouriteCharts))
+	}
+	for i, e := range expected {
+		chart := shop.FavouriteCharts[i]
+		if chart.SongId != e.song || chart.Difficulty != e.difficulty || chart.Plays != e.plays || chart.BestScore != e.best {
+			t.Errorf("expected chart %d to be %s %s with %d plays and best %d, got %+v", i, e.song, e.difficulty, e.plays, e.best, chart)
+		}
+	}
+	if shop.FavouriteCharts[0].Title != "Song A" {
+		t.Errorf("expected the title to be Song A but got %s", shop.FavouriteCharts[0].Title)
+	}
+
+	other := shops[1]
+	if other.Shop != "Other" || !other.FirstVisit.Equal(first) || !other.LastVisit.Equal(first) {
+		t.Errorf("expected one visit to Other on %s, got %+v", first, other)
+	}
+}
+
+func TestSummariseShopsLimitsFavourites(t *testing.T) {
+	played := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	scores := make([]drs_models.PlayerScore, 0)
+	for _, song := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		scores = append(scores, shopScore("Arcade", song, "EASY", 100, played))
+	}
+	scores = append(scores, shopScore("Arcade", "g", "EASY", 100, played))
+
+	shops := summariseShops(scores, nil)
+	if len(shops) != 1 || len(shops[0].FavouriteCharts) != favouriteChartCount {
+		t.Fatalf("expected %d favourite charts, got %+v", favouriteChartCount, shops)
+	}
+	charts := shops[0].FavouriteCharts
+	if charts[0].SongId != "g" || charts[favouriteChartCount-1].SongId != "d" {
+		t.Errorf("expected g first and d last but got %s and %s", charts[0].SongId, charts[favouriteChartCount-1].SongId)
+	}
+}
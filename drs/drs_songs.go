@@ -0,0 +1,72 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/db/drs_db"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/chris-sg/bst_api/utilities"
+	"sort"
+	"strings"
+)
+
+// songListing adds romaji readings to a song when they are requested.
+type songListing struct {
+	drs_models.Song
+	TitleRomaji  string `json:"titleromaji,omitempty"`
+	ArtistRomaji string `json:"artistromaji,omitempty"`
+}
+
+// readingKey is what a song is sorted by when sorting by reading. Songs
+// without a reading sort by their title.
+func readingKey(reading string, title string) string {
+	if len(reading) == 0 {
+		reading = title
+	}
+	return strings.ToLower(utilities.NormaliseKana(reading))
+}
+
+// listSongs will find the songs matching search by title, artist or
+// their readings, sorted by reading, title or id.
+func listSongs(songs []drs_models.Song, search string, sortBy string, romaji bool) []songListing {
+	listings := make([]songListing, 0, len(songs))
+	for _, song := range songs {
+		if !utilities.MatchesReading(search, song.SongName, song.SongYomigana, song.ArtistName, song.ArtistYomigana) {
+			continue
+		}
+		listing := songListing{Song: song}
+		if romaji {
+			listing.TitleRomaji = utilities.Romaji(song.SongYomigana)
+			listing.ArtistRomaji = utilities.Romaji(song.ArtistYomigana)
+		}
+		listings = append(listings, listing)
+	}
+
+	sort.SliceStable(listings, func(i, j int) bool {
+		a, b := listings[i], listings[j]
+		switch sortBy {
+		case "id":
+			return a.SongId < b.SongId
+		case "title":
+			return strings.ToLower(a.SongName) < strings.ToLower(b.SongName)
+		default:
+			return readingKey(a.SongYomigana, a.SongName) < readingKey(b.SongYomigana, b.SongName)
+		}
+	})
+	return listings
+}
+
+// filterTableData will keep the charts whose song matches search, and
+// when sorting by reading will order them by song reading.
+func filterTableData(rows []drs_db.DrsDataTable, search string, sortBy string) []drs_db.DrsDataTable {
+	filtered := make([]drs_db.DrsDataTable, 0, len(rows))
+	for _, row := range rows {
+		if utilities.MatchesReading(search, row.Title, row.TitleYomigana, row.Artist, row.ArtistYomigana) {
+			filtered = append(filtered, row)
+		}
+	}
+	if sortBy == "reading" {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return readingKey(filtered[i].TitleYomigana, filtered[i].Title) < readingKey(filtered[j].TitleYomigana, filtered[j].Title)
+		})
+	}
+	return filtered
+}
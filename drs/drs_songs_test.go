@@ -0,0 +1,130 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/db/drs_db"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"testing"
+)
+
+func readingSongs() []drs_models.Song {
+	return []drs_models.Song{
+		{SongId: "3", SongName: "曲C", SongYomigana: "サクラ"},
+		// half width katakana, as some readings are given
+		{SongId: "1", SongName: "曲A", SongYomigana: "ｶｻ"},
+		{SongId: "2", SongName: "曲B", SongYomigana: "あめ", ArtistYomigana: "ユキ"},
+		// songs without a reading sort by title
+		{SongId: "4", SongName: "Zebra"},
+	}
+}
+
+func songIds(listings []songListing) (ids []string) {
+	for _, listing := range listings {
+		ids = append(ids, listing.SongId)
+	}
+	return
+}
+
+func TestListSongsSort(t *testing.T) {
+	tests := []struct {
+		sortBy   string
+		expected []string
+	}{
+		{"", []string{"4", "2", "1", "3"}},
+		{"reading", []string{"4", "2", "1", "3"}},
+		{"title", []string{"4", "1", "2", "3"}},
+		{"id", []string{"1", "2", "3", "4"}},
+	}
+
+	for _, test := range tests {
+		ids := songIds(listSongs(readingSongs(), "", test.sortBy, false))
+		if len(ids) != len(test.expected) {
+			t.Errorf("sort %s: expected %v but got %v", test.sortBy, test.expected, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != test.expected[i] {
+				t.Errorf("sort %s: expected %v but got %v", test.sortBy, test.expected, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestListSongsSearch(t *testing.T) {
+	tests := []struct {
+		search   string
+		expected []string
+	}{
+		{"さくら", []string{"3"}},
+		{"kasa", []string{"1"}},
+		{"カサ", []string{"1"}},
+		{"yuki", []string{"2"}},
+		{"曲", []string{"2", "1", "3"}},
+		{"zeb", []string{"4"}},
+		{"dance", nil},
+	}
+
+	for _, test := range tests {
+		ids := songIds(listSongs(readingSongs(), test.search, "reading", false))
+		if len(ids) != len(test.expected) {
+			t.Errorf("search %s: expected %v but got %v", test.search, test.expected, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != test.expected[i] {
+				t.Errorf("search %s: expected %v but got %v", test.search, test.expected, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestListSongsRomaji(t *testing.T) {
+	listings := listSongs(readingSongs(), "sakura", "", true)
+	if len(listings) != 1 || listings[0].TitleRomaji != "sakura" {
+		t.Fatalf("expected sakura to be listed with its romaji, got %+v", listings)
+	}
+	for _, listing := range listSongs(readingSongs(), "", "", false) {
+		if len(listing.TitleRomaji) != 0 || len(listing.ArtistRomaji) != 0 {
+			t.Errorf("expected no romaji unless requested, got %+v", listing)
+		}
+	}
+}
+
+func TestFilterTableData(t *testing.T) {
+	rows := []drs_db.DrsDataTable{
+		{SongId: "3", Title: "曲C", TitleYomigana: "サクラ", Difficulty: "EASY"},
+		{SongId: "1", Title: "曲A", TitleYomigana: "カサ", Difficulty: "EASY"},
+		{SongId: "3", Title: "曲C", TitleYomigana: "サクラ", Difficulty: "NORMAL"},
+		{SongId: "2", Title: "曲B", TitleYomigana: "アメ", Artist: "x", ArtistYomigana: "ユキ", Difficulty: "EASY"},
+	}
+	chart := func(row drs_db.DrsDataTable) string {
+		return row.SongId + "/" + row.Difficulty
+	}
+
+	tests := []struct {
+		search   string
+		sortBy   string
+		expected []string
+	}{
+		// the table order is kept unless sorting by reading
+		{"", "", []string{"3/EASY", "1/EASY", "3/NORMAL", "2/EASY"}},
+		{"", "reading", []string{"2/EASY", "1/EASY", "3/EASY", "3/NORMAL"}},
+		{"さくら", "", []string{"3/EASY", "3/NORMAL"}},
+		{"yuki", "reading", []string{"2/EASY"}},
+		{"dance", "reading", nil},
+	}
+
+	for _, test := range tests {
+		filtered := filterTableData(rows, test.search, test.sortBy)
+		if len(filtered) != len(test.expected) {
+			t.Errorf("search %s sort %s: expected %d charts but got %d", test.search, test.sortBy, len(test.expected), len(filtered))
+			continue
+		}
+		for i := range filtered {
+			if chart(filtered[i]) != test.expected[i] {
+				t.Errorf("search %s sort %s: expected %s at %d but got %s", test.search, test.sortBy, test.expected[i], i, chart(filtered[i]))
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"time"
+)
+
+// unlockSong is a song the player has unlocked, or may still unlock.
+// UnlockedAt is nil for locked songs and for songs unlocked before the
+// player's unlocks were first read.
+type unlockSong struct {
+	SongId     string     `json:"id"`
+	Title      string     `json:"title"`
+	Artist     string     `json:"artist"`
+	UnlockedAt *time.Time `json:"unlockedat,omitempty"`
+}
+
+// unlockStars is the dance star balance of a player. Held stars may not
+// go over the limit, so Remaining is how many more can be earned before
+// any are spent.
+type unlockStars struct {
+	Total     int `json:"total"`
+	Used      int `json:"used"`
+	Held      int `json:"held"`
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+}
+
+type unlockSummary struct {
+	Unlocked    []unlockSong `json:"unlocked"`
+	Locked      []unlockSong `json:"locked"`
+	Stars       unlockStars  `json:"stars"`
+	VoteRights1 int          `json:"voterights1"`
+	VoteRights2 int          `json:"voterights2"`
+}
+
+// summariseUnlocks will split songs into those unlocked by the player
+// and those still locked, which are songs with a limitation type the
+// player has not unlocked. Star and vote details come from the latest
+// snapshot.
+func summariseUnlocks(songs []drs_models.Song, unlocks []drs_models.PlayerUnlock, snapshot drs_models.PlayerProfileSnapshot) (summary unlockSummary) {
+	songsById := make(map[string]drs_models.Song)
+	for _, song := range songs {
+		songsById[song.SongId] = song
+	}
+
+	summary.Unlocked = make([]unlockSong, 0, len(unlocks))
+	unlocked := make(map[string]bool)
+	for i := range unlocks {
+		song := songsById[unlocks[i].SongId]
+		summary.Unlocked = append(summary.Unlocked, unlockSong{
+			SongId:     unlocks[i].SongId,
+			Title:      song.SongName,
+			Artist:     song.ArtistName,
+			UnlockedAt: unlocks[i].UnlockedAt,
+		})
+		unlocked[unlocks[i].SongId] = true
+	}
+
+	summary.Locked = make([]unlockSong, 0)
+	for _, song := range songs {
+		if song.LimitationType == 0 || unlocked[song.SongId] {
+			continue
+		}
+		summary.Locked = append(summary.Locked, unlockSong{
+			SongId: song.SongId,
+			Title:  song.SongName,
+			Artist: song.ArtistName,
+		})
+	}
+
+	summary.Stars = unlockStars{
+		Total: snapshot.TotalStars,
+		Used:  snapshot.UsedStars,
+		Held:  snapshot.TotalStars - snapshot.UsedStars,
+		Limit: snapshot.StarLimit,
+	}
+	if summary.Stars.Limit > summary.Stars.Held {
+		summary.Stars.Remaining = summary.Stars.Limit - summary.Stars.Held
+	}
+	summary.VoteRights1 = snapshot.VoteRights1
+	summary.VoteRights2 = snapshot.VoteRights2
+	return
+}
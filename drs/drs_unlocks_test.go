@@ -0,0 +1,66 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"testing"
+	"time"
+)
+
+func TestSummariseUnlocks(t *testing.T) {
+	unlockedAt := time.Date(2021, time.March, 10, 12, 0, 0, 0, time.UTC)
+	songs := []drs_models.Song{
+		{SongId: "free", SongName: "Free"},
+		{SongId: "earned", SongName: "Earned", ArtistName: "A", LimitationType: 1},
+		{SongId: "old", SongName: "Old", LimitationType: 1},
+		{SongId: "locked", SongName: "Locked", ArtistName: "B", LimitationType: 2},
+	}
+	unlocks := []drs_models.PlayerUnlock{
+		{UnlockedAt: &unlockedAt, PlayerCode: 1, SongId: "earned"},
+		// unlocked before unlocks were first read
+		{PlayerCode: 1, SongId: "old"},
+	}
+
+	summary := summariseUnlocks(songs, unlocks, drs_models.PlayerProfileSnapshot{TotalStars: 50, UsedStars: 20, StarLimit: 100})
+	if len(summary.Unlocked) != 2 {
+		t.Fatalf("expected 2 unlocked songs but got %d", len(summary.Unlocked))
+	}
+	earned := summary.Unlocked[0]
+	if earned.SongId != "earned" || earned.Title != "Earned" || earned.Artist != "A" || earned.UnlockedAt == nil || !earned.UnlockedAt.Equal(unlockedAt) {
+		t.Errorf("expected earned to be unlocked at %s, got %+v", unlockedAt, earned)
+	}
+	if summary.Unlocked[1].SongId != "old" || summary.Unlocked[1].UnlockedAt != nil {
+		t.Errorf("expected old to be unlocked at an unknown time, got %+v", summary.Unlocked[1])
+	}
+	// songs without a limitation are never locked
+	if len(summary.Locked) != 1 || summary.Locked[0].SongId != "locked" || summary.Locked[0].Artist != "B" {
+		t.Errorf("expected only locked to be locked, got %+v", summary.Locked)
+	}
+
+	stars := summary.Stars
+	if stars.Held != 30 || stars.Remaining != 70 {
+		t.Errorf("expected 30 held and 70 remaining stars but got %d and %d", stars.Held, stars.Remaining)
+	}
+}
+
+func TestSummariseUnlocksRemainingStars(t *testing.T) {
+	tests := []struct {
+		name      string
+		snapshot  drs_models.PlayerProfileSnapshot
+		remaining int
+	}{
+		{"held stars at the limit", drs_models.PlayerProfileSnapshot{TotalStars: 120, UsedStars: 20, StarLimit: 100}, 0},
+		{"held stars over the limit", drs_models.PlayerProfileSnapshot{TotalStars: 150, UsedStars: 20, StarLimit: 100}, 0},
+		{"no limit recorded", drs_models.PlayerProfileSnapshot{TotalStars: 50}, 0},
+		{"nothing held", drs_models.PlayerProfileSnapshot{TotalStars: 20, UsedStars: 20, StarLimit: 100}, 100},
+	}
+
+	for _, test := range tests {
+		summary := summariseUnlocks(nil, nil, test.snapshot)
+		if summary.Stars.Remaining != test.remaining {
+			t.Errorf("%s: expected %d remaining stars but got %d", test.name, test.remaining, summary.Stars.Remaining)
+		}
+		if len(summary.Unlocked) != 0 || len(summary.Locked) != 0 {
+			t.Errorf("%s: expected no songs but got %+v", test.name, summary)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/db/db_builder"
+	"github.com/chris-sg/bst_api/db/drs_db"
+	"github.com/chris-sg/bst_api/eagate/util"
+	"github.com/chris-sg/bst_api/games"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	bstServerModels "github.com/chris-sg/bst_server_models"
+	"github.com/gorilla/mux"
+)
+
+// Module serves and updates DANCERUSH STARDOM.
+type Module struct{}
+
+func (Module) Name() string {
+	return "drs"
+}
+
+func (Module) Router() *mux.Router {
+	return CreateDrsRouter()
+}
+
+func (Module) Migrations() []db_builder.Migration {
+	return drs_db.Migrations
+}
+
+func (Module) AutoUpdate(profile bst_models.BstProfile) bool {
+	return profile.DrsAutoUpdate
+}
+
+// Update will refresh the user only when their play count has changed,
+// as eagate only offers drs data as a whole and the hourly job would
+// otherwise reload everything for every user. Anything that could not
+// be saved is logged by the refresh.
+func (Module) Update(client util.EaClient) bstServerModels.Error {
+	return updateDrsUser(client)
+}
+
+func (Module) Refresh(client util.EaClient) bstServerModels.Error {
+	_, err := refreshDrsUser(client)
+	return err
+}
+
+func (module Module) Status() games.Status {
+	return games.ParserStatus(module.Name())
+}
@@ -2,15 +2,31 @@ package drs
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/chris-sg/bst_api/common"
 	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/db/db_dialect"
+	"github.com/chris-sg/bst_api/db/drs_db"
+	"github.com/chris-sg/bst_api/eagate/drs"
 	"github.com/chris-sg/bst_api/eagate/user"
+	"github.com/chris-sg/bst_api/models/drs_models"
 	"github.com/chris-sg/bst_api/utilities"
 	bst_models "github.com/chris-sg/bst_server_models"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
 	"github.com/urfave/negroni"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultScoresLimit = 50
+	maxScoresLimit     = 200
+
+	defaultPartnersLimit = 10
 )
 
 // CreateDrsRouter will create a mux router to be attached to
@@ -21,18 +37,52 @@ func CreateDrsRouter() *mux.Router {
 	drsRouter.Path("/profile").Handler(utilities.GetProtectionMiddleware().With(
 		negroni.Wrap(http.HandlerFunc(ProfilePatch)))).Methods(http.MethodPatch)
 
+	drsRouter.Path("/profile/history").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(ProfileHistoryGet)))).Methods(http.MethodGet)
+
 	drsRouter.Path("/details").Handler(utilities.GetProtectionMiddleware().With(
 		negroni.Wrap(http.HandlerFunc(DetailsGet)))).Methods(http.MethodGet)
 
+	drsRouter.Path("/songs").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(SongsGet)))).Methods(http.MethodGet)
+
 	drsRouter.Path("/songs/stats").Handler(utilities.GetProtectionMiddleware().With(
 		negroni.Wrap(http.HandlerFunc(SongStatsGet)))).Methods(http.MethodGet)
 
+	drsRouter.Path("/scores").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(ScoresGet)))).Methods(http.MethodGet)
+
+	drsRouter.Path("/unlocks").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(UnlocksGet)))).Methods(http.MethodGet)
+
+	drsRouter.Path("/shops").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(ShopsGet)))).Methods(http.MethodGet)
+
+	drsRouter.Path("/shops/public").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(PublicShopsGet)))).Methods(http.MethodGet)
+
+	drsRouter.Path("/partners").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(PartnersGet)))).Methods(http.MethodGet)
+
+	drsRouter.Path("/videos").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(VideosGet)))).Methods(http.MethodGet)
+
+	drsRouter.Path("/videos/{id:[0-9]+}").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(VideoGet)))).Methods(http.MethodGet)
+
 	drsRouter.Path("/tabledata").Handler(utilities.GetProtectionMiddleware().With(
 		negroni.Wrap(http.HandlerFunc(TableDataGet)))).Methods(http.MethodGet)
 
 	return drsRouter
 }
 
+// profileRefresh is the result of refreshing each eagate account of a
+// user, with a report of anything eagate sent that could not be saved.
+type profileRefresh struct {
+	bst_models.Error
+	Reports map[string]drs.TransformReport `json:"reports"`
+}
+
 // DrsUpdateUser will load all data provided by the Dance
 // Rush API.
 func ProfilePatch(rw http.ResponseWriter, r *http.Request) {
@@ -42,41 +92,44 @@ func ProfilePatch(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	errCount := 0
+	refresh := profileRefresh{
+		Error:   bst_models.ErrorOK,
+		Reports: make(map[string]drs.TransformReport),
+	}
 	for _, username := range usernames {
-		if !func() bool {
+		err = func() bst_models.Error {
 			userModel, exists, errs := db.GetUserDb().RetrieveUserByUserId(username)
 			if !exists {
 				glog.Warningf("user %s does not exist in db", username)
-				return false
+				return bst_models.ErrorDrsPlayerInfo
 			}
 			if utilities.PrintErrors("failed to retrieve user from db: ", errs) {
-				return false
+				return bst_models.ErrorDrsPlayerInfo
 			}
 			client, err := user.CreateClientForUser(userModel)
 			defer client.UpdateCookie()
 			if !err.Equals(bst_models.ErrorOK) {
 				glog.Errorf("failed to create client: %s", err.Message)
-				utilities.RespondWithError(rw, err)
-				return false
+				return err
 			}
 
-			err = refreshDrsUser(client)
+			report, err := refreshDrsUser(client)
 			if !err.Equals(bst_models.ErrorOK) {
 				glog.Errorf("failed to refresh user: %s", err.Message)
-				utilities.RespondWithError(rw, err)
-				return false
+				return err
 			}
-			return true
-		}() {
-			errCount++
+			refresh.Reports[username] = report
+			return bst_models.ErrorOK
+		}()
+		if !err.Equals(bst_models.ErrorOK) {
+			utilities.RespondWithError(rw, err)
+			return
 		}
 	}
-	if errCount > 0 {
-		utilities.RespondWithError(rw, bst_models.ErrorDrsPlayerInfo)
-	}
 
-	utilities.RespondWithError(rw, bst_models.ErrorOK)
+	bytes, _ := json.Marshal(refresh)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
 	return
 }
 
@@ -160,7 +213,474 @@ func TableDataGet(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query := r.URL.Query()
+	search := query.Get("search")
+	sortBy := query.Get("sort")
+	if len(sortBy) > 0 && sortBy != "reading" {
+		utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+		return
+	}
+	if len(search) > 0 || len(sortBy) > 0 {
+		rows := make([]drs_db.DrsDataTable, 0)
+		if e := json.Unmarshal([]byte(tableData), &rows); e != nil {
+			glog.Errorf("failed to decode table data for %d: %s\n", details.Code, e.Error())
+			utilities.RespondWithError(rw, bst_models.ErrorDrsPlayerInfoDbRead)
+			return
+		}
+		bytes, _ := json.Marshal(filterTableData(rows, search, sortBy))
+		tableData = string(bytes)
+	}
+
 	rw.WriteHeader(http.StatusOK)
 	_, _ = rw.Write([]byte(tableData))
 	return
-}
\ No newline at end of file
+}
+
+// SongsGet will list every known song, sorted by reading so Japanese
+// titles group by how they are read. The `search` query parameter
+// matches titles, artists and their readings in kana or romaji, `sort`
+// may be `reading`, `title` or `id`, and `romaji=true` adds romaji
+// readings.
+func SongsGet(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sortBy := query.Get("sort")
+	if len(sortBy) > 0 && sortBy != "reading" && sortBy != "title" && sortBy != "id" {
+		utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+		return
+	}
+	romaji := false
+	if romajiString := query.Get("romaji"); len(romajiString) > 0 {
+		parsed, e := strconv.ParseBool(romajiString)
+		if e != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+			return
+		}
+		romaji = parsed
+	}
+
+	songs, errs := db.GetDrsDb().RetrieveSongs()
+	if utilities.PrintErrors("failed to retrieve songs:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+
+	bytes, _ := json.Marshal(listSongs(songs, query.Get("search"), sortBy, romaji))
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+// scoresPage is a single page of a player's scores.
+type scoresPage struct {
+	Total  int                      `json:"total"`
+	Offset int                      `json:"offset"`
+	Limit  int                      `json:"limit"`
+	Scores []drs_models.PlayerScore `json:"scores"`
+}
+
+// ProfileHistoryGet will retrieve every profile snapshot for the user
+// with the plays, minutes danced and stars earned and spent since the
+// snapshot before it. The `start` and `end` dates (formatted as
+// 2006-01-02, inclusive) limit the snapshots returned.
+func ProfileHistoryGet(rw http.ResponseWriter, r *http.Request) {
+	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+	if len(usernames) == 0 {
+		utilities.RespondWithError(rw, bst_models.ErrorNoEaUser)
+		return
+	}
+	details, err := retrieveDrsPlayerDetails(usernames[0])
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	query := r.URL.Query()
+	start := time.Time{}
+	end := time.Now()
+	if startDateString := query.Get("start"); len(startDateString) > 0 {
+		from, e := time.ParseInLocation("2006-01-02", startDateString, time.UTC)
+		if e != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorTimeParse)
+			return
+		}
+		start = from
+	}
+	if endDateString := query.Get("end"); len(endDateString) > 0 {
+		to, e := time.ParseInLocation("2006-01-02", endDateString, time.UTC)
+		if e != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorTimeParse)
+			return
+		}
+		end = to.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+
+	snapshots, errs := db.GetDrsDb().RetrievePlayerProfileSnapshots(details.Code, start, end)
+	if utilities.PrintErrors("failed to retrieve profile snapshots:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsPlayerInfoDbRead)
+		return
+	}
+	// the snapshot before start is needed for the first delta
+	previous, errs := db.GetDrsDb().RetrievePlayerProfileSnapshotBefore(details.Code, start)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		errs = nil
+	} else if len(errs) == 0 {
+		snapshots = append([]drs_models.PlayerProfileSnapshot{previous}, snapshots...)
+	}
+	if utilities.PrintErrors("failed to retrieve profile snapshot:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsPlayerInfoDbRead)
+		return
+	}
+
+	bytes, _ := json.Marshal(profileHistory(snapshots, start))
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+// ScoresGet will retrieve a page of every recorded play for the user,
+// newest first unless ordered otherwise. The `start` and `end` dates
+// (formatted as 2006-01-02, inclusive) and the `id`, `mode` and
+// `difficulty` query parameters filter the plays.
+func ScoresGet(rw http.ResponseWriter, r *http.Request) {
+	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+	if len(usernames) == 0 {
+		utilities.RespondWithError(rw, bst_models.ErrorNoEaUser)
+		return
+	}
+	details, err := retrieveDrsPlayerDetails(usernames[0])
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := drs_db.PlayerScoreFilter{
+		SongId:     query.Get("id"),
+		Mode:       query.Get("mode"),
+		Difficulty: query.Get("difficulty"),
+		Ordering:   query["ordering"],
+		Limit:      defaultScoresLimit,
+	}
+	if e := db_dialect.CheckOrdering(filter.Ordering, drs_db.PlayerScoreColumns); e != nil {
+		glog.Warningf("bad scores ordering: %s\n", e.Error())
+		utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+		return
+	}
+	if startDateString := query.Get("start"); len(startDateString) > 0 {
+		start, e := time.ParseInLocation("2006-01-02", startDateString, time.UTC)
+		if e != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorTimeParse)
+			return
+		}
+		filter.From = start
+	}
+	if endDateString := query.Get("end"); len(endDateString) > 0 {
+		end, e := time.ParseInLocation("2006-01-02", endDateString, time.UTC)
+		if e != nil {
+			utilities.RespondWithError(rw, bst_models.ErrorTimeParse)
+			return
+		}
+		filter.To = end.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	if limitString := query.Get("limit"); len(limitString) > 0 {
+		limit, e := strconv.Atoi(limitString)
+		if e != nil || limit < 1 || limit > maxScoresLimit {
+			utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+			return
+		}
+		filter.Limit = limit
+	}
+	if offsetString := query.Get("offset"); len(offsetString) > 0 {
+		offset, e := strconv.Atoi(offsetString)
+		if e != nil || offset < 0 {
+			utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	scores, total, errs := db.GetDrsDb().RetrieveFilteredPlayerScores(details.Code, filter)
+	if utilities.PrintErrors("failed to retrieve scores:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+
+	bytes, _ := json.Marshal(scoresPage{total, filter.Offset, filter.Limit, scores})
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+// videoCatalogEntry adds the location to watch a video from, which is
+// the archived copy when there is one as eagate links expire.
+type videoCatalogEntry struct {
+	drs_db.VideoCatalogEntry
+	Url string `json:"url"`
+}
+
+// VideosGet will list every play with a video for the user, newest
+// first.
+func VideosGet(rw http.ResponseWriter, r *http.Request) {
+	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+	if len(usernames) == 0 {
+		utilities.RespondWithError(rw, bst_models.ErrorNoEaUser)
+		return
+	}
+	details, err := retrieveDrsPlayerDetails(usernames[0])
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	entries, errs := db.GetDrsDb().RetrieveVideoCatalog(details.Code)
+	if utilities.PrintErrors("failed to retrieve video catalog:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+
+	catalog := make([]videoCatalogEntry, 0, len(entries))
+	for _, entry := range entries {
+		url := entry.VideoUrl
+		if entry.ArchiveId != nil {
+			url = fmt.Sprintf("%s/drs/videos/%d", strings.TrimSuffix(utilities.ApiBase, "/"), *entry.ArchiveId)
+		}
+		catalog = append(catalog, videoCatalogEntry{entry, url})
+	}
+
+	bytes, _ := json.Marshal(catalog)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+// VideoGet will serve the archived copy of one of the user's videos.
+func VideoGet(rw http.ResponseWriter, r *http.Request) {
+	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+	if len(usernames) == 0 {
+		utilities.RespondWithError(rw, bst_models.ErrorNoEaUser)
+		return
+	}
+	details, err := retrieveDrsPlayerDetails(usernames[0])
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	id, e := strconv.Atoi(mux.Vars(r)["id"])
+	if e != nil {
+		utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+		return
+	}
+
+	video, errs := db.GetDrsDb().RetrieveArchivedVideo(id)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		http.NotFound(rw, r)
+		return
+	}
+	if utilities.PrintErrors("failed to retrieve archived video:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+
+	// the video may have been archived for the other player of the play,
+	// so access is checked against the user's catalog
+	if video.PlayerCode != details.Code {
+		entries, errs := db.GetDrsDb().RetrieveVideoCatalog(details.Code)
+		if utilities.PrintErrors("failed to retrieve video catalog:", errs) {
+			utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+			return
+		}
+		played := false
+		for _, entry := range entries {
+			if entry.ArchiveId != nil && *entry.ArchiveId == id {
+				played = true
+				break
+			}
+		}
+		if !played {
+			http.NotFound(rw, r)
+			return
+		}
+	}
+
+	path := utilities.ArchivedVideoPath(video)
+	if len(path) == 0 {
+		http.NotFound(rw, r)
+		return
+	}
+	http.ServeFile(rw, r, path)
+}
+
+// UnlocksGet will list the songs the user has unlocked and those still
+// locked, along with their dance stars, star limit and camp vote rights
+// as of their latest profile snapshot.
+func UnlocksGet(rw http.ResponseWriter, r *http.Request) {
+	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+	if len(usernames) == 0 {
+		utilities.RespondWithError(rw, bst_models.ErrorNoEaUser)
+		return
+	}
+	details, err := retrieveDrsPlayerDetails(usernames[0])
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	drsDb := db.GetDrsDb()
+	snapshot, errs := drsDb.RetrieveRecentPlayerProfileSnapshot(details.Code)
+	if len(errs) == 1 && gorm.IsRecordNotFoundError(errs[0]) {
+		errs = nil
+	}
+	if utilities.PrintErrors("failed to retrieve profile snapshot:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsPlayerInfoDbRead)
+		return
+	}
+	unlocks, errs := drsDb.RetrievePlayerUnlocks(details.Code)
+	if utilities.PrintErrors("failed to retrieve unlocks:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsPlayerInfoDbRead)
+		return
+	}
+	songs, errs := drsDb.RetrieveSongs()
+	if utilities.PrintErrors("failed to retrieve songs:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+
+	bytes, _ := json.Marshal(summariseUnlocks(songs, unlocks, snapshot))
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+// ShopsGet will list the shops the user has played at, most played
+// first, with their most played charts at each.
+func ShopsGet(rw http.ResponseWriter, r *http.Request) {
+	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+	if len(usernames) == 0 {
+		utilities.RespondWithError(rw, bst_models.ErrorNoEaUser)
+		return
+	}
+	details, err := retrieveDrsPlayerDetails(usernames[0])
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	scores, errs := db.GetDrsDb().RetrievePlayerScores(details.Code)
+	if utilities.PrintErrors("failed to retrieve scores:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+	songs, errs := db.GetDrsDb().RetrieveSongs()
+	if utilities.PrintErrors("failed to retrieve songs:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+
+	bytes, _ := json.Marshal(summariseShops(scores, songs))
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+// PublicShopsGet will list the shops played at by players with a public
+// profile, most played first.
+func PublicShopsGet(rw http.ResponseWriter, r *http.Request) {
+	shops, errs := db.GetDrsDb().RetrievePublicShopActivity()
+	if utilities.PrintErrors("failed to retrieve public shops:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+
+	bytes, _ := json.Marshal(shops)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
+
+// PartnersGet will summarise the two player plays of the user for each
+// partner they have played with, most played first. Partners who are
+// registered players are named. The `limit` query parameter sets how
+// many partners are returned.
+func PartnersGet(rw http.ResponseWriter, r *http.Request) {
+	usernames, err := common.RetrieveEaGateUsernamesForRequest(r)
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+	if len(usernames) == 0 {
+		utilities.RespondWithError(rw, bst_models.ErrorNoEaUser)
+		return
+	}
+	details, err := retrieveDrsPlayerDetails(usernames[0])
+	if !err.Equals(bst_models.ErrorOK) {
+		utilities.RespondWithError(rw, err)
+		return
+	}
+
+	limit := defaultPartnersLimit
+	if limitString := r.URL.Query().Get("limit"); len(limitString) > 0 {
+		l, e := strconv.Atoi(limitString)
+		if e != nil || l < 1 {
+			utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+			return
+		}
+		limit = l
+	}
+
+	scores, errs := db.GetDrsDb().RetrievePlayerScores(details.Code)
+	if utilities.PrintErrors("failed to retrieve scores:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsSongDataDbRead)
+		return
+	}
+
+	partners := summarisePartners(details.Code, scores)
+	if len(partners) > limit {
+		partners = partners[:limit]
+	}
+	codes := make([]int, 0, len(partners))
+	for _, partner := range partners {
+		codes = append(codes, partner.Code)
+	}
+	partnerDetails, errs := db.GetDrsDb().RetrievePlayerDetailsByPlayerCodes(codes)
+	if utilities.PrintErrors("failed to retrieve partner details:", errs) {
+		utilities.RespondWithError(rw, bst_models.ErrorDrsPlayerInfoDbRead)
+		return
+	}
+	names := make(map[int]string)
+	for _, partner := range partnerDetails {
+		names[partner.Code] = partner.Name
+	}
+	for i := range partners {
+		partners[i].Name = names[partners[i].Code]
+	}
+
+	bytes, _ := json.Marshal(partners)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+	return
+}
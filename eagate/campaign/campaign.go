@@ -0,0 +1,94 @@
+package campaign
+
+import (
+	"fmt"
+	"github.com/chris-sg/bst_api/eagate/util"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Campaign is a limited time eagate event that can be played on a
+// user's behalf. Users opt in to each campaign on their profile.
+type Campaign struct {
+	Id       string
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Strategy Strategy
+}
+
+// Active reports whether the campaign is running at now. Campaigns end
+// exclusively, so a campaign is inactive at its End time. One without
+// an End has no known dates and is always active, so it is still
+// played as it was before campaigns had windows.
+func (campaign Campaign) Active(now time.Time) bool {
+	return !now.Before(campaign.Start) && (campaign.End.IsZero() || now.Before(campaign.End))
+}
+
+// Strategy plays a campaign for a single client, returning every play
+// that was made. No plays are returned once the day's plays are used.
+type Strategy interface {
+	Play(client util.EaClient) (plays []Play, err bst_models.Error)
+}
+
+// Play is a single play of a campaign, with the choice made and the
+// result shown on the page returned by eagate.
+type Play struct {
+	Choice string
+	Result string
+}
+
+var (
+	campaigns   = make(map[string]Campaign)
+	campaignMtx sync.Mutex
+)
+
+// Register will add a campaign to the set that can be opted in to.
+// Ids must be unique.
+func Register(campaign Campaign) {
+	campaignMtx.Lock()
+	defer campaignMtx.Unlock()
+	if _, exists := campaigns[campaign.Id]; exists {
+		panic(fmt.Sprintf("campaign %s registered twice", campaign.Id))
+	}
+	campaigns[campaign.Id] = campaign
+}
+
+// Find will retrieve the campaign with the id, if one is registered.
+func Find(id string) (campaign Campaign, exists bool) {
+	campaignMtx.Lock()
+	defer campaignMtx.Unlock()
+	campaign, exists = campaigns[id]
+	return
+}
+
+// Campaigns will retrieve every registered campaign, ordered by start
+// date then id.
+func Campaigns() []Campaign {
+	campaignMtx.Lock()
+	defer campaignMtx.Unlock()
+	all := make([]Campaign, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		all = append(all, campaign)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].Start.Equal(all[j].Start) {
+			return all[i].Start.Before(all[j].Start)
+		}
+		return all[i].Id < all[j].Id
+	})
+	return all
+}
+
+// ActiveCampaigns will retrieve the registered campaigns running at now.
+func ActiveCampaigns(now time.Time) []Campaign {
+	active := make([]Campaign, 0)
+	for _, campaign := range Campaigns() {
+		if campaign.Active(now) {
+			active = append(active, campaign)
+		}
+	}
+	return active
+}
@@ -0,0 +1,127 @@
+package campaign
+
+import (
+	"github.com/chris-sg/bst_api/eagate/util"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUndatedCampaignsAreActive(t *testing.T) {
+	now := time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+	for _, id := range []string{"bjm2020", "wbr2020"} {
+		c, exists := Find(id)
+		if !exists {
+			t.Fatalf("campaign %s is not registered", id)
+		}
+		if !c.End.IsZero() {
+			t.Errorf("campaign %s should not have an end date", id)
+		}
+		if !c.Active(now) {
+			t.Errorf("campaign %s without dates should be active", id)
+		}
+	}
+	if len(ActiveCampaigns(now)) != 2 {
+		t.Errorf("expected both undated campaigns to be active")
+	}
+}
+
+func TestCampaignWindow(t *testing.T) {
+	start := time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+	c := Campaign{Id: "window", Start: start, End: start.AddDate(0, 0, 7)}
+	tests := []struct {
+		now    time.Time
+		active bool
+	}{
+		{start.Add(-time.Second), false},
+		{start, true},
+		{start.AddDate(0, 0, 7).Add(-time.Second), true},
+		{start.AddDate(0, 0, 7), false},
+	}
+	for _, test := range tests {
+		if c.Active(test.now) != test.active {
+			t.Errorf("expected active to be %t at %s", test.active, test.now)
+		}
+	}
+}
+
+func TestLinkPickerRecordsEachPlay(t *testing.T) {
+	remaining := 2
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/play" {
+			remaining--
+			rw.Write([]byte(`<p id="result"> You
+				win </p>`))
+			return
+		}
+		if remaining == 0 {
+			rw.Write([]byte(`<div id="choices"></div>`))
+			return
+		}
+		rw.Write([]byte(`<div id="choices"><a href="/play?c=0">rock</a><a href="/play?c=1">paper</a><a href="/play?c=2">scissors</a></div>`))
+	}))
+	defer s.Close()
+	base := util.EaBaseURI()
+	util.SetEaBaseURI(s.URL)
+	defer util.SetEaBaseURI(base)
+
+	strategy := LinkPicker{Resource: "/campaign", Selector: "div#choices a", Choices: 3, MaxPlays: 10, ResultSelector: "p#result"}
+	plays, err := strategy.Play(util.GenerateClient())
+	if !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("failed to play: %s", err.Message)
+	}
+	if len(plays) != 2 {
+		t.Fatalf("expected 2 plays but got %d", len(plays))
+	}
+	for _, play := range plays {
+		if play.Choice != "rock" && play.Choice != "paper" && play.Choice != "scissors" {
+			t.Errorf("unexpected choice %s", play.Choice)
+		}
+		if play.Result != "You win" {
+			t.Errorf("expected result \"You win\" but got \"%s\"", play.Result)
+		}
+	}
+}
+
+func TestTokenFormPostDefaultsToPageText(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/submit" {
+			r.ParseForm()
+			if r.Form.Get("t_id") != "token" || r.Form.Get("c_type") != "2" {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			rw.Write([]byte(`<html><head><script>var x = 1;</script></head><body><h1>Result</h1>
+				<p>You drew card ` + r.Form.Get("c_id") + `</p></body></html>`))
+			return
+		}
+		rw.Write([]byte(`<input id="id_initial_token" value="token">`))
+	}))
+	defer s.Close()
+	base := util.EaBaseURI()
+	util.SetEaBaseURI(s.URL)
+	defer util.SetEaBaseURI(base)
+
+	strategy := TokenFormPost{
+		PageResource:   "/page",
+		TokenSelector:  "input#id_initial_token",
+		SubmitResource: "/submit",
+		TokenField:     "t_id",
+		ChoiceField:    "c_id",
+		Choices:        3,
+		Fields:         map[string]string{"c_type": "2"},
+	}
+	plays, err := strategy.Play(util.GenerateClient())
+	if !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("failed to play: %s", err.Message)
+	}
+	if len(plays) != 1 {
+		t.Fatalf("expected 1 play but got %d", len(plays))
+	}
+	expected := "Result You drew card " + plays[0].Choice
+	if plays[0].Result != expected {
+		t.Errorf("expected result \"%s\" but got \"%s\"", expected, plays[0].Result)
+	}
+}
@@ -0,0 +1,33 @@
+package campaign
+
+// The campaigns below were played for every user before campaigns were
+// opt-in. Their dates were never recorded, so they have no Start or End
+// and are played for opted in users until real windows are known.
+// Their result pages were not captured either, so results are read
+// with the default selector.
+func init() {
+	Register(Campaign{
+		Id:   "bjm2020",
+		Name: "BEMANI じゃんけん大会 2020",
+		Strategy: LinkPicker{
+			Resource: "/game/bemani/bjm2020/janken/index.html",
+			Selector: "div#janken-select div.inner a",
+			Choices:  3,
+			MaxPlays: 10,
+		},
+	})
+
+	Register(Campaign{
+		Id:   "wbr2020",
+		Name: "WBR 2020",
+		Strategy: TokenFormPost{
+			PageResource:   "/game/bemani/wbr2020/01/card.html",
+			TokenSelector:  "input#id_initial_token",
+			SubmitResource: "/game/bemani/wbr2020/01/card_save.html",
+			TokenField:     "t_id",
+			ChoiceField:    "c_id",
+			Choices:        3,
+			Fields:         map[string]string{"c_type": "2"},
+		},
+	})
+}
@@ -0,0 +1,154 @@
+package campaign
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chris-sg/bst_api/eagate/util"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// LinkPicker plays by following one of the links matched by Selector at
+// random. The page is reloaded after each play, and play stops once it
+// no longer offers exactly Choices links or MaxPlays is reached. The
+// choice is recorded as the link text, or its position when it has no
+// text.
+type LinkPicker struct {
+	Resource       string
+	Selector       string
+	Choices        int
+	MaxPlays       int
+	ResultSelector string
+}
+
+func (strategy LinkPicker) Play(client util.EaClient) (plays []Play, err bst_models.Error) {
+	err = bst_models.ErrorOK
+	pageUri := util.BuildEaURI(strategy.Resource)
+
+	for len(plays) < strategy.MaxPlays {
+		document, _, e := util.GetPageContentAsGoQuery(client.Client, pageUri)
+		if !e.Equals(bst_models.ErrorOK) {
+			glog.Errorf("failed to get campaign page %s: %s", pageUri, e.Message)
+			err = e
+			return
+		}
+		selection := document.Find(strategy.Selector)
+		if selection.Length() != strategy.Choices {
+			return
+		}
+
+		index := rand.Intn(strategy.Choices)
+		link := selection.Eq(index)
+		attemptResource, exists := link.Attr("href")
+		if !exists {
+			glog.Warningf("failed to get href from campaign page %s", pageUri)
+			err = bst_models.ErrorGormSelector
+			return
+		}
+		play := Play{Choice: strings.TrimSpace(link.Text())}
+		if len(play.Choice) == 0 {
+			play.Choice = fmt.Sprintf("%d", index)
+		}
+
+		res, e2 := client.Client.Get(util.BuildEaURI(attemptResource))
+		if e2 != nil {
+			glog.Errorf("failed to play campaign %s: %s", attemptResource, e2.Error())
+			err = bst_models.ErrorClientRequest
+			return
+		}
+		play.Result = parseResult(res, strategy.ResultSelector)
+		plays = append(plays, play)
+	}
+	return
+}
+
+// TokenFormPost plays by scraping a one time token from PageResource and
+// posting it to SubmitResource along with Fields and a random choice
+// between 0 and Choices.
+type TokenFormPost struct {
+	PageResource   string
+	TokenSelector  string
+	SubmitResource string
+	TokenField     string
+	ChoiceField    string
+	Choices        int
+	Fields         map[string]string
+	ResultSelector string
+}
+
+func (strategy TokenFormPost) Play(client util.EaClient) (plays []Play, err bst_models.Error) {
+	err = bst_models.ErrorOK
+	pageUri := util.BuildEaURI(strategy.PageResource)
+
+	document, _, err := util.GetPageContentAsGoQuery(client.Client, pageUri)
+	if !err.Equals(bst_models.ErrorOK) {
+		glog.Errorf("failed to get campaign page %s: %s", pageUri, err.Message)
+		return
+	}
+	token, exists := document.Find(strategy.TokenSelector).First().Attr("value")
+	if !exists {
+		// no token is offered once today's play has been used
+		return
+	}
+
+	play := Play{Choice: fmt.Sprintf("%d", rand.Intn(strategy.Choices))}
+	form := url.Values{}
+	for field, value := range strategy.Fields {
+		form.Add(field, value)
+	}
+	form.Add(strategy.ChoiceField, play.Choice)
+	form.Add(strategy.TokenField, token)
+
+	res, e := client.Client.PostForm(util.BuildEaURI(strategy.SubmitResource), form)
+	if e != nil {
+		glog.Errorf("failed to play campaign %s: %s", strategy.SubmitResource, e.Error())
+		err = bst_models.ErrorClientRequest
+		return
+	}
+	play.Result = parseResult(res, strategy.ResultSelector)
+	plays = append(plays, play)
+	return
+}
+
+// defaultResultSelector is used when a strategy has no ResultSelector,
+// recording the visible text of the page returned by a play.
+const defaultResultSelector = "body"
+
+// maxResultLength limits how many characters of a result are recorded.
+const maxResultLength = 200
+
+// parseResult will read the text of resultSelector from the page
+// returned by a play, closing the response. A missing result is
+// recorded as empty rather than failing a play that has already been
+// made.
+func parseResult(res *http.Response, resultSelector string) string {
+	defer res.Body.Close()
+	if len(resultSelector) == 0 {
+		resultSelector = defaultResultSelector
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		glog.Warningf("failed to read campaign result: %s", err.Error())
+		return ""
+	}
+	if strings.Contains(res.Header.Get("Content-Type"), "Windows-31J") {
+		body = util.ShiftJISBytesToUTF8Bytes(body)
+	}
+	document, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		glog.Warningf("failed to parse campaign result: %s", err.Error())
+		return ""
+	}
+	document.Find("script, style").Remove()
+	result := []rune(strings.Join(strings.Fields(document.Find(resultSelector).First().Text()), " "))
+	if len(result) > maxResultLength {
+		result = result[:maxResultLength]
+	}
+	return string(result)
+}
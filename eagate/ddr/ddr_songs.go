@@ -24,6 +24,10 @@ func SongIdsForClient(client util.EaClient) (songIds []string, err bst_models.Er
 	if !err.Equals(bst_models.ErrorOK) {
 		return
 	}
+	if !validateMusicDataDocument(musicDataDoc) {
+		err = bst_models.ErrorGormSelector
+		return
+	}
 	pageCount := pageCountFromMusicDataDocument(musicDataDoc)
 
 	errCount := 0
@@ -41,6 +45,10 @@ func SongIdsForClient(client util.EaClient) (songIds []string, err bst_models.Er
 				glog.Errorf("failed to load musicDataSingleDocument for user %s page %d: %s\n", client.GetUserModel().Name, page, err.Message)
 				return
 			}
+			if !validateMusicDataDocument(musicDataDoc) {
+				errCount++
+				return
+			}
 
 			pageSongIds := songIdsFromMusicDataDocument(musicDataDoc)
 
@@ -96,6 +104,10 @@ func SongDataForClient(client util.EaClient, songIds []string) (songs []ddr_mode
 				errCount++
 				return
 			}
+			if !validateSongDataDocument(document) {
+				errCount++
+				return
+			}
 			song := songDataFromDocument(document, songId)
 
 			mtx.Lock()
@@ -122,6 +134,9 @@ func songDataFromDocument(document *goquery.Document, songId string) (song ddr_m
 		if img.Length() == 0 {
 			html, _ := s.Html()
 			songDataPair := strings.Split(html, "<br/>")
+			if len(song.Name) > 0 || len(songDataPair) < 2 {
+				return
+			}
 			song.Name = songDataPair[0]
 			song.Artist = songDataPair[1]
 		} else {
@@ -160,6 +175,10 @@ func SongDifficultiesForClient(client util.EaClient, songIds []string) (difficul
 				errCount++
 				return
 			}
+			if !validateSongDifficultiesDocument(document) {
+				errCount++
+				return
+			}
 			songDifficulties := songDifficultiesFromDocument(document, songId)
 
 			mtx.Lock()
@@ -21,6 +21,10 @@ func PlayerInformationForClient(client util.EaClient) (playerDetails ddr_models.
 		glog.Errorf("failed to get playerInformationDocument for %s", client.GetUserModel().Name)
 		return
 	}
+	if !validatePlayerDocument(document) {
+		err = bst_models.ErrorGormSelector
+		return
+	}
 
 	playerDetails, err = playerInformationFromPlayerDocument(document)
 	if !err.Equals(bst_models.ErrorOK) {
@@ -179,6 +183,10 @@ func SongStatisticsForClient(client util.EaClient, charts []ddr_models.SongDiffi
 				errCount++
 				return
 			}
+			if !validateChartStatisticsDocument(document) {
+				errCount++
+				return
+			}
 			statistics, err := chartStatisticsFromDocument(document, playerCode, diff)
 			if !err.Equals(bst_models.ErrorOK) {
 				glog.Errorf("failed to load statistics for client %s: songid %s\n", client.GetUserModel().Name, diff.SongId)
@@ -282,6 +290,10 @@ func RecentScoresForClient(client util.EaClient, playerCode int) (scores []ddr_m
 	if !err.Equals(bst_models.ErrorOK) {
 		return
 	}
+	if !validateRecentScoresDocument(document) {
+		err = bst_models.ErrorGormSelector
+		return
+	}
 	scores, err = recentScoresFromDocument(document, playerCode)
 	return
 }
@@ -355,6 +367,10 @@ func WorkoutDataForClient(client util.EaClient, playerCode int) (workoutData []d
 	if !err.Equals(bst_models.ErrorOK) {
 		return
 	}
+	if !validateWorkoutDocument(document) {
+		err = bst_models.ErrorGormSelector
+		return
+	}
 	workoutData, err = workoutDataFromDocument(document, playerCode)
 	return
 }
@@ -394,7 +410,8 @@ func workoutDataFromDocument(document *goquery.Document, playerCode int) (workou
 					}
 				} else if i == 2 {
 					numerical, e := regexp.Compile("[^0-9]+")
-					if e == nil {
+					if e != nil {
+						glog.Errorf("regex failure! %s\n", e.Error())
 						panic(e)
 					}
 					numericStr := numerical.ReplaceAllString(dataSelection.Text(), "")
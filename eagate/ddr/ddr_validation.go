@@ -0,0 +1,67 @@
+package ddr
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chris-sg/bst_api/eagate/util"
+	"strings"
+)
+
+// Parser names reported in the parser health section of /status.
+const (
+	parserPlayerInformation = "ddr_player_information"
+	parserMusicData         = "ddr_music_data"
+	parserSongData          = "ddr_song_data"
+	parserSongDifficulties  = "ddr_song_difficulties"
+	parserChartStatistics   = "ddr_chart_statistics"
+	parserRecentScores      = "ddr_recent_scores"
+	parserWorkout           = "ddr_workout"
+)
+
+func validatePlayerDocument(document *goquery.Document) bool {
+	problems := util.MissingSelectors(document, "table#status", "div#single table.small_table", "div#double table.small_table")
+	problems = append(problems, util.MissingTableHeaders(document.Find("table#status"),
+		"ダンサーネーム", "DDR-CODE", "総プレー回数", "最終プレー日時")...)
+	problems = append(problems, util.MissingTableHeaders(document.Find("div#single table.small_table"),
+		"プレー回数", "最終プレー日時")...)
+	problems = append(problems, util.MissingTableHeaders(document.Find("div#double table.small_table"),
+		"プレー回数", "最終プレー日時")...)
+	return util.RecordParserCheck(parserPlayerInformation, problems)
+}
+
+func validateMusicDataDocument(document *goquery.Document) bool {
+	return util.RecordParserCheck(parserMusicData,
+		util.MissingSelectors(document, "div#paging_box div.page_num", "tr.data a"))
+}
+
+func validateSongDataDocument(document *goquery.Document) bool {
+	return util.RecordParserCheck(parserSongData,
+		util.MissingSelectors(document, "table#music_info td", "table#music_info img"))
+}
+
+func validateSongDifficultiesDocument(document *goquery.Document) bool {
+	return util.RecordParserCheck(parserSongDifficulties,
+		util.MissingSelectors(document, "div#single li.step img", "div#double li.step img"))
+}
+
+// validateChartStatisticsDocument will skip pages for charts that were
+// never played, as those have no statistics table.
+func validateChartStatisticsDocument(document *goquery.Document) bool {
+	popup := document.Find("div#popup_cnt").Text()
+	if strings.Contains(popup, "NO PLAY") || strings.Contains(popup, "難易度を選択してください。") {
+		return true
+	}
+	problems := util.MissingSelectors(document, "table#music_detail_table")
+	problems = append(problems, util.MissingTableHeaders(document.Find("table#music_detail_table"),
+		"最大コンボ数", "クリア回数", "プレー回数", "ハイスコア", "ハイスコア時のダンスレベル", "フルコンボ種別", "最終プレー時間")...)
+	return util.RecordParserCheck(parserChartStatistics, problems)
+}
+
+func validateRecentScoresDocument(document *goquery.Document) bool {
+	return util.RecordParserCheck(parserRecentScores,
+		util.MissingSelectors(document, "table#data_tbl"))
+}
+
+func validateWorkoutDocument(document *goquery.Document) bool {
+	return util.RecordParserCheck(parserWorkout,
+		util.MissingSelectors(document, "table#work_out_left tbody"))
+}
@@ -52,6 +52,11 @@ func LoadDancerInfo(client util.EaClient) (dancerInfo drs_models.DancerInfo, err
 		}
 	}
 
+	if !validateDancerInfo(body) {
+		err = bst_models.ErrorDrsPlayerInfo
+		return
+	}
+
 	e = json.Unmarshal(body, &dancerInfo)
 	if e != nil {
 		glog.Errorf("failed to decode json: %s", e.Error())
@@ -100,6 +105,11 @@ func LoadMusicData(client util.EaClient) (musicData drs_models.MusicData, err bs
 		}
 	}
 
+	if !validateMusicData(body) {
+		err = bst_models.ErrorDrsSongData
+		return
+	}
+
 	e = json.Unmarshal(body, &musicData)
 	if e != nil {
 		glog.Errorf("failed to decode json: %s", e.Error())
@@ -148,6 +158,11 @@ func LoadPlayHist(client util.EaClient) (playHist drs_models.PlayHist, err bst_m
 		}
 	}
 
+	if !validatePlayHist(body) {
+		err = bst_models.ErrorDrsSongData
+		return
+	}
+
 	e = json.Unmarshal(body, &playHist)
 	if e != nil {
 		glog.Errorf("failed to decode json: %s", e.Error())
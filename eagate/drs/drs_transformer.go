@@ -7,27 +7,116 @@ import (
 	"time"
 )
 
-func Transform(dancerInfo drs_models.DancerInfo, musicData drs_models.MusicData, playHist drs_models.PlayHist) (pd drs_models.PlayerDetails, pps drs_models.PlayerProfileSnapshot, s []drs_models.Song, d []drs_models.Difficulty, pss []drs_models.PlayerSongStats, ps []drs_models.PlayerScore) {
+// TransformReport lists what Transform could not use. Sections are
+// named by their eagate json keys.
+type TransformReport struct {
+	EmptySections     []string        `json:"emptysections"`
+	UnknownChartTypes []string        `json:"unknowncharttypes"`
+	Skipped           []SkippedRecord `json:"skipped"`
+}
+
+// SkippedRecord is a single record left out of the transform.
+type SkippedRecord struct {
+	Section string `json:"section"`
+	Id      string `json:"id"`
+	Reason  string `json:"reason"`
+}
+
+// Empty will check whether nothing was reported.
+func (report TransformReport) Empty() bool {
+	return len(report.EmptySections) == 0 && len(report.UnknownChartTypes) == 0 && len(report.Skipped) == 0
+}
+
+func (report *TransformReport) skip(section string, id string, reason string) {
+	report.Skipped = append(report.Skipped, SkippedRecord{section, id, reason})
+}
+
+// unknownChartType will note a chart type that could not be decoded,
+// listing each type once.
+func (report *TransformReport) unknownChartType(chartType string) {
+	for _, known := range report.UnknownChartTypes {
+		if known == chartType {
+			return
+		}
+	}
+	report.UnknownChartTypes = append(report.UnknownChartTypes, chartType)
+}
+
+// decodeChartType will split a chart type such as "1a" into its mode
+// (1 for single, 2 for double) and difficulty (a for normal, b for
+// easy).
+func decodeChartType(chartType string) (mode string, difficulty string, ok bool) {
+	if len(chartType) != 2 {
+		return
+	}
+	switch chartType[0] {
+	case '1':
+		mode = "Single"
+	case '2':
+		mode = "Double"
+	default:
+		return
+	}
+	switch chartType[1] {
+	case 'a':
+		difficulty = "Normal"
+	case 'b':
+		difficulty = "Easy"
+	default:
+		return
+	}
+	ok = true
+	return
+}
+
+// Transform will convert the eagate responses to models. Records that
+// cannot be converted are left out and listed in the report rather than
+// failing the whole transform.
+func Transform(dancerInfo drs_models.DancerInfo, musicData drs_models.MusicData, playHist drs_models.PlayHist) (pd drs_models.PlayerDetails, pps drs_models.PlayerProfileSnapshot, s []drs_models.Song, d []drs_models.Difficulty, pss []drs_models.PlayerSongStats, ps []drs_models.PlayerScore, report TransformReport) {
+	report = TransformReport{
+		EmptySections:     make([]string, 0),
+		UnknownChartTypes: make([]string, 0),
+		Skipped:           make([]SkippedRecord, 0),
+	}
+	code := musicData.Data.PlayerData.UserId.Code
+	if len(musicData.Data.PlayerData.MusicDb) == 0 {
+		report.EmptySections = append(report.EmptySections, "mdb")
+	}
+	if len(musicData.Data.PlayerData.ScoreData.Music) == 0 {
+		report.EmptySections = append(report.EmptySections, "scoredata")
+	}
+	if len(playHist.Data.PlayerData.MusicHistory.Music) == 0 {
+		report.EmptySections = append(report.EmptySections, "music_hist")
+	}
+
 	pd = drs_models.PlayerDetails{
-		Code:       musicData.Data.PlayerData.UserId.Code,
+		Code:       code,
 		Name:       dancerInfo.Data.EaSite.Profile.Name,
 		EaGateUser: nil,
 	}
-	
+
 	pps = drs_models.PlayerProfileSnapshot{
 		PlayCount:   dancerInfo.Data.EaSite.Statistics.PlayCount,
 		PlaySeconds: dancerInfo.Data.EaSite.Statistics.PlaySecs,
 		TotalStars:  dancerInfo.Data.EaSite.Coins.Total,
 		UsedStars:   dancerInfo.Data.EaSite.Coins.Used,
-		LastPlayed:  time.Unix(0, playHist.Data.PlayerData.MusicHistory.Music[0].LastPlayDate*1000000),
-		PlayerCode:  musicData.Data.PlayerData.UserId.Code,
+		StarLimit:   dancerInfo.Data.EaSite.Coins.Limit,
+		VoteRights1: dancerInfo.Data.EaSite.Camp.VoteRights1,
+		VoteRights2: dancerInfo.Data.EaSite.Camp.VoteRights2,
+		PlayerCode:  code,
 	}
-	
+
 	for songId, songDetails := range musicData.Data.PlayerData.MusicDb {
+		if len(songId) == 0 {
+			report.skip("mdb", songId, "missing music id")
+			continue
+		}
 		song := drs_models.Song{
 			SongId:         songId,
 			SongName:       songDetails.Info.TitleName,
+			SongYomigana:   songDetails.Info.TitleYomigana,
 			ArtistName:     songDetails.Info.ArtistName,
+			ArtistYomigana: songDetails.Info.ArtistYomigana,
 			MaxBpm:         songDetails.Info.BpmMax,
 			MinBpm:         songDetails.Info.BpmMin,
 			LimitationType: songDetails.Info.LimitationType,
@@ -37,22 +126,16 @@ func Transform(dancerInfo drs_models.DancerInfo, musicData drs_models.MusicData,
 		}
 		s = append(s, song)
 		for diffType, rawDiff := range songDetails.Difficulties {
-			if !strings.HasPrefix(diffType, "fumen_") {
-				glog.Warningf("diff field for %s does not have prefix, instead %s\n", songId, diffType)
+			mode, difficulty, ok := decodeChartType(strings.TrimPrefix(diffType, "fumen_"))
+			if !strings.HasPrefix(diffType, "fumen_") || !ok {
+				glog.Warningf("unknown difficulty %s for %s\n", diffType, songId)
+				report.unknownChartType(diffType)
+				report.skip("mdb", songId, "unknown difficulty "+diffType)
 				continue
 			}
-			diffType = diffType[len("fumen_"):]
-			mode := "Double"
-			if strings.HasPrefix(diffType, "1") {
-				mode = "Single"
-			}
-			difficulty := "Easy"
-			if strings.HasSuffix(diffType, "a") {
-				difficulty = "Normal"
-			}
 
 			diff := drs_models.Difficulty{
-				Mode:        mode,
+				Mode:       mode,
 				Difficulty: difficulty,
 				Level:      rawDiff.DiffNum,
 				SongId:     songId,
@@ -62,19 +145,22 @@ func Transform(dancerInfo drs_models.DancerInfo, musicData drs_models.MusicData,
 	}
 
 	for _, chart := range musicData.Data.PlayerData.ScoreData.Music {
-		mode := "Double"
-		if strings.HasPrefix(chart.MusicType, "1") {
-			mode = "Single"
+		mode, difficulty, ok := decodeChartType(chart.MusicType)
+		if !ok {
+			report.unknownChartType(chart.MusicType)
+			report.skip("scoredata", chart.MusicId, "unknown chart type "+chart.MusicType)
+			continue
 		}
-		difficulty := "Easy"
-		if strings.HasSuffix(chart.MusicType, "a") {
-			difficulty = "Normal"
+		if len(chart.MusicId) == 0 {
+			report.skip("scoredata", chart.MusicId, "missing music id")
+			continue
 		}
-		
+
 		stat := drs_models.PlayerSongStats{
 			BestScore:         chart.Score,
 			Combo:             chart.Combo,
 			PlayCount:         chart.PlayCount,
+			Rank:              chart.Rank,
 			Param:             chart.Param,
 			BestScoreDateTime: time.Unix(0, chart.BestScoreDate*1000000),
 			LastPlayDateTime:  time.Unix(0, chart.LastPlayDate*1000000),
@@ -90,12 +176,12 @@ func Transform(dancerInfo drs_models.DancerInfo, musicData drs_models.MusicData,
 			P2Greats:          nil,
 			P2Goods:           nil,
 			P2Bads:            nil,
-			PlayerCode:        musicData.Data.PlayerData.UserId.Code,
+			PlayerCode:        code,
 			SongId:            chart.MusicId,
 			Mode:              mode,
 			Difficulty:        difficulty,
 		}
-		
+
 		if chart.Player2 != nil {
 			stat.P2Code = &chart.Player2.Code
 			stat.P2Score = &chart.Player2.Score
@@ -104,24 +190,31 @@ func Transform(dancerInfo drs_models.DancerInfo, musicData drs_models.MusicData,
 			stat.P2Goods = &chart.Player2.Good
 			stat.P2Bads = &chart.Player2.Bad
 		}
-		
+
 		pss = append(pss, stat)
 	}
-	
+
 	for _, score := range playHist.Data.PlayerData.MusicHistory.Music {
-		mode := "Double"
-		if strings.HasPrefix(score.MusicType, "1") {
-			mode = "Single"
+		mode, difficulty, ok := decodeChartType(score.MusicType)
+		if !ok {
+			report.unknownChartType(score.MusicType)
+			report.skip("music_hist", score.MusicId, "unknown chart type "+score.MusicType)
+			continue
 		}
-		difficulty := "Easy"
-		if strings.HasSuffix(score.MusicType, "a") {
-			difficulty = "Normal"
+		if len(score.MusicId) == 0 {
+			report.skip("music_hist", score.MusicId, "missing music id")
+			continue
+		}
+		if score.LastPlayDate <= 0 {
+			report.skip("music_hist", score.MusicId, "missing play date")
+			continue
 		}
 
 		recentScore := drs_models.PlayerScore{
 			Shop:       score.ShopName,
 			Score:      score.Score,
 			MaxCombo:   score.Combo,
+			Rank:       score.Rank,
 			Param:      score.Param,
 			PlayTime:   time.Unix(0, score.LastPlayDate*1000000),
 			P1Code:     score.Player1.PlayerCode,
@@ -137,7 +230,7 @@ func Transform(dancerInfo drs_models.DancerInfo, musicData drs_models.MusicData,
 			P2Goods:    nil,
 			P2Bads:     nil,
 			VideoUrl:   nil,
-			PlayerCode: musicData.Data.PlayerData.UserId.Code,
+			PlayerCode: code,
 			SongId:     score.MusicId,
 			Mode:       mode,
 			Difficulty: difficulty,
@@ -153,11 +246,45 @@ func Transform(dancerInfo drs_models.DancerInfo, musicData drs_models.MusicData,
 		}
 
 		if len(score.VideoUrl) > 0 {
-			recentScore.VideoUrl = &score.VideoUrl
+			// score is reused by the loop, so the url must be copied
+			videoUrl := score.VideoUrl
+			recentScore.VideoUrl = &videoUrl
 		}
 
 		ps = append(ps, recentScore)
 	}
 
+	// the snapshot is as of the latest play, which comes from the best
+	// scores when there is no recent history
+	for _, score := range ps {
+		if score.PlayTime.After(pps.LastPlayed) {
+			pps.LastPlayed = score.PlayTime
+		}
+	}
+	if len(ps) == 0 {
+		for _, stat := range pss {
+			if stat.LastPlayDateTime.After(pps.LastPlayed) {
+				pps.LastPlayed = stat.LastPlayDateTime
+			}
+		}
+	}
+
+	return
+}
+
+// TransformUnlocks will list the songs the player has unlocked, marking
+// each as unlocked at the given time. A nil time marks the unlock time
+// as unknown.
+func TransformUnlocks(musicData drs_models.MusicData, unlockedAt *time.Time) (unlocks []drs_models.PlayerUnlock) {
+	for _, songId := range musicData.Data.PlayerData.UnlockedMusic.MusicIds {
+		if len(songId) == 0 {
+			continue
+		}
+		unlocks = append(unlocks, drs_models.PlayerUnlock{
+			UnlockedAt: unlockedAt,
+			PlayerCode: musicData.Data.PlayerData.UserId.Code,
+			SongId:     songId,
+		})
+	}
 	return
 }
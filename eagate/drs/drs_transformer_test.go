@@ -0,0 +1,68 @@
+package drs
+
+import (
+	"encoding/json"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"io/ioutil"
+	"testing"
+)
+
+func loadTestData(t *testing.T, file string, v interface{}) {
+	body, err := ioutil.ReadFile("test_data/" + file)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", file, err.Error())
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		t.Fatalf("failed to decode %s: %s", file, err.Error())
+	}
+}
+
+func TestTransformReportsUnusableData(t *testing.T) {
+	var dancerInfo drs_models.DancerInfo
+	var musicData drs_models.MusicData
+	loadTestData(t, "dancer_info.json", &dancerInfo)
+	loadTestData(t, "music_data.json", &musicData)
+	musicData.Data.PlayerData.ScoreData.Music[0].MusicType = "3c"
+
+	_, snapshot, _, _, stats, scores, report := Transform(dancerInfo, musicData, drs_models.PlayHist{})
+	if len(scores) != 0 || len(stats) != 1 {
+		t.Errorf("expected 1 stat and no scores, got %d and %d", len(stats), len(scores))
+	}
+	if snapshot.LastPlayed.IsZero() {
+		t.Errorf("snapshot should fall back to the last play of the best scores")
+	}
+	if len(report.EmptySections) != 1 || report.EmptySections[0] != "music_hist" {
+		t.Errorf("expected music_hist to be reported empty, got %v", report.EmptySections)
+	}
+	if len(report.UnknownChartTypes) != 1 || report.UnknownChartTypes[0] != "3c" {
+		t.Errorf("expected chart type 3c to be reported, got %v", report.UnknownChartTypes)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Section != "scoredata" {
+		t.Errorf("expected one skipped best score, got %v", report.Skipped)
+	}
+}
+
+func TestTransformKeepsEachVideoUrl(t *testing.T) {
+	var dancerInfo drs_models.DancerInfo
+	var musicData drs_models.MusicData
+	var playHist drs_models.PlayHist
+	loadTestData(t, "dancer_info.json", &dancerInfo)
+	loadTestData(t, "music_data.json", &musicData)
+	loadTestData(t, "play_hist.json", &playHist)
+	plays := playHist.Data.PlayerData.MusicHistory.Music
+	if len(plays) < 2 {
+		t.Fatalf("expected at least 2 plays in the test data, got %d", len(plays))
+	}
+	plays[0].VideoUrl = "https://example.com/first.mp4"
+	plays[1].VideoUrl = "https://example.com/second.mp4"
+
+	_, _, _, _, _, scores, _ := Transform(dancerInfo, musicData, playHist)
+	if len(scores) < 2 {
+		t.Fatalf("expected at least 2 scores, got %d", len(scores))
+	}
+	for i, expected := range []string{plays[0].VideoUrl, plays[1].VideoUrl} {
+		if scores[i].VideoUrl == nil || *scores[i].VideoUrl != expected {
+			t.Errorf("expected play %d to have video %s, got %v", i, expected, scores[i].VideoUrl)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package drs
+
+import (
+	"github.com/chris-sg/bst_api/eagate/util"
+)
+
+// Parser names reported in the parser health section of /status.
+const (
+	parserDancerInfo = "drs_dancer_info"
+	parserMusicData  = "drs_music_data"
+	parserPlayHist   = "drs_play_hist"
+)
+
+func validateDancerInfo(body []byte) bool {
+	return util.RecordParserCheck(parserDancerInfo, util.MissingJsonFields(body,
+		"data.easite_get_playerdata.profile.name",
+		"data.easite_get_playerdata.statics_play.play_cnt",
+		"data.easite_get_playerdata.statics_play.play_sec",
+		"data.easite_get_playerdata.normal_dance_coin.total",
+		"data.easite_get_playerdata.normal_dance_coin.used"))
+}
+
+func validateMusicData(body []byte) bool {
+	return util.RecordParserCheck(parserMusicData, util.MissingJsonFields(body,
+		"data.easite_get_playerdata.userid.code",
+		"data.easite_get_playerdata.scoredata.music",
+		"data.easite_get_playerdata.mdb"))
+}
+
+// validatePlayHist only requires music_hist, as a player with no recent
+// plays has no music in it.
+func validatePlayHist(body []byte) bool {
+	return util.RecordParserCheck(parserPlayHist, util.MissingJsonFields(body,
+		"data.easite_get_playerdata.userid.code",
+		"data.easite_get_playerdata.music_hist"))
+}
@@ -0,0 +1,424 @@
+package fake_eagate
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionCookieName is the cookie eagate uses to track a login.
+const SessionCookieName = "M573SSID"
+
+const maintenancePage = `<html><body><div id="maintenance">ただいまメンテナンス期間中です。</div></body></html>`
+
+// characters are the captcha characters. Each has several image
+// variants so the correct choices never share a checksum with the prompt.
+var characters = []string{"bomberman", "goemon", "twinbee", "shiori", "louie"}
+
+const captchaVariants = 3
+
+// Server is a stateful stand-in for p.eagate.573.jp. It serves the
+// page fixtures in eagate/ddr/test_data and the json fixtures in
+// eagate/drs/test_data, runs the kcaptcha/login_auth flow, and issues
+// session cookies for users added with AddUser.
+type Server struct {
+	URL string
+	// FixtureDir is the eagate directory holding ddr/test_data and
+	// drs/test_data. It defaults to the source tree the server was
+	// built from, so it must be set when run elsewhere.
+	FixtureDir string
+
+	mtx         sync.Mutex
+	httpServer  *httptest.Server
+	users       map[string]fakeUser
+	sessions    map[string]string
+	captchas    map[string]string
+	images      map[string][]byte
+	overrides   map[string][]byte
+	maintenance bool
+}
+
+type fakeUser struct {
+	password string
+	otp      string
+}
+
+// NewServer will start a fake eagate server on a local port. Point the
+// eagate clients at it with util.SetEaBaseURI(server.URL), and register
+// CaptchaChecksums so the captcha can be solved.
+func NewServer() *Server {
+	server := &Server{
+		users:     make(map[string]fakeUser),
+		sessions:  make(map[string]string),
+		captchas:  make(map[string]string),
+		images:    make(map[string][]byte),
+		overrides: make(map[string][]byte),
+
+		FixtureDir: sourceFixtureDir(),
+	}
+	server.httpServer = httptest.NewServer(server)
+	server.URL = server.httpServer.URL
+	glog.Infof("fake eagate listening on %s\n", server.URL)
+	return server
+}
+
+func (server *Server) Close() {
+	server.httpServer.Close()
+}
+
+// AddUser will allow the login id to log in with the password. If otp
+// is not empty it must also be provided.
+func (server *Server) AddUser(loginId string, password string, otp string) {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	server.users[loginId] = fakeUser{password, otp}
+}
+
+// SetMaintenance will switch every /game/ page to the maintenance page
+// and refuse logins until it is switched off again.
+func (server *Server) SetMaintenance(maintenance bool) {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	server.maintenance = maintenance
+}
+
+// OverridePage will serve contents in place of the fixture for the path,
+// such as to simulate a markup change. A nil contents removes it.
+func (server *Server) OverridePage(path string, contents []byte) {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	if contents == nil {
+		delete(server.overrides, path)
+		return
+	}
+	server.overrides[path] = contents
+}
+
+// OverridePlayerData will serve contents in place of the DANCERUSH json
+// fixture for kind, such as "play_hist". A nil contents removes it.
+func (server *Server) OverridePlayerData(kind string, contents []byte) {
+	server.OverridePage(playerDataOverride(kind), contents)
+}
+
+// ExpireSessions will log out every user, as if their cookies expired.
+func (server *Server) ExpireSessions() {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	server.sessions = make(map[string]string)
+}
+
+// CaptchaChecksums returns the md5 checksum of every captcha image the
+// server can serve, mapped to its character name.
+func CaptchaChecksums() map[string]string {
+	checksums := make(map[string]string)
+	for _, character := range characters {
+		for variant := 0; variant < captchaVariants; variant++ {
+			checksums[fmt.Sprintf("%x", md5.Sum(captchaImage(character, variant)))] = character
+		}
+	}
+	return checksums
+}
+
+func captchaImage(character string, variant int) []byte {
+	return []byte(fmt.Sprintf("fake_eagate captcha %s %d", character, variant))
+}
+
+func (server *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	glog.Infof("fake eagate %s %s\n", r.Method, r.URL.String())
+	path := r.URL.Path
+
+	switch {
+	case path == "/gate/p/common/login/api/kcaptcha_generate.html":
+		server.kcaptchaGenerate(rw, r)
+		return
+	case path == "/gate/p/common/login/api/login_auth.html":
+		server.loginAuth(rw, r)
+		return
+	case strings.HasPrefix(path, "/captcha/pic/"):
+		server.captchaPic(rw, r)
+		return
+	case path == "/gate/p/login.html":
+		writeHtml(rw, []byte(`<html><body><form id="login"></form></body></html>`))
+		return
+	}
+
+	if strings.HasPrefix(path, "/game/") && server.inMaintenance() {
+		writeHtml(rw, []byte(maintenancePage))
+		return
+	}
+	if path == "/game/" {
+		writeHtml(rw, []byte(`<html><body><div id="game">e-amusement</div></body></html>`))
+		return
+	}
+
+	if !server.loggedIn(r) {
+		http.Redirect(rw, r, "/gate/p/login.html?path="+path, http.StatusFound)
+		return
+	}
+
+	if contents, ok := server.override(path); ok {
+		writeHtml(rw, contents)
+		return
+	}
+
+	switch path {
+	case "/gate/p/mypage/index.html":
+		writeHtml(rw, []byte(`<html><body><div id="mypage">マイページ</div></body></html>`))
+	case "/payment/mybook/paybook.html":
+		writeHtml(rw, []byte(`<html><body><div id="id_paybook_all"><p class="cl_course_name">e-amusement ベーシックコース</p></div></body></html>`))
+	case "/game/ddr/ddra20/p/playdata/music_data_single.html":
+		serveFixture(rw, server.ddrFixture("music_data_single", "music_data_single_"+r.URL.Query().Get("offset")+".html"))
+	case "/game/ddr/ddra20/p/playdata/music_detail.html":
+		serveFixture(rw, server.ddrFixture("music_detail", r.URL.Query().Get("index")+".html"))
+	case "/game/ddr/ddra20/p/playdata/index.html":
+		serveFixture(rw, server.ddrFixture("player", "index.html"))
+	case "/game/ddr/ddra20/p/playdata/music_recent.html":
+		serveFixture(rw, server.ddrFixture("player", "recent_scores.html"))
+	case "/game/ddr/ddra20/p/playdata/workout.html":
+		serveFixture(rw, server.ddrFixture("player", "workout.html"))
+	case "/game/dan/1st/json/pdata_getdata.html":
+		server.pdataGetData(rw, r)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+func (server *Server) kcaptchaGenerate(rw http.ResponseWriter, r *http.Request) {
+	type choice struct {
+		Attr   string `json:"attr"`
+		ImgURL string `json:"img_url"`
+		Key    string `json:"key"`
+	}
+	type captchaData struct {
+		CorrectPic string   `json:"correct_pic"`
+		Kcsess     string   `json:"kcsess"`
+		ChoiceList []choice `json:"choicelist"`
+	}
+
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+
+	correct := characters[randomInt(len(characters))]
+	correctKey := randomHex(16)
+	server.images[correctKey] = captchaImage(correct, 0)
+
+	data := captchaData{
+		CorrectPic: server.URL + "/captcha/pic/" + correctKey,
+		Kcsess:     randomDigits(32),
+	}
+
+	// Two choices are the correct character, the rest are the others.
+	choices := []string{correct, correct}
+	for _, character := range characters {
+		if character != correct && len(choices) < 5 {
+			choices = append(choices, character)
+		}
+	}
+	for i := range choices {
+		j := randomInt(i + 1)
+		choices[i], choices[j] = choices[j], choices[i]
+	}
+
+	answer := ""
+	variant := 1
+	for i, character := range choices {
+		key := randomHex(16)
+		if character == correct {
+			server.images[key] = captchaImage(character, variant)
+			variant++
+			answer += "_" + key
+		} else {
+			server.images[key] = captchaImage(character, 1+randomInt(captchaVariants-1))
+			answer += "_"
+		}
+		data.ChoiceList = append(data.ChoiceList, choice{
+			Attr:   fmt.Sprintf("c%d", i),
+			ImgURL: server.URL + "/captcha/pic/" + key,
+			Key:    key,
+		})
+	}
+	server.captchas[data.Kcsess] = "k_" + data.Kcsess + answer
+
+	writeJson(rw, map[string]interface{}{"data": data})
+}
+
+func (server *Server) captchaPic(rw http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/captcha/pic/")
+	server.mtx.Lock()
+	image, ok := server.images[key]
+	server.mtx.Unlock()
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "image/png")
+	rw.Write(image)
+}
+
+func (server *Server) loginAuth(rw http.ResponseWriter, r *http.Request) {
+	type loginResponse struct {
+		FailCode int    `json:"fail_code"`
+		Href     string `json:"href"`
+	}
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		http.Error(rw, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+
+	if server.maintenance {
+		writeJson(rw, loginResponse{FailCode: 500})
+		return
+	}
+
+	captcha := r.PostForm.Get("captcha")
+	solved := false
+	if strings.HasPrefix(captcha, "k_") && len(captcha) >= 34 {
+		kcsess := captcha[2:34]
+		solved = server.captchas[kcsess] == captcha
+		delete(server.captchas, kcsess)
+	}
+	if !solved {
+		writeJson(rw, loginResponse{FailCode: 200})
+		return
+	}
+
+	loginId := r.PostForm.Get("login_id")
+	user, ok := server.users[loginId]
+	if !ok || user.password != r.PostForm.Get("pass_word") || user.otp != r.PostForm.Get("otp") {
+		writeJson(rw, loginResponse{FailCode: 100})
+		return
+	}
+
+	session := randomHex(16)
+	server.sessions[session] = loginId
+	http.SetCookie(rw, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    session,
+		Path:     "/",
+		Expires:  time.Now().Add(30 * 24 * time.Hour),
+		HttpOnly: true,
+	})
+	writeJson(rw, loginResponse{Href: "/gate/p/mypage/index.html"})
+}
+
+func (server *Server) pdataGetData(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		http.Error(rw, "bad request", http.StatusBadRequest)
+		return
+	}
+	kind := r.PostForm.Get("pdata_kind")
+	if contents, ok := server.override(playerDataOverride(kind)); ok {
+		rw.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		rw.Write(contents)
+		return
+	}
+	switch kind {
+	case "dancer_info", "music_data", "play_hist":
+		file := filepath.Join(server.FixtureDir, "drs", "test_data", kind+".json")
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			glog.Errorf("fake eagate failed to read %s: %s\n", file, err.Error())
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		rw.Write(contents)
+	default:
+		writeJson(rw, map[string]int{"status": 1})
+	}
+}
+
+// playerDataOverride is the key overrides of a kind of player data are
+// kept under, which can never match a page path.
+func playerDataOverride(kind string) string {
+	return "pdata_kind=" + kind
+}
+
+func (server *Server) inMaintenance() bool {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	return server.maintenance
+}
+
+func (server *Server) override(path string) (contents []byte, ok bool) {
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	contents, ok = server.overrides[path]
+	return
+}
+
+func (server *Server) loggedIn(r *http.Request) bool {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return false
+	}
+	server.mtx.Lock()
+	defer server.mtx.Unlock()
+	_, ok := server.sessions[cookie.Value]
+	return ok
+}
+
+// sourceFixtureDir returns the eagate directory of the source tree the
+// package was built from, which is where the fixtures live for tests.
+func sourceFixtureDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..")
+}
+
+func (server *Server) ddrFixture(dir string, name string) string {
+	return filepath.Join(server.FixtureDir, "ddr", "test_data", dir, filepath.Base(name))
+}
+
+func serveFixture(rw http.ResponseWriter, file string) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		http.Error(rw, "not found", http.StatusNotFound)
+		return
+	}
+	writeHtml(rw, contents)
+}
+
+func writeHtml(rw http.ResponseWriter, contents []byte) {
+	rw.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	rw.Write(contents)
+}
+
+func writeJson(rw http.ResponseWriter, value interface{}) {
+	rw.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(rw).Encode(value)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func randomDigits(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	for i := range b {
+		b[i] = '0' + b[i]%10
+	}
+	return string(b)
+}
+
+func randomInt(n int) int {
+	b := make([]byte, 1)
+	rand.Read(b)
+	return int(b[0]) % n
+}
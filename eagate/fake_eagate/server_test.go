@@ -0,0 +1,163 @@
+package fake_eagate
+
+import (
+	"github.com/chris-sg/bst_api/eagate/ddr"
+	"github.com/chris-sg/bst_api/eagate/drs"
+	"github.com/chris-sg/bst_api/eagate/user"
+	"github.com/chris-sg/bst_api/eagate/util"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"testing"
+)
+
+// testServer starts a fake eagate with one user and points the eagate
+// clients at it. The returned func restores the real eagate.
+func testServer() (*Server, func()) {
+	server := NewServer()
+	server.AddUser("bst", "password", "")
+	for md5, character := range CaptchaChecksums() {
+		user.RegisterCaptchaChecksum(md5, character)
+	}
+
+	base := util.EaBaseURI()
+	util.SetEaBaseURI(server.URL)
+	return server, func() {
+		util.SetEaBaseURI(base)
+		server.Close()
+	}
+}
+
+func TestLoginAndLoadPages(t *testing.T) {
+	server, closeServer := testServer()
+	defer closeServer()
+	client := util.GenerateClient()
+
+	if client.LoginState() {
+		t.Fatalf("client was logged in before login")
+	}
+	if err := user.GetCookieFromEaGate("bst", "wrong", "", client); !err.Equals(bst_models.ErrorIncorrectDetails) {
+		t.Fatalf("login with wrong password: expected %s but got %s", bst_models.ErrorIncorrectDetails.Message, err.Message)
+	}
+	if err := user.GetCookieFromEaGate("bst", "password", "", client); !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("login failed: %s", err.Message)
+	}
+	if !client.LoginState() {
+		t.Fatalf("client was not logged in after login")
+	}
+	if client.GetEaCookie() == nil || client.GetEaCookie().Name != SessionCookieName {
+		t.Fatalf("session cookie was not set")
+	}
+
+	playerDetails, _, err := ddr.PlayerInformationForClient(client)
+	if !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("failed to load ddr player information: %s", err.Message)
+	}
+	if playerDetails.Code == 0 {
+		t.Errorf("ddr player code was not parsed")
+	}
+	songIds, err := ddr.SongIdsForClient(client)
+	if !err.Equals(bst_models.ErrorOK) || len(songIds) == 0 {
+		t.Errorf("failed to load ddr song ids: %s", err.Message)
+	}
+
+	dancerInfo, err := drs.LoadDancerInfo(client)
+	if !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("failed to load drs dancer info: %s", err.Message)
+	}
+	musicData, err := drs.LoadMusicData(client)
+	if !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("failed to load drs music data: %s", err.Message)
+	}
+	playHist, err := drs.LoadPlayHist(client)
+	if !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("failed to load drs play history: %s", err.Message)
+	}
+	details, _, songs, _, stats, scores, report := drs.Transform(dancerInfo, musicData, playHist)
+	if !report.Empty() {
+		t.Errorf("unexpected drs transform report %+v", report)
+	}
+	if details.Name != "FAKEDANCER" || details.Code != 12345678 {
+		t.Errorf("unexpected drs player details %+v", details)
+	}
+	if len(songs) != 2 || len(stats) != 2 || len(scores) != 2 {
+		t.Errorf("expected 2 songs, stats and scores but got %d, %d and %d", len(songs), len(stats), len(scores))
+	}
+
+	server.ExpireSessions()
+	if client.LoginState() {
+		t.Errorf("client was still logged in after sessions expired")
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	server, closeServer := testServer()
+	defer closeServer()
+	client := util.GenerateClient()
+
+	if util.IsMaintenanceMode(client) {
+		t.Fatalf("maintenance mode was reported before it was enabled")
+	}
+	server.SetMaintenance(true)
+	if !util.IsMaintenanceMode(client) {
+		t.Fatalf("maintenance mode was not reported after it was enabled")
+	}
+	if err := user.GetCookieFromEaGate("bst", "password", "", client); err.Equals(bst_models.ErrorOK) {
+		t.Errorf("login succeeded during maintenance")
+	}
+	server.SetMaintenance(false)
+	if util.IsMaintenanceMode(client) {
+		t.Errorf("maintenance mode was reported after it was disabled")
+	}
+}
+
+func TestParserHealth(t *testing.T) {
+	server, closeServer := testServer()
+	defer closeServer()
+	client := util.GenerateClient()
+	if err := user.GetCookieFromEaGate("bst", "password", "", client); !err.Equals(bst_models.ErrorOK) {
+		t.Fatalf("login failed: %s", err.Message)
+	}
+
+	songIds := []string{"1PoOQPd0D01Q9O0doiQQQ8D8Q096bDq9", "8bQQ0lP96186D8Ibo8IoOd6o16qioiIo"}
+	charts, err := ddr.SongDifficultiesForClient(client, songIds)
+	if !err.Equals(bst_models.ErrorOK) {
+		t.Errorf("failed to load ddr song difficulties: %s", err.Message)
+	}
+	songs, err := ddr.SongDataForClient(client, songIds)
+	if !err.Equals(bst_models.ErrorOK) || len(songs) != len(songIds) {
+		t.Errorf("failed to load ddr song data: %s", err.Message)
+	}
+	for _, song := range songs {
+		if len(song.Name) == 0 {
+			t.Errorf("expected a song name from the fixtures but got %+v", song)
+		}
+	}
+	if _, err := ddr.SongStatisticsForClient(client, charts, 12345678); !err.Equals(bst_models.ErrorOK) {
+		t.Errorf("failed to load ddr chart statistics: %s", err.Message)
+	}
+	if _, err := ddr.RecentScoresForClient(client, 12345678); !err.Equals(bst_models.ErrorOK) {
+		t.Errorf("failed to load ddr recent scores: %s", err.Message)
+	}
+	if _, err := ddr.WorkoutDataForClient(client, 12345678); !err.Equals(bst_models.ErrorOK) {
+		t.Errorf("failed to load ddr workout data: %s", err.Message)
+	}
+	for _, health := range util.ParserHealthReport() {
+		if health.Status != util.ParserStatusOk {
+			t.Errorf("parser %s was %s for fixtures: %v", health.Parser, health.Status, health.SampleFailures)
+		}
+	}
+
+	server.OverridePage("/game/ddr/ddra20/p/playdata/index.html",
+		[]byte(`<html><body><table id="status"><tr><th>ダンサー名</th><td>EAGATE</td></tr></table></body></html>`))
+	if _, _, err := ddr.PlayerInformationForClient(client); !err.Equals(bst_models.ErrorGormSelector) {
+		t.Errorf("changed player page: expected %s but got %s", bst_models.ErrorGormSelector.Message, err.Message)
+	}
+	degraded := false
+	for _, health := range util.ParserHealthReport() {
+		if health.Parser == "ddr_player_information" {
+			degraded = health.Status == util.ParserStatusDegraded && len(health.SampleFailures) == 1
+		}
+	}
+	if !degraded {
+		t.Errorf("ddr_player_information was not reported as degraded")
+	}
+}
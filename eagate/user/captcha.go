@@ -68,6 +68,16 @@ func getChecksums() map[string]string {
 	}
 }
 
+// registeredChecksums holds checksums added through RegisterCaptchaChecksum,
+// such as those of the fake_eagate captcha images.
+var registeredChecksums = map[string]string{}
+
+// RegisterCaptchaChecksum will map an additional image checksum to a
+// character name. It should only be called during startup.
+func RegisterCaptchaChecksum(md5 string, character string) {
+	registeredChecksums[md5] = character
+}
+
 // GetCookieFromEaGate will submit a request to login as the given
 // username with the provided password and optionally, otp.
 func GetCookieFromEaGate(username string, password string, otp string, client util.EaClient) (bst_models.Error) {
@@ -247,5 +257,8 @@ func FindCharacterFromMD5(md5 string) (string, bst_models.Error) {
 	if val, ok := getChecksums()[string(md5)]; ok {
 		return val, bst_models.ErrorOK
 	}
+	if val, ok := registeredChecksums[md5]; ok {
+		return val, bst_models.ErrorOK
+	}
 	return "", bst_models.ErrorMd5CharacterMapping
 }
\ No newline at end of file
@@ -40,9 +40,11 @@ func GenerateClient() EaClient {
 			return http.ErrUseLastResponse
 		},
 		Jar: jar,
-		Transport: ClientRateLimiter {
-			http.DefaultTransport,
-			s,
+		Transport: RecordingRoundTripper {
+			ClientRateLimiter {
+				http.DefaultTransport,
+				s,
+			},
 		},
 	}
 	return EaClient{client, user_models.User{}, ""}
@@ -80,9 +82,9 @@ func (client *EaClient) GetUserModel() user_models.User {
 }
 
 func (client *EaClient) SetEaCookie(cookie *http.Cookie) {
-	eagate, _ := url.Parse("https://p.eagate.573.jp")
+	eagate, _ := url.Parse(EaBaseURI())
 	var cookies []*http.Cookie
-	cookie.Domain = "p.eagate.573.jp"
+	cookie.Domain = eagate.Hostname()
 	cookies = append(cookies, cookie)
 
 	client.Client.Jar.SetCookies(eagate, cookies)
@@ -92,7 +94,7 @@ func (client *EaClient) SetEaCookie(cookie *http.Cookie) {
 
 
 func (client *EaClient) GetEaCookie() *http.Cookie {
-	eagate, _ := url.Parse("https://p.eagate.573.jp")
+	eagate, _ := url.Parse(EaBaseURI())
 	currCookie := client.Client.Jar.Cookies(eagate)
 	if len(currCookie) == 0 {
 		return nil
@@ -106,7 +108,7 @@ func (client *EaClient) GetEaCookieExpirationTime() int64 {
 }
 
 func (client *EaClient) LoginState() bool {
-	res, err := client.Client.Get("https://p.eagate.573.jp/gate/p/mypage/index.html")
+	res, err := client.Client.Get(BuildEaURI("/gate/p/mypage/index.html"))
 	if err != nil {
 		glog.Warningf("loginstate had error: %s", err.Error())
 		return false
@@ -137,13 +139,15 @@ func (client *EaClient) SetTestClient(testServer *httptest.Server, responseMap m
 	}
 }
 
+// TestClientProxy serves the file mapped to each request's FixtureKey.
+// LoadRecordedFixtures builds such a map from a recording.
 type TestClientProxy struct {
 	Proxy http.RoundTripper
 	ResponseMap map[string]string
 }
 
 func (tcp TestClientProxy) RoundTrip(req *http.Request) (*http.Response, error) {
-	if file, ok := tcp.ResponseMap[req.URL.String()]; ok {
+	if file, ok := tcp.ResponseMap[FixtureKey(req)]; ok {
 		fileContents, err := ioutil.ReadFile(file)
 		if err == nil {
 			r := &http.Response{
@@ -19,7 +19,7 @@ import (
 
 func IsMaintenanceMode(client EaClient) bool {
 	glog.Infof("checking maintenancemode for user %s\n", client.GetUserModel().Name)
-	doc, _, err := GetPageContentAsGoQuery(client.Client, "https://p.eagate.573.jp/game/")
+	doc, _, err := GetPageContentAsGoQuery(client.Client, BuildEaURI("/game/"))
 	if !err.Equals(bst_models.ErrorOK) {
 		glog.Warningf("failed to get page content for maintenancemode: %s\n", err.Message)
 		return true
@@ -154,7 +154,22 @@ func GetPageContentAsGoQuery(client *http.Client, resource string) (*goquery.Doc
 	return doc, res.StatusCode, bst_models.ErrorOK
 }
 
+// eaBaseURI is the scheme and host that every eagate resource is
+// requested from. It is only changed to point at a stand-in server.
+var eaBaseURI = "https://p.eagate.573.jp"
+
+// SetEaBaseURI will point all eagate requests at the given base, such
+// as a fake_eagate server. It should be called before any clients are
+// in use.
+func SetEaBaseURI(base string) {
+	eaBaseURI = strings.TrimSuffix(base, "/")
+	glog.Infof("eagate base uri set to %s\n", eaBaseURI)
+}
+
+func EaBaseURI() string {
+	return eaBaseURI
+}
+
 func BuildEaURI(resource string) string {
-	const ea = "https://p.eagate.573.jp"
-	return ea + resource
+	return eaBaseURI + resource
 }
\ No newline at end of file
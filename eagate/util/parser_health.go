@@ -0,0 +1,147 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/golang/glog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ParserStatusOk       = "ok"
+	ParserStatusDegraded = "degraded"
+
+	// maxSampleFailures is how many recent failures are kept per parser.
+	maxSampleFailures = 5
+)
+
+// ParserHealth is the validation history of one eagate page type. A
+// parser is degraded from its first failed check until a check passes.
+type ParserHealth struct {
+	Parser              string          `json:"parser"`
+	Status              string          `json:"status"`
+	Checks              int             `json:"checks"`
+	Failures            int             `json:"failures"`
+	ConsecutiveFailures int             `json:"consecutive_failures"`
+	LastChecked         time.Time       `json:"last_checked"`
+	SampleFailures      []ParserFailure `json:"sample_failures"`
+}
+
+type ParserFailure struct {
+	Time     time.Time `json:"time"`
+	Problems []string  `json:"problems"`
+}
+
+var (
+	parserHealth    = make(map[string]*ParserHealth)
+	parserHealthMtx sync.Mutex
+)
+
+// RecordParserCheck will record the result of validating a page for the
+// parser. It returns whether the page passed, so callers can stop before
+// parsing a page that has changed structure.
+func RecordParserCheck(parser string, problems []string) bool {
+	parserHealthMtx.Lock()
+	defer parserHealthMtx.Unlock()
+
+	health, exists := parserHealth[parser]
+	if !exists {
+		health = &ParserHealth{Parser: parser, SampleFailures: make([]ParserFailure, 0)}
+		parserHealth[parser] = health
+	}
+	health.Checks++
+	health.LastChecked = time.Now()
+
+	if len(problems) == 0 {
+		health.Status = ParserStatusOk
+		health.ConsecutiveFailures = 0
+		return true
+	}
+
+	glog.Warningf("parser %s failed validation: %s\n", parser, strings.Join(problems, ", "))
+	health.Status = ParserStatusDegraded
+	health.Failures++
+	health.ConsecutiveFailures++
+	health.SampleFailures = append(health.SampleFailures, ParserFailure{health.LastChecked, problems})
+	if len(health.SampleFailures) > maxSampleFailures {
+		health.SampleFailures = health.SampleFailures[len(health.SampleFailures)-maxSampleFailures:]
+	}
+	return false
+}
+
+// ParserHealthReport returns the health of every parser that has been
+// checked, ordered by parser name.
+func ParserHealthReport() (report []ParserHealth) {
+	parserHealthMtx.Lock()
+	defer parserHealthMtx.Unlock()
+
+	report = make([]ParserHealth, 0, len(parserHealth))
+	for _, health := range parserHealth {
+		h := *health
+		h.SampleFailures = append([]ParserFailure{}, health.SampleFailures...)
+		report = append(report, h)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Parser < report[j].Parser
+	})
+	return
+}
+
+// MissingSelectors returns a problem for every selector that matches
+// nothing in the document.
+func MissingSelectors(document *goquery.Document, selectors ...string) (problems []string) {
+	for _, selector := range selectors {
+		if document.Find(selector).Length() == 0 {
+			problems = append(problems, fmt.Sprintf("missing selector %s", selector))
+		}
+	}
+	return
+}
+
+// MissingTableHeaders returns a problem for every header that is not a
+// th within the selection.
+func MissingTableHeaders(selection *goquery.Selection, headers ...string) (problems []string) {
+	found := make(map[string]bool)
+	selection.Find("th").Each(func(i int, s *goquery.Selection) {
+		found[strings.TrimSpace(s.Text())] = true
+	})
+	for _, header := range headers {
+		if !found[header] {
+			problems = append(problems, fmt.Sprintf("missing table header %s", header))
+		}
+	}
+	return
+}
+
+// MissingJsonFields returns a problem for every dot separated path that
+// is not present in the json body.
+func MissingJsonFields(body []byte, paths ...string) (problems []string) {
+	var root interface{}
+	if err := json.Unmarshal(body, &root); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid json: %s", err.Error()))
+		return
+	}
+	for _, path := range paths {
+		current := root
+		for _, field := range strings.Split(path, ".") {
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				current = nil
+				break
+			}
+			current, ok = object[field]
+			if !ok {
+				current = nil
+				break
+			}
+		}
+		if current == nil {
+			problems = append(problems, fmt.Sprintf("missing json field %s", path))
+		}
+	}
+	return
+}
@@ -0,0 +1,298 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// recordingIndexFile maps each fixture key to its file within a recording
+// directory.
+const recordingIndexFile = "index.json"
+
+var (
+	activeRecorder *Recorder
+	recorderMtx    sync.Mutex
+
+	ddrDancerNamePattern   = regexp.MustCompile(`<th>ダンサーネーム</th>\s*<td>([^<]+)</td>`)
+	ddrCodePattern         = regexp.MustCompile(`<th>DDR-CODE</th>\s*<td>([0-9-]+)</td>`)
+	dancerNameDivPattern   = regexp.MustCompile(`id="dancer_name"[\s\S]*?class="name_str">([^<]+)</div>`)
+	nicknameDivPattern     = regexp.MustCompile(`id="community_nickname"[\s\S]*?class="name_str">([^<]+)</div>`)
+	jsonProfileNamePattern = regexp.MustCompile(`"profile"\s*:\s*\{[^{}]*?"name"\s*:\s*"([^"]+)"`)
+	jsonPlayerCodePattern  = regexp.MustCompile(`"(?:member_code|code)"\s*:\s*([0-9]+)`)
+)
+
+// Recorder saves eagate responses as fixtures that TestClientProxy can
+// replay. Dancer names, nicknames and player codes are replaced with the
+// placeholders used by the existing test_data before anything is written.
+type Recorder struct {
+	dir string
+
+	mtx        sync.Mutex
+	index      map[string]string
+	redactions map[string]string
+	names      int
+	nicknames  int
+	codes      int
+}
+
+// NewRecorder will create a recorder for the directory, adding to any
+// recording already there.
+func NewRecorder(dir string) (recorder *Recorder, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	index := make(map[string]string)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, recordingIndexFile))
+	if err == nil {
+		if err = json.Unmarshal(contents, &index); err != nil {
+			return
+		}
+	} else if !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+	recorder = &Recorder{
+		dir:        dir,
+		index:      index,
+		redactions: make(map[string]string),
+	}
+	return
+}
+
+// StartRecording will record every eagate response made by clients from
+// GenerateClient into dir until StopRecording is called.
+func StartRecording(dir string) error {
+	recorder, err := NewRecorder(dir)
+	if err != nil {
+		return err
+	}
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	activeRecorder = recorder
+	glog.Infof("recording eagate responses to %s\n", dir)
+	return nil
+}
+
+func StopRecording() {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	if activeRecorder != nil {
+		glog.Infof("stopped recording eagate responses to %s\n", activeRecorder.dir)
+	}
+	activeRecorder = nil
+}
+
+// RecordingDir returns the directory being recorded to, or an empty
+// string when not recording.
+func RecordingDir() string {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	if activeRecorder == nil {
+		return ""
+	}
+	return activeRecorder.dir
+}
+
+func currentRecorder() *Recorder {
+	recorderMtx.Lock()
+	defer recorderMtx.Unlock()
+	return activeRecorder
+}
+
+// LoadRecordedFixtures will read the index of a recording directory into
+// a response map for SetTestClient.
+func LoadRecordedFixtures(dir string) (responseMap map[string]string, err error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, recordingIndexFile))
+	if err != nil {
+		return
+	}
+	index := make(map[string]string)
+	if err = json.Unmarshal(contents, &index); err != nil {
+		return
+	}
+	responseMap = make(map[string]string)
+	for key, file := range index {
+		responseMap[key] = filepath.Join(dir, file)
+	}
+	return
+}
+
+// FixtureKey identifies a request within a recording. It is the url for
+// requests without a body, such as every ddr page, and the url followed
+// by the form for posts, such as the drs pdata_getdata api.
+func FixtureKey(req *http.Request) string {
+	key := req.URL.String()
+	if req.Body == nil || req.Body == http.NoBody {
+		return key
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		if reader, err := req.GetBody(); err == nil {
+			body, _ = ioutil.ReadAll(reader)
+			reader.Close()
+		}
+	} else {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if len(body) > 0 {
+		key += "#" + string(body)
+	}
+	return key
+}
+
+// Record will save the response body for key with all personal
+// identifiers redacted. The response body is left readable for the
+// caller. Login requests are never recorded as they carry credentials.
+func (recorder *Recorder) Record(key string, req *http.Request, res *http.Response) (err error) {
+	if res.StatusCode != http.StatusOK || strings.HasPrefix(req.URL.Path, "/gate/p/common/login/") {
+		return
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	if strings.Contains(res.Header.Get("Content-Type"), "Windows-31J") {
+		body = ShiftJISBytesToUTF8Bytes(body)
+	}
+	extension := ".html"
+	if strings.Contains(res.Header.Get("Content-Type"), "json") {
+		extension = ".json"
+	}
+
+	recorder.mtx.Lock()
+	defer recorder.mtx.Unlock()
+
+	body = recorder.redact(body)
+
+	file, exists := recorder.index[key]
+	if !exists {
+		name := strings.TrimSuffix(path.Base(req.URL.Path), path.Ext(req.URL.Path))
+		file = fmt.Sprintf("%04d_%s%s", len(recorder.index), name, extension)
+	}
+	if err = ioutil.WriteFile(filepath.Join(recorder.dir, file), body, 0644); err != nil {
+		glog.Errorf("failed to record %s: %s\n", key, err.Error())
+		return
+	}
+	recorder.index[key] = file
+
+	index, _ := json.MarshalIndent(recorder.index, "", "  ")
+	if err = ioutil.WriteFile(filepath.Join(recorder.dir, recordingIndexFile), index, 0644); err != nil {
+		glog.Errorf("failed to write recording index for %s: %s\n", recorder.dir, err.Error())
+	}
+	return
+}
+
+// redact will learn any identifiers in body and replace every known
+// identifier with its placeholder. Placeholders stay the same for the
+// whole recording, so pages still refer to the same players.
+func (recorder *Recorder) redact(body []byte) []byte {
+	for _, match := range ddrDancerNamePattern.FindAllSubmatch(body, -1) {
+		recorder.learn(string(match[1]), &recorder.names, "EAGATE")
+	}
+	for _, match := range dancerNameDivPattern.FindAllSubmatch(body, -1) {
+		recorder.learn(string(match[1]), &recorder.names, "EAGATE")
+	}
+	for _, match := range jsonProfileNamePattern.FindAllSubmatch(body, -1) {
+		recorder.learn(string(match[1]), &recorder.names, "EAGATE")
+	}
+	for _, match := range nicknameDivPattern.FindAllSubmatch(body, -1) {
+		recorder.learn(string(match[1]), &recorder.nicknames, "Eagate")
+	}
+	for _, match := range ddrCodePattern.FindAllSubmatch(body, -1) {
+		recorder.learnCode(string(match[1]))
+	}
+	for _, match := range jsonPlayerCodePattern.FindAllSubmatch(body, -1) {
+		recorder.learnCode(string(match[1]))
+	}
+
+	identifiers := make([]string, 0, len(recorder.redactions))
+	for identifier := range recorder.redactions {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Slice(identifiers, func(i, j int) bool {
+		return len(identifiers[i]) > len(identifiers[j])
+	})
+
+	text := string(body)
+	for _, identifier := range identifiers {
+		placeholder := recorder.redactions[identifier]
+		if _, e := strconv.Atoi(strings.Replace(identifier, "-", "", -1)); e == nil {
+			text = regexp.MustCompile(`\b`+regexp.QuoteMeta(identifier)+`\b`).ReplaceAllString(text, placeholder)
+			continue
+		}
+		text = strings.Replace(text, ">"+identifier+"<", ">"+placeholder+"<", -1)
+		text = strings.Replace(text, `"`+identifier+`"`, `"`+placeholder+`"`, -1)
+	}
+	return []byte(text)
+}
+
+func (recorder *Recorder) learn(identifier string, count *int, placeholder string) {
+	identifier = strings.TrimSpace(identifier)
+	if len(identifier) == 0 {
+		return
+	}
+	if _, exists := recorder.redactions[identifier]; exists {
+		return
+	}
+	*count++
+	if *count > 1 {
+		placeholder += strconv.Itoa(*count)
+	}
+	recorder.redactions[identifier] = placeholder
+}
+
+func (recorder *Recorder) learnCode(code string) {
+	if strings.Trim(code, "0-") == "" {
+		return
+	}
+	if _, exists := recorder.redactions[code]; exists {
+		return
+	}
+	placeholder := strconv.Itoa(12345678 + recorder.codes)
+	recorder.codes++
+	if strings.Contains(code, "-") {
+		placeholder = placeholder[:4] + "-" + placeholder[4:]
+	}
+	recorder.redactions[code] = placeholder
+}
+
+// RecordingRoundTripper will record every response passing through it
+// while recording is switched on with StartRecording.
+type RecordingRoundTripper struct {
+	Proxy http.RoundTripper
+}
+
+func (rrt RecordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := currentRecorder()
+	if recorder == nil {
+		return rrt.Proxy.RoundTrip(req)
+	}
+	key := FixtureKey(req)
+	res, err := rrt.Proxy.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+	if e := recorder.Record(key, req, res); e != nil {
+		glog.Warningf("failed to record %s: %s\n", key, e.Error())
+	}
+	return res, nil
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+const recordedPlayerPage = `<div id="community_nickname" class="nickname"><a><div class="name_str">Someone</div></a></div>
+<div id="dancer_name" class="dancer_name"><a><div class="name_str">DANCER</div></a></div>
+<table id="status"><tr><th>ダンサーネーム</th><td>DANCER</td></tr><tr><th>DDR-CODE</th><td>51234567</td></tr></table>
+<a href="rival.html?rival_id=51234567">rival</a>`
+
+const recordedDancerInfo = `{"data":{"profile":{"name":"DANCER"},"music":{"name":"Song"},"shop":{"name":"Shop"},"p1":{"member_code":51234567},"p2":{"member_code":59999999}}}`
+
+func TestRecordAndReplay(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.Write([]byte(recordedDancerInfo))
+			return
+		}
+		rw.Header().Set("Content-Type", "text/html")
+		rw.Write([]byte(recordedPlayerPage))
+	}))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "bst_recording")
+	if err != nil {
+		t.Fatalf("failed to create recording dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	if err := StartRecording(dir); err != nil {
+		t.Fatalf("failed to start recording: %s", err.Error())
+	}
+	client := GenerateClient()
+	pageUri := s.URL + "/game/ddr/ddra20/p/playdata/index.html"
+	res, err := client.Client.Get(pageUri)
+	if err != nil {
+		t.Fatalf("failed to get page: %s", err.Error())
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != recordedPlayerPage {
+		t.Errorf("recording changed the response seen by the client")
+	}
+	form := url.Values{}
+	form.Add("pdata_kind", "dancer_info")
+	apiUri := s.URL + "/game/dan/1st/json/pdata_getdata.html"
+	if _, err := client.Client.PostForm(apiUri, form); err != nil {
+		t.Fatalf("failed to post form: %s", err.Error())
+	}
+	StopRecording()
+
+	responseMap, err := LoadRecordedFixtures(dir)
+	if err != nil {
+		t.Fatalf("failed to load recording: %s", err.Error())
+	}
+	if len(responseMap) != 2 {
+		t.Fatalf("expected 2 recorded responses but got %d", len(responseMap))
+	}
+
+	client.SetTestClient(s, responseMap)
+	res, err = client.Client.Get(pageUri)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("failed to replay page")
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	page := string(body)
+	for _, identifier := range []string{"Someone", "DANCER", "51234567"} {
+		if strings.Contains(page, identifier) {
+			t.Errorf("replayed page still contains %s", identifier)
+		}
+	}
+	for _, placeholder := range []string{">Eagate<", ">EAGATE<", ">12345678<", "rival_id=12345678"} {
+		if !strings.Contains(page, placeholder) {
+			t.Errorf("replayed page is missing %s", placeholder)
+		}
+	}
+
+	res, err = client.Client.PostForm(apiUri, form)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("failed to replay form post")
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	expected := `{"data":{"profile":{"name":"EAGATE"},"music":{"name":"Song"},"shop":{"name":"Shop"},"p1":{"member_code":12345678},"p2":{"member_code":12345679}}}`
+	if string(body) != expected {
+		t.Errorf("replayed json did not match: expected %s but got %s", expected, string(body))
+	}
+}
@@ -0,0 +1,94 @@
+// Package games lets each eagate game plug in to the api in the same
+// way. A new game implements Module and is registered in main, which
+// serves its routes, applies its migrations and runs its hourly update.
+package games
+
+import (
+	"fmt"
+	"github.com/chris-sg/bst_api/db/db_builder"
+	"github.com/chris-sg/bst_api/eagate/util"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	bstServerModels "github.com/chris-sg/bst_server_models"
+	"github.com/gorilla/mux"
+	"strings"
+	"sync"
+)
+
+// Module is everything the api needs to serve and update a single
+// eagate game.
+type Module interface {
+	// Name is the short name of the game. Its routes are served under
+	// `/<name>` and its eagate parsers are named `<name>_...`.
+	Name() string
+	// Router will create the router for the game's routes, prefixed
+	// with `/<name>`.
+	Router() *mux.Router
+	// Migrations are the game's schema changes since the baseline.
+	Migrations() []db_builder.Migration
+	// AutoUpdate reports whether the profile has asked for the game to
+	// be updated by the hourly job.
+	AutoUpdate(profile bst_models.BstProfile) bool
+	// Update will load the user's recent plays from eagate.
+	Update(client util.EaClient) bstServerModels.Error
+	// Refresh will reload everything eagate has for the user.
+	Refresh(client util.EaClient) bstServerModels.Error
+	// Status will report the health of the game's eagate parsers.
+	Status() Status
+}
+
+// Status is the health of a game, which is degraded while any of its
+// eagate parsers are.
+type Status struct {
+	Game    string              `json:"game"`
+	Status  string              `json:"status"`
+	Parsers []util.ParserHealth `json:"parsers"`
+}
+
+var (
+	modules   = make([]Module, 0)
+	moduleMtx sync.Mutex
+)
+
+// Register will add a game module and its migrations. Modules must be
+// registered before the db is migrated, and names must be unique.
+func Register(module Module) {
+	moduleMtx.Lock()
+	defer moduleMtx.Unlock()
+	for _, m := range modules {
+		if m.Name() == module.Name() {
+			panic(fmt.Sprintf("game %s registered twice", module.Name()))
+		}
+	}
+	for _, migration := range module.Migrations() {
+		db_builder.RegisterMigration(migration)
+	}
+	modules = append(modules, module)
+}
+
+// Modules will retrieve every registered game module, in the order
+// they were registered.
+func Modules() []Module {
+	moduleMtx.Lock()
+	defer moduleMtx.Unlock()
+	return append([]Module{}, modules...)
+}
+
+// ParserStatus will build the status of a game from the health of the
+// parsers named for it.
+func ParserStatus(game string) Status {
+	status := Status{
+		Game:    game,
+		Status:  util.ParserStatusOk,
+		Parsers: make([]util.ParserHealth, 0),
+	}
+	for _, health := range util.ParserHealthReport() {
+		if !strings.HasPrefix(health.Parser, game+"_") {
+			continue
+		}
+		if health.Status == util.ParserStatusDegraded {
+			status.Status = util.ParserStatusDegraded
+		}
+		status.Parsers = append(status.Parsers, health)
+	}
+	return status
+}
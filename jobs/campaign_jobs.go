@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/eagate/campaign"
+	"github.com/chris-sg/bst_api/eagate/util"
+	"github.com/chris-sg/bst_api/models/api_models"
+	"github.com/chris-sg/bst_api/models/bst_models"
+	"github.com/chris-sg/bst_api/utilities"
+	bstServerModels "github.com/chris-sg/bst_server_models"
+	"github.com/golang/glog"
+	"time"
+)
+
+const (
+	CampaignOutcomePlayed  = "played"
+	CampaignOutcomeNoPlays = "no_plays"
+	CampaignOutcomeFailed  = "failed"
+)
+
+// playCampaigns will play every active campaign the profile has opted
+// in to, recording each play made. Campaigns which have ended or not
+// yet started are skipped. It returns the number that failed.
+func playCampaigns(client util.EaClient, profile bst_models.BstProfile) (failed int) {
+	for _, c := range campaign.ActiveCampaigns(time.Now()) {
+		if !profile.OptedIn(c.Id) {
+			continue
+		}
+
+		plays, err := c.Strategy.Play(client)
+		now := time.Now()
+		records := make([]api_models.CampaignPlay, 0, len(plays)+1)
+		for _, play := range plays {
+			records = append(records, api_models.CampaignPlay{
+				Choice:  play.Choice,
+				Result:  play.Result,
+				Outcome: CampaignOutcomePlayed,
+			})
+		}
+		if !err.Equals(bstServerModels.ErrorOK) {
+			glog.Warningf("failed to play campaign %s for %s: %s", c.Id, client.GetUserModel().Name, err.Message)
+			records = append(records, api_models.CampaignPlay{Outcome: CampaignOutcomeFailed})
+			failed++
+		} else if len(plays) == 0 {
+			records = append(records, api_models.CampaignPlay{Outcome: CampaignOutcomeNoPlays})
+		}
+		glog.Infof("%s played campaign %s %d times", client.GetUserModel().Name, c.Id, len(plays))
+
+		for _, record := range records {
+			record.WebUser = profile.User
+			record.EaGateUser = client.GetUserModel().Name
+			record.Campaign = c.Id
+			record.Time = now
+			errs := db.GetApiDb().AddCampaignPlay(record)
+			utilities.PrintErrors("failed to record campaign play:", errs)
+		}
+	}
+	return
+}
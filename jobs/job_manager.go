@@ -2,9 +2,8 @@ package jobs
 
 import (
 	"github.com/chris-sg/bst_api/db"
-	"github.com/chris-sg/bst_api/ddr"
-	"github.com/chris-sg/bst_api/eagate/janken"
 	"github.com/chris-sg/bst_api/eagate/user"
+	"github.com/chris-sg/bst_api/games"
 	"github.com/chris-sg/bst_api/utilities"
 	bst_models "github.com/chris-sg/bst_server_models"
 	"github.com/golang/glog"
@@ -13,6 +12,9 @@ import (
 
 func StartJobs() {
 	go RunJobs()
+	if len(utilities.VideoArchiveDir) > 0 {
+		go RunVideoArchive()
+	}
 }
 
 func RunJobs() {
@@ -29,10 +31,12 @@ func RunJobs() {
 			continue
 		}
 
-		// Run ddr updates
-		ddrUpdateCount := 0
-		ddrFailedCount := 0
-		jankenFailedCount := 0
+		// Run game updates
+		modules := games.Modules()
+		updateCounts := make([]int, len(modules))
+		failedCounts := make([]int, len(modules))
+		clientFailedCount := 0
+		campaignFailedCount := 0
 		for _, profile := range profilesToUpdate {
 			func() {
 				usernames, errs := db.GetUserDb().RetrieveUsernamesByWebId(profile.User)
@@ -41,35 +45,35 @@ func RunJobs() {
 				}
 				u, exists, errs := db.GetUserDb().RetrieveUserByUserId(usernames[0])
 				if utilities.PrintErrors("failed to retrieve user", errs) || !exists {
-					ddrFailedCount++
+					clientFailedCount++
 					return
 				}
 				client, err := user.CreateClientForUser(u)
 				defer client.UpdateCookie()
 				if !err.Equals(bst_models.ErrorOK) {
-					ddrFailedCount++
+					clientFailedCount++
 					glog.Warning(err)
 					return
 				}
-				if profile.DdrAutoUpdate {
-					err = ddr.UpdatePlayerProfile(u, client)
+				for i, module := range modules {
+					if !module.AutoUpdate(profile) {
+						continue
+					}
+					err = module.Update(client)
 					if !err.Equals(bst_models.ErrorOK) {
-						ddrFailedCount++
+						failedCounts[i]++
 						glog.Warning(err)
 					}
-					ddrUpdateCount++
+					updateCounts[i]++
 				}
 
-				playCount, err := janken.PlayJanken(client)
-				if !err.Equals(bst_models.ErrorOK) {
-					jankenFailedCount++
-					glog.Warning(err)
-				}
-				glog.Infof("%s played janken %d times", client.GetUserModel().Name, playCount)
-
-				janken.PlayWbr(client)
+				campaignFailedCount += playCampaigns(client, profile)
 			}()
 		}
-		glog.Infof("successfully updated %d/%d ddr profiles (%d failed)", ddrUpdateCount, len(profilesToUpdate), ddrFailedCount)
+		for i, module := range modules {
+			glog.Infof("successfully updated %d/%d %s profiles (%d failed)", updateCounts[i], len(profilesToUpdate), module.Name(), failedCounts[i])
+		}
+		glog.Infof("%d profiles could not be logged in to eagate", clientFailedCount)
+		glog.Infof("%d campaign plays failed", campaignFailedCount)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/chris-sg/bst_api/utilities"
+	"github.com/golang/glog"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// RunVideoArchive will archive drs play videos every hour. It is only
+// started when an archive directory is configured.
+func RunVideoArchive() {
+	archiveVideos()
+	for range time.Tick(time.Hour) {
+		archiveVideos()
+	}
+}
+
+// archiveVideos will remove archived videos past the retention period,
+// then download videos which have not been archived until the archive
+// reaches its size limit. A link that has already expired, or a video
+// too large for the space left, is recorded without a file so it is not
+// requested again.
+func archiveVideos() {
+	now := time.Now()
+	since := time.Time{}
+	if utilities.VideoArchiveRetentionDays > 0 {
+		since = now.AddDate(0, 0, -utilities.VideoArchiveRetentionDays)
+	}
+
+	videos, errs := db.GetDrsDb().RetrieveArchivedVideos(0)
+	if utilities.PrintErrors("failed to retrieve archived videos:", errs) {
+		return
+	}
+	var used int64
+	for _, video := range videos {
+		if video.PlayTime.Before(since) {
+			errs = db.GetDrsDb().DeleteArchivedVideo(video.Id)
+			if !utilities.PrintErrors("failed to delete archived video:", errs) {
+				utilities.RemoveArchivedVideoFiles([]drs_models.ArchivedVideo{video})
+			}
+			continue
+		}
+		used += video.Size
+	}
+
+	scores, errs := db.GetDrsDb().RetrieveUnarchivedVideoScores(since)
+	if utilities.PrintErrors("failed to retrieve unarchived videos:", errs) {
+		return
+	}
+
+	limit := utilities.VideoArchiveMaxMb * 1024 * 1024
+	// videos are fetched directly, rather than through an eagate client,
+	// so they are never written to a recording
+	client := &http.Client{Timeout: 10 * time.Minute}
+	archived := make(map[string]bool)
+	for _, score := range scores {
+		if archived[*score.VideoUrl] {
+			continue
+		}
+		if used >= limit {
+			glog.Warningf("video archive is full (%d bytes), %d videos were not archived", used, len(scores)-len(archived))
+			return
+		}
+		archived[*score.VideoUrl] = true
+
+		video, ok := downloadVideo(client, score, limit-used)
+		if !ok {
+			continue
+		}
+		video.ArchivedAt = now
+		errs = db.GetDrsDb().AddArchivedVideo(video)
+		if utilities.PrintErrors("failed to add archived video:", errs) {
+			utilities.RemoveArchivedVideoFiles([]drs_models.ArchivedVideo{video})
+			continue
+		}
+		used += video.Size
+	}
+}
+
+// downloadVideo will save the video for score into the archive, up to
+// remaining bytes. A video larger than remaining is skipped, returning
+// it without a file. It returns false if nothing should be recorded,
+// leaving the video to be tried again later.
+func downloadVideo(client *http.Client, score drs_models.PlayerScore, remaining int64) (video drs_models.ArchivedVideo, ok bool) {
+	video = drs_models.ArchivedVideo{
+		VideoUrl:   *score.VideoUrl,
+		PlayerCode: score.PlayerCode,
+		PlayTime:   score.PlayTime,
+	}
+
+	res, err := client.Get(video.VideoUrl)
+	if err != nil {
+		glog.Warningf("failed to download video %s: %s\n", video.VideoUrl, err.Error())
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusGone {
+		glog.Infof("video %s expired before it was archived\n", video.VideoUrl)
+		ok = true
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		glog.Warningf("failed to download video %s: status %d\n", video.VideoUrl, res.StatusCode)
+		return
+	}
+	if res.ContentLength > remaining {
+		glog.Warningf("video %s does not fit in the video archive, skipping\n", video.VideoUrl)
+		ok = true
+		return
+	}
+
+	sum := sha1.Sum([]byte(video.VideoUrl))
+	extension := path.Ext(res.Request.URL.Path)
+	if len(extension) == 0 {
+		extension = ".mp4"
+	}
+	video.File = fmt.Sprintf("%d/%s%s", score.PlayerCode, hex.EncodeToString(sum[:]), extension)
+	file := utilities.ArchivedVideoPath(video)
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		glog.Errorf("failed to create video archive directory: %s\n", err.Error())
+		return
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		glog.Errorf("failed to create archived video %s: %s\n", file, err.Error())
+		return
+	}
+	video.Size, err = io.Copy(out, io.LimitReader(res.Body, remaining+1))
+	out.Close()
+	if err != nil {
+		glog.Warningf("failed to download video %s: %s\n", video.VideoUrl, err.Error())
+		os.Remove(file)
+		return
+	}
+	if video.Size > remaining {
+		glog.Warningf("video %s does not fit in the video archive, skipping\n", video.VideoUrl)
+		os.Remove(file)
+		video.File = ""
+		video.Size = 0
+		ok = true
+		return
+	}
+	ok = true
+	return
+}
@@ -21,4 +21,52 @@ func (AutomaticJob) ColumnName() string {
 type Action struct {
 	Id [16]byte `json:"id" gorm:"column:id;primary_key"`
 	State string `json:"state" gorm:"column:state"`
-}
\ No newline at end of file
+}
+
+// AuditEntry is a single row in the append-only audit log. Actor is
+// the user that made the request, while EffectiveUser is the user the
+// request acted as (these differ when impersonating).
+type AuditEntry struct {
+	Id            int       `json:"id" gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	Time          time.Time `json:"time" gorm:"column:occurred_at;index"`
+	Actor         string    `json:"actor" gorm:"column:actor;index"`
+	EffectiveUser string    `json:"effective_user" gorm:"column:effective_user;index"`
+	Action        string    `json:"action" gorm:"column:action"`
+	Target        string    `json:"target" gorm:"column:target"`
+	RequestId     string    `json:"request_id" gorm:"column:request_id"`
+	Outcome       string    `json:"outcome" gorm:"column:outcome"`
+}
+
+func (AuditEntry) TableName() string {
+	return "auditLog"
+}
+
+// CampaignPlay records a single play of a campaign on behalf of a
+// user. Runs that could not play (failed, or nothing left to play
+// today) are recorded with no choice or result.
+type CampaignPlay struct {
+	Id         int       `json:"id" gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	WebUser    string    `json:"-" gorm:"column:user_sub;index"`
+	EaGateUser string    `json:"eagate_user" gorm:"column:eagate_user"`
+	Campaign   string    `json:"campaign" gorm:"column:campaign_id"`
+	Time       time.Time `json:"time" gorm:"column:played_at;index"`
+	Choice     string    `json:"choice" gorm:"column:choice"`
+	Result     string    `json:"result" gorm:"column:result"`
+	Outcome    string    `json:"outcome" gorm:"column:outcome"`
+}
+
+func (CampaignPlay) TableName() string {
+	return "campaignPlays"
+}
+
+// SchemaMigration records a migration which has been applied to the
+// database.
+type SchemaMigration struct {
+	Version   int       `gorm:"column:version;primary_key;auto_increment:false"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
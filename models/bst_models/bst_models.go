@@ -1,15 +1,62 @@
 package bst_models
 
+import (
+	"strings"
+	"time"
+)
+
 type BstProfile struct {
-	UserId int `json:"userid" gorm:"column:user_id;type:serial;primary_key"`
+	UserId int `json:"userid" gorm:"column:user_id;primary_key"`
 	User string `json:"user" gorm:"column:user_sub;unique;not_null"'`
 	Nickname string `json:"nickname" gorm:"column:nickname"`
 	Public bool `json:"public" gorm:"column:public"`
 	EventParticipation bool `json:"event_participation" gorm:"column:event_participation"`
 	DdrAutoUpdate bool `json:"ddrautoupdate" gorm:"column:ddr_auto_update"`
 	DrsAutoUpdate bool `json:"drsautoupdate" gorm:"column:drs_auto_update"`
+	// Campaigns is a comma separated list of the campaign ids the user
+	// has opted in to.
+	Campaigns string `json:"campaigns" gorm:"column:campaigns"`
+	// Timezone is the IANA name of the user's preferred timezone.
+	Timezone string `json:"timezone" gorm:"column:timezone"`
 }
 
 func (BstProfile) TableName() string {
 	return "bstProfile"
-}
\ No newline at end of file
+}
+
+// CampaignIds will split Campaigns into the opted in campaign ids.
+func (profile BstProfile) CampaignIds() []string {
+	ids := make([]string, 0)
+	for _, id := range strings.Split(profile.Campaigns, ",") {
+		if len(id) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (profile BstProfile) OptedIn(campaignId string) bool {
+	for _, id := range profile.CampaignIds() {
+		if id == campaignId {
+			return true
+		}
+	}
+	return false
+}
+
+func (profile *BstProfile) SetCampaignIds(ids []string) {
+	profile.Campaigns = strings.Join(ids, ",")
+}
+
+// Location will load the user's preferred timezone, falling back to
+// UTC if none is set or it is not recognised.
+func (profile BstProfile) Location() *time.Location {
+	if len(profile.Timezone) == 0 {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(profile.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -11,6 +11,7 @@ type PlayerDetails struct {
 	SingleRank  string `tag:"段位(SINGLE)" gorm:"column:single_rank"`
 	DoubleRank  string `tag:"段位(DOUBLE)" gorm:"column:double_rank"`
 	Affiliation string `tag:"所属クラス" gorm:"column:affiliation"`
+	RefreshedAt time.Time `gorm:"column:refreshed_at"`
 
 	EaGateUser *string          `gorm:"column:eagate_user"`
 }
@@ -27,7 +28,7 @@ type Playcount struct {
 	DoublePlaycount    int       `tag:"プレー回数_double" gorm:"column:double_playcount"`
 	DoubleLastPlayDate time.Time `tag:"最終プレー日時_double" gorm:"column:last_double_play_date"`
 
-	PlayerCode int           `gorm:"column:player_code;primary_key"`
+	PlayerCode int           `gorm:"column:player_code;primary_key;auto_increment:false"`
 }
 
 func (Playcount) TableName() string {
@@ -45,23 +46,54 @@ type Song struct {
 	Name   string `gorm:"column:name"`
 	Artist string `gorm:"column:artist"`
 	Image  string `gorm:"column:image"`
+
+	// Details from the song's eagate page, all empty until they have
+	// been read. Availability is how the song is unlocked, and is empty
+	// for songs which are always playable.
+	MinBpm       int16  `gorm:"column:min_bpm"`
+	MaxBpm       int16  `gorm:"column:max_bpm"`
+	Version      string `gorm:"column:version"`
+	Availability string `gorm:"column:availability"`
 }
 
 func (Song) TableName() string {
 	return "ddrSongs"
 }
 
+// HasSongInfo reports whether the bpm and version have been read for
+// the song.
+func (song Song) HasSongInfo() bool {
+	return song.MaxBpm > 0
+}
+
 type SongDifficulty struct {
 	SongId          string `gorm:"column:song_id;primary_key"`
 	Mode            string `gorm:"column:mode;primary_key"`
 	Difficulty      string `gorm:"column:difficulty;primary_key"`
 	DifficultyValue int16  `gorm:"column:difficulty_value"`
+
+	// Groove radar and step counts, all zero until the chart's detail
+	// page has been read.
+	Stream       int16 `gorm:"column:stream"`
+	Voltage      int16 `gorm:"column:voltage"`
+	Air          int16 `gorm:"column:air"`
+	Freeze       int16 `gorm:"column:freeze"`
+	Chaos        int16 `gorm:"column:chaos"`
+	Notes        int   `gorm:"column:notes"`
+	FreezeArrows int   `gorm:"column:freeze_arrows"`
+	ShockArrows  int   `gorm:"column:shock_arrows"`
 }
 
 func (SongDifficulty) TableName() string {
 	return "ddrSongDifficulties"
 }
 
+// HasChartDetails reports whether the groove radar and step counts have
+// been read for the chart. Every chart has at least one note.
+func (difficulty SongDifficulty) HasChartDetails() bool {
+	return difficulty.Notes > 0
+}
+
 type Mode int
 
 const (
@@ -132,7 +164,7 @@ type SongStatistics struct {
 	Mode       string `gorm:"column:mode;primary_key"`
 	Difficulty string `gorm:"column:difficulty;primary_key"`
 
-	PlayerCode int `gorm:"column:player_code;primary_key"`
+	PlayerCode int `gorm:"column:player_code;primary_key;auto_increment:false"`
 }
 
 func (SongStatistics) TableName() string {
@@ -162,7 +194,7 @@ type Score struct {
 	Mode       string `gorm:"column:mode;primary_key"`
 	Difficulty string `gorm:"column:difficulty;primary_key"`
 
-	PlayerCode int `gorm:"column:player_code;primary_key"`
+	PlayerCode int `gorm:"column:player_code;primary_key;auto_increment:false"`
 }
 
 func (Score) TableName() string {
@@ -184,7 +216,7 @@ type WorkoutData struct {
 	PlayCount int `gorm:"column:playcount"`
 	Kcal float32 `gorm:"column:kcal"`
 
-	PlayerCode int `gorm:"column:player_code;primary_key"`
+	PlayerCode int `gorm:"column:player_code;primary_key;auto_increment:false"`
 }
 
 func (WorkoutData) TableName() string {
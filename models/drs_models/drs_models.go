@@ -5,6 +5,8 @@ import "time"
 type PlayerDetails struct {
 	Code int    `gorm:"column:code;primary_key" json:"code"`
 	Name string `gorm:"column:name" json:"name"`
+	// RefreshedAt is when the details were last loaded from eagate.
+	RefreshedAt time.Time `gorm:"column:refreshed_at" json:"refreshedat"`
 
 	EaGateUser *string `gorm:"column:eagate_user" json:"eagateuser"`
 }
@@ -14,23 +16,44 @@ func (PlayerDetails) TableName() string {
 }
 
 type PlayerProfileSnapshot struct {
-	PlayCount   int `gorm:"column:play_count;primary_key" json:"playcount"`
+	PlayCount   int `gorm:"column:play_count;primary_key;auto_increment:false" json:"playcount"`
 	PlaySeconds int `gorm:"column:play_seconds" json:"playseconds"`
 	TotalStars  int `gorm:"column:total_stars" json:"totalstars"`
 	UsedStars   int `gorm:"column:used_stars" json:"usedstars"`
+	StarLimit   int `gorm:"column:star_limit" json:"starlimit"`
+	VoteRights1 int `gorm:"column:vote_rights_1" json:"voterights1"`
+	VoteRights2 int `gorm:"column:vote_rights_2" json:"voterights2"`
 	LastPlayed  time.Time `gorm:"column:last_played" json:"timeplayed"`
 
-	PlayerCode int `gorm:"column:player_code;primary_key" json:"code"`
+	PlayerCode int `gorm:"column:player_code;primary_key;auto_increment:false" json:"code"`
 }
 
 func (PlayerProfileSnapshot) TableName() string {
 	return "drsPlayerProfileSnapshots"
 }
 
+// PlayerUnlock is a song unlocked by a player. Eagate does not say when
+// a song was unlocked, so UnlockedAt is the last play of the refresh the
+// unlock was first seen in. It is nil for songs already unlocked when
+// the player's unlocks were first read, as those could have been
+// unlocked at any time before.
+type PlayerUnlock struct {
+	UnlockedAt *time.Time `gorm:"column:unlocked_at" json:"unlockedat"`
+
+	PlayerCode int    `gorm:"column:player_code;primary_key;auto_increment:false" json:"code"`
+	SongId     string `gorm:"column:song_id;primary_key" json:"id"`
+}
+
+func (PlayerUnlock) TableName() string {
+	return "drsPlayerUnlocks"
+}
+
 type Song struct {
 	SongId         string `gorm:"column:song_id;primary_key" json:"id"`
 	SongName       string `gorm:"column:name" json:"title"`
+	SongYomigana   string `gorm:"column:title_yomigana" json:"titleyomigana"`
 	ArtistName     string `gorm:"column:artist" json:"artist"`
+	ArtistYomigana string `gorm:"column:artist_yomigana" json:"artistyomigana"`
 	MaxBpm         int    `gorm:"column:max_bpm" json:"maxbpm"`
 	MinBpm         int    `gorm:"column:min_bpm" json:"minbpm"`
 	LimitationType int    `gorm:"column:limitation_type" json:"limitation"`
@@ -59,6 +82,7 @@ type PlayerSongStats struct {
 	BestScore         int       `gorm:"column:best_score" json:"bestscore"`
 	Combo             int       `gorm:"column:combo" json:"combo"`
 	PlayCount         int       `gorm:"column:play_count" json:"playcount"`
+	Rank              int       `gorm:"column:rank" json:"rank"`
 	Param             int       `gorm:"column:param" json:"param"`
 	BestScoreDateTime time.Time `gorm:"column:best_score_time" json:"bestscoretime"`
 	LastPlayDateTime  time.Time `gorm:"column:last_play_time" json:"lastplaytime"`
@@ -77,7 +101,7 @@ type PlayerSongStats struct {
 	P2Goods    *int `gorm:"column:p2_goods" json:"p2goods;omitempty"`
 	P2Bads     *int `gorm:"column:p2_bads" json:"p2bads;omitempty"`
 
-	PlayerCode int    `gorm:"column:player_code;primary_key" json:"code"`
+	PlayerCode int    `gorm:"column:player_code;primary_key;auto_increment:false" json:"code"`
 	SongId     string `gorm:"column:song_id;primary_key" json:"id"`
 	Mode       string `gorm:"column:mode;primary_key" json:"mode"`
 	Difficulty string `gorm:"column:difficulty;primary_key" json:"difficulty"`
@@ -96,15 +120,17 @@ func (s1 PlayerSongStats) Equals(s2 PlayerSongStats) bool {
 		s1.LastPlayDateTime.String() == s2.LastPlayDateTime.String() &&
 		s1.BestScore == s2.BestScore &&
 		s1.Combo == s2.Combo &&
-		s1.PlayCount == s2.PlayCount
+		s1.PlayCount == s2.PlayCount &&
+		s1.Rank == s2.Rank
 }
 
 type PlayerScore struct {
 	Shop     string    `gorm:"column:shop" json:"shop"`
 	Score    int       `gorm:"column:score" json:"score"`
 	MaxCombo int       `gorm:"column:max_combo" json:"maxcombo"`
+	Rank     int       `gorm:"column:rank" json:"rank"`
 	Param    int       `gorm:"column:param" json:"param"`
-	PlayTime time.Time `gorm:"column:play_time" json:"playtime"`
+	PlayTime time.Time `gorm:"column:play_time;primary_key" json:"playtime"`
 
 	P1Code     int `gorm:"column:p1_code" json:"p1code"`
 	P1Score    int `gorm:"column:p1_score" json:"p1score"`
@@ -122,7 +148,7 @@ type PlayerScore struct {
 
 	VideoUrl *string `gorm:"column:video_url" json:"videourl;omitempty"`
 
-	PlayerCode int    `gorm:"column:player_code;primary_key" json:"code"`
+	PlayerCode int    `gorm:"column:player_code;primary_key;auto_increment:false" json:"code"`
 	SongId     string `gorm:"column:song_id;primary_key" json:"id"`
 	Mode       string `gorm:"column:mode;primary_key" json:"mode"`
 	Difficulty string `gorm:"column:difficulty;primary_key" json:"difficulty"`
@@ -131,3 +157,22 @@ type PlayerScore struct {
 func (PlayerScore) TableName() string {
 	return "drsPlayerScores"
 }
+
+// ArchivedVideo is a local copy of a play video. Video links from play
+// history expire, so copies are downloaded by the video archive job.
+// File is relative to the archive directory, and is empty when the link
+// had already expired or the video was too large to keep, so there is
+// no copy.
+type ArchivedVideo struct {
+	Id         int       `gorm:"column:id;primary_key;AUTO_INCREMENT" json:"id"`
+	VideoUrl   string    `gorm:"column:video_url;unique_index" json:"videourl"`
+	PlayerCode int       `gorm:"column:player_code;index" json:"code"`
+	File       string    `gorm:"column:file" json:"-"`
+	Size       int64     `gorm:"column:size" json:"size"`
+	PlayTime   time.Time `gorm:"column:play_time" json:"playtime"`
+	ArchivedAt time.Time `gorm:"column:archived_at" json:"archivedat"`
+}
+
+func (ArchivedVideo) TableName() string {
+	return "drsArchivedVideos"
+}
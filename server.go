@@ -2,11 +2,16 @@ package main
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"github.com/chris-sg/bst_api/common"
 	"github.com/chris-sg/bst_api/db"
 	"github.com/chris-sg/bst_api/ddr"
 	"github.com/chris-sg/bst_api/drs"
+	"github.com/chris-sg/bst_api/eagate/fake_eagate"
+	"github.com/chris-sg/bst_api/eagate/user"
+	"github.com/chris-sg/bst_api/eagate/util"
+	"github.com/chris-sg/bst_api/games"
 	"github.com/chris-sg/bst_api/jobs"
 	"github.com/chris-sg/bst_api/utilities"
 	bst_models "github.com/chris-sg/bst_server_models"
@@ -22,16 +27,57 @@ import (
 )
 
 func main() {
+	games.Register(ddr.Module{})
+	games.Register(drs.Module{})
+
 	utilities.LoadConfig()
 	utilities.PrepareMiddleware()
 
 	os.Setenv("GODEBUG", "http2debug=2")
 
 	if utilities.DbMigration {
-		db.GetMigrator().Create()
+		version, errs := db.GetMigrator().Migrate()
+		if utilities.PrintErrors("db migration failed:", errs) {
+			glog.Fatalf("db migration stopped at version %d\n", version)
+		}
+		fmt.Printf("db at version %d\n", version)
+		return
+	}
+
+	if utilities.DbRollback > 0 {
+		version, errs := db.GetMigrator().Rollback(utilities.DbRollback)
+		if utilities.PrintErrors("db rollback failed:", errs) {
+			glog.Fatalf("db rollback stopped at version %d\n", version)
+		}
+		fmt.Printf("db at version %d\n", version)
 		return
 	}
 
+	if len(utilities.SqliteFile) > 0 {
+		version, errs := db.GetMigrator().Migrate()
+		if utilities.PrintErrors("sqlite migration failed:", errs) {
+			glog.Fatalf("sqlite migration stopped at version %d\n", version)
+		}
+	}
+
+	version, errs := db.GetMigrator().CurrentVersion()
+	if utilities.PrintErrors("failed to read db version:", errs) {
+		glog.Fatalln("could not determine db version")
+	}
+	if latest := db.GetMigrator().LatestVersion(); version < latest {
+		glog.Fatalf("db at version %d but version %d is required, run with -dbmigrate\n", version, latest)
+	}
+
+	if len(utilities.FakeEaGate) > 0 {
+		startFakeEaGate(utilities.FakeEaGate)
+	}
+
+	if len(utilities.RecordDir) > 0 {
+		if err := util.StartRecording(utilities.RecordDir); err != nil {
+			glog.Fatalf("failed to start recording to %s: %s\n", utilities.RecordDir, err.Error())
+		}
+	}
+
 	r := CreateApiRouter()
 
 	var certManager *autocert.Manager
@@ -65,6 +111,24 @@ func main() {
 	log.Fatal(srv.ListenAndServeTLS("", ""))
 }
 
+// startFakeEaGate will point every eagate request at a local fake_eagate
+// server, with a single user that can log in with the given credentials.
+func startFakeEaGate(credentials string) {
+	parts := strings.SplitN(credentials, ":", 2)
+	if len(parts) != 2 {
+		glog.Fatalln("fakeeagate must be in the form login_id:password")
+	}
+	server := fake_eagate.NewServer()
+	if len(utilities.FakeEaGateFixtures) > 0 {
+		server.FixtureDir = utilities.FakeEaGateFixtures
+	}
+	server.AddUser(parts[0], parts[1], "")
+	for md5, character := range fake_eagate.CaptchaChecksums() {
+		user.RegisterCaptchaChecksum(md5, character)
+	}
+	util.SetEaBaseURI(server.URL)
+}
+
 func CreateApiRouter() (r *mux.Router) {
 	r = mux.NewRouter()
 	apiRouter := mux.NewRouter()
@@ -72,14 +136,25 @@ func CreateApiRouter() (r *mux.Router) {
 	apiRouter.Path("/runmigration").Handler(utilities.GetProtectionMiddleware().With(
 		negroni.Wrap(http.HandlerFunc(RunDbMigration)))).Methods(http.MethodPatch)
 
+	apiRouter.Path("/recording").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(SetRecording)))).Methods(http.MethodPatch)
+
+	apiRouter.Path("/audit").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(common.AuditGet)))).Methods(http.MethodGet)
+
+	apiRouter.Path("/profile").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(common.ProfileGet)))).Methods(http.MethodGet)
+
+	apiRouter.Path("/activity").Handler(utilities.GetProtectionMiddleware().With(
+		negroni.Wrap(http.HandlerFunc(common.ActivityGet)))).Methods(http.MethodGet)
+
 	apiRouter.PathPrefix("/user").Handler(negroni.New(
 		negroni.Wrap(common.CreateUserRouter())))
 
-	apiRouter.PathPrefix("/ddr").Handler(negroni.New(
-		negroni.Wrap(ddr.CreateDdrRouter())))
-
-	apiRouter.PathPrefix("/drs").Handler(negroni.New(
-		negroni.Wrap(drs.CreateDrsRouter())))
+	for _, module := range games.Modules() {
+		apiRouter.PathPrefix("/" + module.Name()).Handler(negroni.New(
+			negroni.Wrap(module.Router())))
+	}
 
 	common.AttachGeneralRoutes(r)
 
@@ -105,12 +180,92 @@ func RunDbMigration(rw http.ResponseWriter, r *http.Request) {
 			"user %s tried to migrate db, but did not have required scopes %s",
 			val,
 			strings.Join(requiredScopes, ","))
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionDbMigration, "", utilities.AuditOutcomeDenied)
 		utilities.RespondWithError(rw, bst_models.ErrorScope)
 		return
 	}
 
-	db.GetMigrator().Create()
+	version, errs := db.GetMigrator().Migrate()
+	if utilities.PrintErrors("db migration failed:", errs) {
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionDbMigration, fmt.Sprintf("%d", version), utilities.AuditOutcome(bst_models.ErrorDBConnection))
+		utilities.RespondWithError(rw, bst_models.ErrorDBConnection)
+		return
+	}
+	utilities.AuditForToken(r, tokenMap, utilities.AuditActionDbMigration, fmt.Sprintf("%d", version), utilities.AuditOutcomeSuccess)
 
-	utilities.RespondWithError(rw, bst_models.ErrorOK)
+	status := migrationStatus{
+		Status:        "ok",
+		Version:       version,
+		LatestVersion: db.GetMigrator().LatestVersion(),
+	}
+	bytes, _ := json.Marshal(status)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
 	return
+}
+
+// SetRecording will switch recording of eagate responses on or off for
+// the running server. Recording is always into the -recorddir directory.
+func SetRecording(rw http.ResponseWriter, r *http.Request) {
+	requiredScopes := []string{"update:recording"}
+	tokenMap := utilities.ProfileFromToken(r)
+
+	val, ok := tokenMap["sub"].(string)
+	if !ok {
+		utilities.RespondWithError(rw, bst_models.ErrorJwtProfile)
+		return
+	}
+	val = strings.ToLower(val)
+	if !utilities.UserHasScopes(val, requiredScopes) {
+		glog.Warningf(
+			"user %s tried to change recording, but did not have required scopes %s",
+			val,
+			strings.Join(requiredScopes, ","))
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionRecording, "", utilities.AuditOutcomeDenied)
+		utilities.RespondWithError(rw, bst_models.ErrorScope)
+		return
+	}
+
+	enabled := r.URL.Query().Get("enabled")
+	if enabled == "true" {
+		if len(utilities.RecordDir) == 0 {
+			utilities.AuditForToken(r, tokenMap, utilities.AuditActionRecording, "on", utilities.AuditOutcome(bst_models.ErrorBadRequest))
+			utilities.RespondWithError(rw, bst_models.ErrorBadRequest)
+			return
+		}
+		if err := util.StartRecording(utilities.RecordDir); err != nil {
+			glog.Errorf("failed to start recording to %s: %s\n", utilities.RecordDir, err.Error())
+			utilities.AuditForToken(r, tokenMap, utilities.AuditActionRecording, "on", utilities.AuditOutcome(bst_models.ErrorBadRequest))
+			utilities.RespondWithError(rw, bst_models.ErrorBadRequest)
+			return
+		}
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionRecording, "on", utilities.AuditOutcomeSuccess)
+	} else if enabled == "false" {
+		util.StopRecording()
+		utilities.AuditForToken(r, tokenMap, utilities.AuditActionRecording, "off", utilities.AuditOutcomeSuccess)
+	} else {
+		utilities.RespondWithError(rw, bst_models.ErrorBadQuery)
+		return
+	}
+
+	status := recordingStatus{
+		Status:    "ok",
+		Recording: len(util.RecordingDir()) > 0,
+		Dir:       util.RecordingDir(),
+	}
+	bytes, _ := json.Marshal(status)
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(bytes)
+}
+
+type recordingStatus struct {
+	Status    string `json:"status"`
+	Recording bool   `json:"recording"`
+	Dir       string `json:"dir"`
+}
+
+type migrationStatus struct {
+	Status        string `json:"status"`
+	Version       int    `json:"version"`
+	LatestVersion int    `json:"latest_version"`
 }
\ No newline at end of file
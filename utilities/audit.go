@@ -0,0 +1,92 @@
+package utilities
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/chris-sg/bst_api/db"
+	"github.com/chris-sg/bst_api/models/api_models"
+	bst_models "github.com/chris-sg/bst_server_models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	AuditActionImpersonate = "impersonate"
+	AuditActionDbMigration = "db_migration"
+	AuditActionForceUpdate = "force_update"
+	AuditActionLogin       = "eagate_login"
+	AuditActionLogout      = "eagate_logout"
+	AuditActionExport      = "account_export"
+	AuditActionDelete      = "account_delete"
+	AuditActionRecording   = "eagate_recording"
+
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeDenied  = "denied"
+)
+
+// impersonatorKey is added to the token map by ProfileFromToken when
+// the request is acting on behalf of another user.
+const impersonatorKey = "bst_impersonator"
+
+// AuditPseudonym generates the replacement used for a user's identity
+// in the audit log once their account has been deleted. It is random,
+// so it cannot be traced back to the user by hashing known ids; every
+// entry of a deleted user shares the one pseudonym made for them.
+func AuditPseudonym() (pseudonym string, err error) {
+	b := make([]byte, 8)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	pseudonym = "deleted:" + hex.EncodeToString(b)
+	return
+}
+
+// Audit will append an entry to the audit log. A failure to write the
+// entry is logged, but does not interrupt the request.
+func Audit(r *http.Request, actor string, effectiveUser string, action string, target string, outcome string) {
+	entry := api_models.AuditEntry{
+		Time:          time.Now().UTC(),
+		Actor:         strings.ToLower(actor),
+		EffectiveUser: strings.ToLower(effectiveUser),
+		Action:        action,
+		Target:        target,
+		RequestId:     RequestId(r),
+		Outcome:       outcome,
+	}
+
+	apiDb := db.GetApiDb()
+	if apiDb == nil {
+		return
+	}
+	errs := apiDb.AddAuditEntry(entry)
+	PrintErrors("failed to write audit entry:", errs)
+}
+
+// AuditForToken will append an entry to the audit log using the actor
+// and effective user from a token map loaded by ProfileFromToken.
+func AuditForToken(r *http.Request, tokenMap map[string]interface{}, action string, target string, outcome string) {
+	actor, effectiveUser := ActorsFromToken(tokenMap)
+	Audit(r, actor, effectiveUser, action, target, outcome)
+}
+
+// ActorsFromToken will return the user that made the request, and the
+// user the request is acting as. These will only differ when the
+// Impersonate-User header was accepted.
+func ActorsFromToken(tokenMap map[string]interface{}) (actor string, effectiveUser string) {
+	effectiveUser, _ = tokenMap["sub"].(string)
+	actor = effectiveUser
+	if impersonator, ok := tokenMap[impersonatorKey].(string); ok {
+		actor = impersonator
+	}
+	return
+}
+
+// AuditOutcome will convert an api error into an outcome for the
+// audit log.
+func AuditOutcome(err bst_models.Error) string {
+	if err.Equals(bst_models.ErrorOK) {
+		return AuditOutcomeSuccess
+	}
+	return "failed: " + err.Message
+}
@@ -15,6 +15,17 @@ var (
 	ApiBase string
 
 	DbMigration bool
+	DbRollback int
+	SqliteFile string
+	DbMemory bool
+
+	FakeEaGate string
+	FakeEaGateFixtures string
+	RecordDir string
+
+	VideoArchiveDir string
+	VideoArchiveMaxMb int64
+	VideoArchiveRetentionDays int
 
 	a0MgmtAudience string
 	a0MgmtClientId string
@@ -34,6 +45,7 @@ func LoadConfig() {
 	flag.StringVar(&ApiBase, "apibase", "/", "bst api base path.")
 
 	flag.BoolVar(&DbMigration, "dbmigrate", false, "run db migration and exit.")
+	flag.IntVar(&DbRollback, "dbrollback", 0, "roll back this many db migrations and exit.")
 
 	var (
 		user string
@@ -48,12 +60,30 @@ func LoadConfig() {
 	flag.StringVar(&dbname, "dbname", "", "the database name.")
 	flag.StringVar(&host, "dbhost", "", "the database host.")
 	flag.IntVar(&maxIdleConnections, "dbmaxconns", 1, "the max idle db connections.")
+	flag.StringVar(&SqliteFile, "sqlite", "", "use a sqlite database file instead of postgres, migrated on startup.")
+	flag.BoolVar(&DbMemory, "dbmemory", false, "keep all data in memory instead of a database, lost on exit.")
+
+	flag.StringVar(&FakeEaGate, "fakeeagate", "", "use an in-process fake eagate that accepts this login_id:password.")
+	flag.StringVar(&FakeEaGateFixtures, "fakeeagatefixtures", "", "the eagate directory of the source tree, holding the fake eagate fixtures. defaults to where the binary was built.")
+
+	flag.StringVar(&RecordDir, "recorddir", "", "record redacted eagate responses into this directory, can be toggled with PATCH /recording.")
+
+	flag.StringVar(&VideoArchiveDir, "videoarchivedir", "", "download drs play videos into this directory before their links expire.")
+	flag.Int64Var(&VideoArchiveMaxMb, "videoarchivemaxmb", 10240, "the most space in MB the video archive may use.")
+	flag.IntVar(&VideoArchiveRetentionDays, "videoarchivedays", 0, "remove archived videos of plays older than this many days, 0 keeps them forever.")
 
 	flag.Parse()
 
 	glog.Infoln("Done!")
 
-	err := db.OpenDb("postgres", user, password, dbname, host, maxIdleConnections)
+	var err error
+	if DbMemory {
+		err = db.OpenDb("memory", "", "", "", "", 1)
+	} else if len(SqliteFile) > 0 {
+		err = db.OpenDb("sqlite3", "", "", SqliteFile, "", 1)
+	} else {
+		err = db.OpenDb("postgres", user, password, dbname, host, maxIdleConnections)
+	}
 	if err != nil {
 		glog.Fatalln("Failed to open db!")
 		panic(err)
@@ -89,7 +89,9 @@ func getPemCert(token *jwt.Token) (string, error) {
 
 // profileFromToken will extract the user profile from the
 // request JWT token. This contains data used to validate
-// the user against an eagate account.
+// the user against an eagate account. An accepted
+// Impersonate-User header replaces the subject; the attempt is
+// audited once per request by auditImpersonation.
 func ProfileFromToken(r *http.Request) map[string]interface{} {
 	token, err := jwtmiddleware.FromAuthHeader(r)
 	if err != nil {
@@ -112,14 +114,31 @@ func ProfileFromToken(r *http.Request) map[string]interface{} {
 	if impersonateUser := r.Header.Get("Impersonate-User"); len(impersonateUser) > 0 {
 		val, ok := tokenMap["sub"].(string)
 		if ok {
-			glog.Infof("%s attempting to impersonate %s", val, impersonateUser)
 			val = strings.ToLower(val)
 			if UserHasScopes(val, []string{"impersonate"}) {
-				glog.Infof("%s is impersonating %s", val, impersonateUser)
 				tokenMap["sub"] = impersonateUser
+				tokenMap[impersonatorKey] = val
 			}
 		}
 	}
 
 	return tokenMap
-}
\ No newline at end of file
+}
+
+// auditImpersonation will write a single audit entry for a request
+// carrying the Impersonate-User header, however many times the
+// handler reads the token. It runs after the token has been validated.
+func auditImpersonation(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if impersonateUser := r.Header.Get("Impersonate-User"); len(impersonateUser) > 0 {
+		tokenMap := ProfileFromToken(r)
+		actor, effectiveUser := ActorsFromToken(tokenMap)
+		if _, ok := tokenMap[impersonatorKey]; ok {
+			glog.Infof("%s is impersonating %s", actor, impersonateUser)
+			Audit(r, actor, effectiveUser, AuditActionImpersonate, impersonateUser, AuditOutcomeSuccess)
+		} else if len(actor) > 0 {
+			glog.Infof("%s was denied impersonating %s", actor, impersonateUser)
+			Audit(r, actor, actor, AuditActionImpersonate, impersonateUser, AuditOutcomeDenied)
+		}
+	}
+	next(rw, r)
+}
@@ -0,0 +1,152 @@
+package utilities
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// NormaliseKana will fold the width of s, so full width latin letters
+// and half width katakana match their usual forms, and convert hiragana
+// to katakana. Readings and searches compare equal once normalised.
+func NormaliseKana(s string) string {
+	s = norm.NFKC.String(s)
+	return strings.Map(func(r rune) rune {
+		if r >= 'ぁ' && r <= 'ゖ' {
+			return r + ('ァ' - 'ぁ')
+		}
+		return r
+	}, s)
+}
+
+// katakanaDigraphs are the romaji of katakana followed by a small kana.
+var katakanaDigraphs = map[string]string{
+	"キャ": "kya", "キュ": "kyu", "キョ": "kyo",
+	"シャ": "sha", "シュ": "shu", "ショ": "sho", "シェ": "she",
+	"チャ": "cha", "チュ": "chu", "チョ": "cho", "チェ": "che",
+	"ニャ": "nya", "ニュ": "nyu", "ニョ": "nyo",
+	"ヒャ": "hya", "ヒュ": "hyu", "ヒョ": "hyo",
+	"ミャ": "mya", "ミュ": "myu", "ミョ": "myo",
+	"リャ": "rya", "リュ": "ryu", "リョ": "ryo",
+	"ギャ": "gya", "ギュ": "gyu", "ギョ": "gyo",
+	"ジャ": "ja", "ジュ": "ju", "ジョ": "jo", "ジェ": "je",
+	"ビャ": "bya", "ビュ": "byu", "ビョ": "byo",
+	"ピャ": "pya", "ピュ": "pyu", "ピョ": "pyo",
+	"ファ": "fa", "フィ": "fi", "フェ": "fe", "フォ": "fo",
+	"ウィ": "wi", "ウェ": "we", "ウォ": "wo",
+	"ヴァ": "va", "ヴィ": "vi", "ヴェ": "ve", "ヴォ": "vo",
+	"ティ": "ti", "ディ": "di", "トゥ": "tu", "ドゥ": "du",
+	"ツァ": "tsa", "ツェ": "tse", "ツォ": "tso",
+}
+
+// katakanaRomaji are the Hepburn romaji of single katakana.
+var katakanaRomaji = map[rune]string{
+	'ア': "a", 'イ': "i", 'ウ': "u", 'エ': "e", 'オ': "o",
+	'カ': "ka", 'キ': "ki", 'ク': "ku", 'ケ': "ke", 'コ': "ko",
+	'サ': "sa", 'シ': "shi", 'ス': "su", 'セ': "se", 'ソ': "so",
+	'タ': "ta", 'チ': "chi", 'ツ': "tsu", 'テ': "te", 'ト': "to",
+	'ナ': "na", 'ニ': "ni", 'ヌ': "nu", 'ネ': "ne", 'ノ': "no",
+	'ハ': "ha", 'ヒ': "hi", 'フ': "fu", 'ヘ': "he", 'ホ': "ho",
+	'マ': "ma", 'ミ': "mi", 'ム': "mu", 'メ': "me", 'モ': "mo",
+	'ヤ': "ya", 'ユ': "yu", 'ヨ': "yo",
+	'ラ': "ra", 'リ': "ri", 'ル': "ru", 'レ': "re", 'ロ': "ro",
+	'ワ': "wa", 'ヰ': "i", 'ヱ': "e", 'ヲ': "o", 'ン': "n",
+	'ガ': "ga", 'ギ': "gi", 'グ': "gu", 'ゲ': "ge", 'ゴ': "go",
+	'ザ': "za", 'ジ': "ji", 'ズ': "zu", 'ゼ': "ze", 'ゾ': "zo",
+	'ダ': "da", 'ヂ': "ji", 'ヅ': "zu", 'デ': "de", 'ド': "do",
+	'バ': "ba", 'ビ': "bi", 'ブ': "bu", 'ベ': "be", 'ボ': "bo",
+	'パ': "pa", 'ピ': "pi", 'プ': "pu", 'ペ': "pe", 'ポ': "po",
+	'ヴ': "vu",
+	'ァ': "a", 'ィ': "i", 'ゥ': "u", 'ェ': "e", 'ォ': "o",
+	'ャ': "ya", 'ュ': "yu", 'ョ': "yo", 'ヮ': "wa",
+	'・': " ",
+}
+
+// Romaji will transliterate the kana in s to Hepburn romaji. Anything
+// else, such as kanji or latin letters, is kept as it is.
+func Romaji(s string) string {
+	kana := []rune(NormaliseKana(s))
+	var romaji strings.Builder
+	double := false
+	afterN := false
+	for i := 0; i < len(kana); i++ {
+		var syllable string
+		if i+1 < len(kana) {
+			if digraph, exists := katakanaDigraphs[string(kana[i:i+2])]; exists {
+				syllable = digraph
+				i++
+			}
+		}
+		if len(syllable) == 0 {
+			switch kana[i] {
+			case 'ッ':
+				double = true
+				continue
+			case 'ー':
+				// a long vowel repeats the vowel before it
+				written := romaji.String()
+				if len(written) > 0 && strings.ContainsRune("aeiou", rune(written[len(written)-1])) {
+					romaji.WriteByte(written[len(written)-1])
+				}
+				continue
+			}
+			var exists bool
+			if syllable, exists = katakanaRomaji[kana[i]]; !exists {
+				if double {
+					romaji.WriteRune('ッ')
+					double = false
+				}
+				romaji.WriteRune(kana[i])
+				afterN = false
+				continue
+			}
+		}
+		if double {
+			if strings.HasPrefix(syllable, "ch") {
+				romaji.WriteByte('t')
+			} else if !strings.ContainsRune("aeioun ", rune(syllable[0])) {
+				romaji.WriteByte(syllable[0])
+			}
+			double = false
+		}
+		// n before a vowel or y is separated so it reads as ン
+		if afterN && strings.ContainsRune("aeiouy", rune(syllable[0])) {
+			romaji.WriteByte('\'')
+		}
+		afterN = kana[i] == 'ン'
+		romaji.WriteString(syllable)
+	}
+	return romaji.String()
+}
+
+// MatchesReading will check whether search is found in any of the given
+// values, ignoring case, width and the difference between hiragana and
+// katakana. Romaji searches also match values written in kana.
+func MatchesReading(search string, values ...string) bool {
+	search = strings.ToLower(NormaliseKana(strings.TrimSpace(search)))
+	if len(search) == 0 {
+		return true
+	}
+	compact := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '\'' {
+			return -1
+		}
+		return r
+	}, search)
+	for _, value := range values {
+		normalised := strings.ToLower(NormaliseKana(value))
+		if strings.Contains(normalised, search) {
+			return true
+		}
+		romaji := strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) || r == '\'' {
+				return -1
+			}
+			return r
+		}, strings.ToLower(Romaji(value)))
+		if len(compact) > 0 && strings.Contains(romaji, compact) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package utilities
+
+import "testing"
+
+func TestRomaji(t *testing.T) {
+	cases := map[string]string{
+		"フェイクソング":  "feikusongu",
+		"ダンスラッシュ":  "dansurasshu",
+		"ちょっと":     "chotto",
+		"ホンヤク":     "hon'yaku",
+		"サッカー":     "sakkaa",
+		"ﾀﾞﾝｽ":     "dansu",
+		"ジャンプ・アップ": "janpu appu",
+		"ABCアイ":    "ABCai",
+	}
+	for kana, expected := range cases {
+		if romaji := Romaji(kana); romaji != expected {
+			t.Errorf("romaji of %s should be %s, got %s", kana, expected, romaji)
+		}
+	}
+}
+
+func TestMatchesReading(t *testing.T) {
+	if !MatchesReading("ふぇいく", "フェイクソング") {
+		t.Errorf("hiragana search should match katakana reading")
+	}
+	if !MatchesReading("Feiku Song", "フェイクソング") {
+		t.Errorf("romaji search should match katakana reading")
+	}
+	if MatchesReading("dance", "フェイクソング") {
+		t.Errorf("unrelated search should not match")
+	}
+}
@@ -1,10 +1,17 @@
 package utilities
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"github.com/urfave/negroni"
 	"net/http"
 )
 
+type requestIdKey struct{}
+
+const requestIdHeader = "X-Request-Id"
+
 var (
 	commonMiddleware *negroni.Negroni
 	protectionMiddleware *negroni.Negroni
@@ -23,7 +30,8 @@ func PrepareMiddleware() {
 	if protectionMiddleware == nil {
 		protectionMiddleware = negroni.New(
 			negroni.HandlerFunc(setForbidden),
-			negroni.HandlerFunc(GetJWTMiddleware().HandlerWithNext))
+			negroni.HandlerFunc(GetJWTMiddleware().HandlerWithNext),
+			negroni.HandlerFunc(auditImpersonation))
 	}
 }
 
@@ -35,6 +43,19 @@ func GetProtectionMiddleware() *negroni.Negroni {
 	return protectionMiddleware
 }
 
+// RequestId will return the id assigned to the request by startAction.
+// Requests that did not pass through the common middleware will
+// return an empty string.
+func RequestId(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if requestId, ok := r.Context().Value(requestIdKey{}).(string); ok {
+		return requestId
+	}
+	return ""
+}
+
 // SetForbidden will set the status header. This is done prior
 // to validating a token, and will be changed if successfully
 // validated.
@@ -55,11 +76,22 @@ func setContentType(rw http.ResponseWriter, r *http.Request, next http.HandlerFu
 	next(rw, r)
 }
 
+// startAction will assign an id to the request, reusing one supplied
+// by the caller if present. The id is returned in the response headers
+// so that audit entries can be matched against client logs.
 func startAction(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	//ctx := r.Context()
-	//action := api_models.Action{
-	//	Id:    uuid.New(),
-	//	State: "started",
-	//}
-	next(rw, r)
-}
\ No newline at end of file
+	requestId := r.Header.Get(requestIdHeader)
+	if len(requestId) == 0 || len(requestId) > 64 {
+		requestId = newRequestId()
+	}
+	rw.Header().Set(requestIdHeader, requestId)
+	next(rw, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, requestId)))
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,31 @@
+package utilities
+
+import (
+	"github.com/chris-sg/bst_api/models/drs_models"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+)
+
+// ArchivedVideoPath is where the archived copy of a video is stored, or
+// an empty string if there is no copy.
+func ArchivedVideoPath(video drs_models.ArchivedVideo) string {
+	if len(VideoArchiveDir) == 0 || len(video.File) == 0 {
+		return ""
+	}
+	return filepath.Join(VideoArchiveDir, filepath.FromSlash(video.File))
+}
+
+// RemoveArchivedVideoFiles will delete the archived copies of the
+// videos. Failures are logged, as the rows are removed regardless.
+func RemoveArchivedVideoFiles(videos []drs_models.ArchivedVideo) {
+	for _, video := range videos {
+		path := ArchivedVideoPath(video)
+		if len(path) == 0 {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			glog.Warningf("failed to remove archived video %s: %s\n", path, err.Error())
+		}
+	}
+}